@@ -0,0 +1,500 @@
+package glua
+
+import (
+	"fmt"
+	"reflect"
+	"runtime/cgo"
+	"sort"
+	"sync"
+)
+
+// Bind exposes a Go value to Lua through reflection: exported methods become methods of the userdata and exported
+// fields are read and written through __index/__newindex. Values are always bound through a pointer, so methods
+// with pointer receivers work and field writes change the Go value.
+//
+// The reflection work (method and field lists, argument converters) is done once per type and cached. Arguments
+// are converted by type:
+//
+//	numbers, string, bool, []byte    checked like CheckNumber, CheckString...
+//	State                            the calling state, it doesn't take a Lua argument
+//	*LuaObject                       a reference to the Lua value
+//	bound values                     the Go value behind the userdata
+//	interfaces with an adapter       see Implement
+//	slices, maps, any                converted from ToAny
+//
+// Results are pushed with PushAny, a trailing error result raises a Lua error when it isn't nil.
+
+// Set in the metatables of bound types, so bound userdata can be told apart from other userdata
+const bindMarker = "__gluabind"
+
+// Appended to the metatable name of values bound with BindReadOnly
+const bindReadOnlySuffix = " (read-only)"
+
+// Field tag options, `lua:"-"` hides a field and `lua:"readonly"` makes it read-only
+const (
+	bindTagSkip     = "-"
+	bindTagReadOnly = "readonly"
+)
+
+type bindOptions struct {
+	name     string
+	readOnly bool
+}
+
+type BindOption func(*bindOptions)
+
+// Sets the metatable name of the bound type, it defaults to the Go type name (eg. "main.Player").
+func BindAs(name string) BindOption {
+	return func(o *bindOptions) {
+		o.name = name
+	}
+}
+
+// Makes every field read-only, methods can still change the value.
+func BindReadOnly() BindOption {
+	return func(o *bindOptions) {
+		o.readOnly = true
+	}
+}
+
+// A Go value prepared by Bind, push it with Push, PushAny or as a Library member.
+type Bound struct {
+	ptr  reflect.Value
+	opts bindOptions
+}
+
+type bindType struct {
+	methods map[string]*bindMethod
+	fields  map[string]*bindField
+}
+
+type bindMethod struct {
+	fn   reflect.Value // the method expression, the receiver is its first argument
+	call *funcInfo
+}
+
+type bindField struct {
+	index    []int
+	typ      reflect.Type
+	readOnly bool
+	conv     argFunc
+}
+
+var (
+	bindTypes sync.Map // reflect.Type -> *bindType
+
+	bindNamesMu sync.Mutex
+	bindNames   = map[string]reflect.Type{}
+)
+
+/*
+Prepares value to be pushed as a Lua object exposing its exported methods and fields, see the notes at the top of
+bind.go for how values are converted.
+
+Non-pointer values are copied, bind a pointer to share the value with Go. The same pointer always pushes the same
+userdata while Lua keeps it alive.
+
+# Example
+
+	type Player struct {
+		Name  string
+		Score int
+		Token string `lua:"-"`
+		ID    int    `lua:"readonly"`
+	}
+
+	func (p *Player) AddScore(n int) int {
+		p.Score += n
+		return p.Score
+	}
+
+	glua.Bind(player).Push(L)
+	L.SetGlobal("player")
+
+	-- lua
+	player.Score = 10
+	print(player:AddScore(5), player.Name)
+	player.ID = 2 -- error, read-only
+*/
+func Bind(value any, opts ...BindOption) *Bound {
+	rv := reflect.ValueOf(value)
+	if !rv.IsValid() {
+		panic("glua: Bind expects a non-nil value")
+	}
+
+	if rv.Kind() != reflect.Pointer {
+		ptr := reflect.New(rv.Type())
+		ptr.Elem().Set(rv)
+		rv = ptr
+	} else if rv.IsNil() {
+		panic("glua: Bind expects a non-nil value")
+	}
+
+	b := &Bound{ptr: rv}
+	for _, opt := range opts {
+		opt(&b.opts)
+	}
+	if b.opts.name == "" {
+		b.opts.name = rv.Type().Elem().String()
+	}
+	if b.opts.readOnly {
+		b.opts.name += bindReadOnlySuffix
+	}
+
+	bindNamesMu.Lock()
+	other, ok := bindNames[b.opts.name]
+	if !ok {
+		bindNames[b.opts.name] = rv.Type()
+	}
+	bindNamesMu.Unlock()
+	if ok && other != rv.Type() {
+		panic(fmt.Sprintf("glua: bind name %s is already used by %s", b.opts.name, other))
+	}
+
+	return b
+}
+
+// Returns the Go value that was bound, always a pointer.
+func (b *Bound) Value() any {
+	return b.ptr.Interface()
+}
+
+// Returns the metatable name of the bound value.
+func (b *Bound) Name() string {
+	return b.opts.name
+}
+
+// Pushes the bound value as a userdata, its metatable is created the first time a value of the type is pushed.
+func (b *Bound) Push(L State) cgo.Handle {
+	bt := bindTypeOf(b.ptr.Type())
+
+	if L.NewMetaTable(b.opts.name) {
+		bt.setMetamethods(L, b.opts)
+	}
+	L.Pop()
+
+	return L.PushCachedUserData(b.ptr.Interface(), &b.opts.name)
+}
+
+// Returns the cached reflection metadata of the pointer type t.
+func bindTypeOf(t reflect.Type) *bindType {
+	if bt, ok := bindTypes.Load(t); ok {
+		return bt.(*bindType)
+	}
+
+	bt := &bindType{
+		methods: map[string]*bindMethod{},
+		fields:  map[string]*bindField{},
+	}
+
+	for i := 0; i < t.NumMethod(); i++ {
+		m := t.Method(i)
+		bt.methods[m.Name] = &bindMethod{fn: m.Func, call: funcInfoOf(m.Func.Type(), 1)}
+	}
+
+	if st := t.Elem(); st.Kind() == reflect.Struct {
+		for _, f := range reflect.VisibleFields(st) {
+			if !f.IsExported() || f.Anonymous {
+				continue
+			}
+			// promoted fields hidden by a shallower one with the same name
+			if top, _ := st.FieldByName(f.Name); len(top.Index) != len(f.Index) {
+				continue
+			}
+			if _, ok := bt.methods[f.Name]; ok {
+				continue
+			}
+
+			tag := f.Tag.Get("lua")
+			if tag == bindTagSkip {
+				continue
+			}
+
+			bt.fields[f.Name] = &bindField{
+				index:    f.Index,
+				typ:      f.Type,
+				readOnly: tag == bindTagReadOnly,
+				conv:     argConverter(f.Type),
+			}
+		}
+	}
+
+	actual, _ := bindTypes.LoadOrStore(t, bt)
+	return actual.(*bindType)
+}
+
+// Sorted names of the methods, for stable output in stubs and errors.
+func (bt *bindType) methodNames() []string {
+	names := make([]string, 0, len(bt.methods))
+	for name := range bt.methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Fills the metatable at the top of the stack.
+func (bt *bindType) setMetamethods(L State, opts bindOptions) {
+	name := opts.name
+
+	self := func(L State) reflect.Value {
+		return reflect.ValueOf(L.GetUserData(1, &name).Value())
+	}
+
+	L.PushBool(true)
+	L.SetField(-2, bindMarker)
+
+	L.NewTable()
+	for _, method := range bt.methodNames() {
+		m := bt.methods[method]
+		L.PushGoFunc(func(L State) int {
+			return m.call.call(L, m.fn, []reflect.Value{self(L)}, 2)
+		})
+		L.SetField(-2, method)
+	}
+	L.SetField(-2, "__methods")
+
+	L.PushGoFunc(func(L State) int {
+		v := self(L)
+		if L.Type(2) != LUA_TSTRING {
+			return 0
+		}
+		key := L.GetString(2)
+
+		if f, ok := bt.fields[key]; ok {
+			fv := v.Elem().FieldByIndex(f.index)
+			if fv.Kind() == reflect.Struct {
+				var viewOpts []BindOption
+				if f.readOnly || opts.readOnly {
+					viewOpts = append(viewOpts, BindReadOnly())
+				}
+				Bind(fv.Addr().Interface(), viewOpts...).Push(L) // a live view, writes go to the parent
+			} else if err := L.PushAny(fv.Interface()); err != nil {
+				panic(fmt.Sprintf("field '%s': %v", key, err))
+			}
+			return 1
+		}
+
+		L.GetMetatable(1)
+		L.GetField(-1, "__methods")
+		L.GetField(-1, key)
+		return 1
+	})
+	L.SetField(-2, "__index")
+
+	L.PushGoFunc(func(L State) int {
+		v := self(L)
+		key := L.CheckString(2)
+
+		f, ok := bt.fields[key]
+		if !ok {
+			L.ArgError(2, fmt.Sprintf("%s has no field '%s'", name, key))
+		}
+		if f.readOnly || opts.readOnly {
+			L.ArgError(2, fmt.Sprintf("field '%s' of %s is read-only", key, name))
+		}
+
+		v.Elem().FieldByIndex(f.index).Set(f.conv(L, 3))
+		return 0
+	})
+	L.SetField(-2, "__newindex")
+
+	L.PushGoFunc(func(L State) int {
+		v := self(L)
+		if s, ok := v.Interface().(fmt.Stringer); ok {
+			L.PushString(s.String())
+		} else {
+			L.PushString(fmt.Sprintf("%s: %p", name, v.Interface()))
+		}
+		return 1
+	})
+	L.SetField(-2, "__tostring")
+
+	L.PushGoFunc(func(L State) int {
+		L.FreeUserData(1)
+		return 0
+	})
+	L.SetField(-2, "__gc")
+}
+
+// Returns the Go value behind the bound userdata at the given index.
+func (L State) toBound(idx int) (any, bool) {
+	if L.Type(idx) != LUA_TUSERDATA || L.GetMetatable(idx) == 0 {
+		return nil, false
+	}
+	L.GetField(-1, bindMarker)
+	bound := L.GetBool(-1)
+	L.PopN(2)
+	if !bound {
+		return nil, false
+	}
+
+	block := L.toGoUserData(idx)
+	if block.handle == 0 || block.epoch != CurrentEpoch() {
+		return nil, false
+	}
+	return block.handle.Value(), true
+}
+
+// Converts the Lua argument at arg to a Go value, raising an argument error if it can't.
+type argFunc func(L State, arg int) reflect.Value
+
+var (
+	stateType     = reflect.TypeFor[State]()
+	errorType     = reflect.TypeFor[error]()
+	luaObjectType = reflect.TypeFor[*LuaObject]()
+	bytesType     = reflect.TypeFor[[]byte]()
+)
+
+func argConverter(t reflect.Type) argFunc {
+	switch t {
+	case luaObjectType:
+		return func(L State, arg int) reflect.Value {
+			if L.IsNoneOrNil(arg) {
+				return reflect.Zero(t)
+			}
+			return reflect.ValueOf(L.NewLuaObject(arg))
+		}
+	case bytesType:
+		return func(L State, arg int) reflect.Value {
+			return reflect.ValueOf(L.CheckBinaryString(arg))
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return func(L State, arg int) reflect.Value {
+			return reflect.ValueOf(L.CheckNumber(arg)).Convert(t)
+		}
+	case reflect.String:
+		return func(L State, arg int) reflect.Value {
+			return reflect.ValueOf(L.CheckString(arg)).Convert(t)
+		}
+	case reflect.Bool:
+		return func(L State, arg int) reflect.Value {
+			return reflect.ValueOf(L.CheckBool(arg)).Convert(t)
+		}
+	}
+
+	return func(L State, arg int) reflect.Value {
+		v, err := L.toType(arg, t)
+		if err != nil {
+			L.ArgError(arg, err.Error())
+		}
+		return v
+	}
+}
+
+// Cached calling information of a function type.
+type funcInfo struct {
+	in       []argFunc // nil for State arguments
+	variadic argFunc   // converter of the variadic element, nil if the function isn't variadic
+	numOut   int
+	errLast  bool
+}
+
+var funcInfos sync.Map // funcInfoKey -> *funcInfo
+
+type funcInfoKey struct {
+	t    reflect.Type
+	skip int
+}
+
+// Returns the calling information of the function type t, the first skip arguments are given by the caller
+// (eg. the receiver of a method).
+func funcInfoOf(t reflect.Type, skip int) *funcInfo {
+	key := funcInfoKey{t, skip}
+	if fi, ok := funcInfos.Load(key); ok {
+		return fi.(*funcInfo)
+	}
+
+	fi := &funcInfo{numOut: t.NumOut()}
+
+	numIn := t.NumIn()
+	if t.IsVariadic() {
+		numIn--
+		fi.variadic = argConverter(t.In(numIn).Elem())
+	}
+	for i := skip; i < numIn; i++ {
+		if t.In(i) == stateType {
+			fi.in = append(fi.in, nil)
+		} else {
+			fi.in = append(fi.in, argConverter(t.In(i)))
+		}
+	}
+
+	if fi.numOut > 0 && t.Out(fi.numOut-1) == errorType {
+		fi.errLast = true
+		fi.numOut--
+	}
+
+	actual, _ := funcInfos.LoadOrStore(key, fi)
+	return actual.(*funcInfo)
+}
+
+// Converts the Lua arguments starting at arg, calls fn with args followed by them and pushes the results.
+func (fi *funcInfo) call(L State, fn reflect.Value, args []reflect.Value, arg int) int {
+	for _, conv := range fi.in {
+		if conv == nil {
+			args = append(args, reflect.ValueOf(L))
+			continue
+		}
+		args = append(args, conv(L, arg))
+		arg++
+	}
+	if fi.variadic != nil {
+		for top := L.GetTop(); arg <= top; arg++ {
+			args = append(args, fi.variadic(L, arg))
+		}
+	}
+
+	out := fn.Call(args)
+
+	if fi.errLast {
+		if err := out[fi.numOut]; !err.IsNil() {
+			panic(err.Interface().(error).Error())
+		}
+	}
+
+	for i := 0; i < fi.numOut; i++ {
+		if err := L.PushAny(out[i].Interface()); err != nil {
+			panic(fmt.Sprintf("result #%d: %v", i+1, err))
+		}
+	}
+	return fi.numOut
+}
+
+/*
+Wraps any Go function into a GoFunc, converting its arguments and results like the methods of Bind. PushAny and
+Library use it for functions that aren't GoFuncs.
+
+It panics if fn isn't a function.
+
+# Example
+
+	L.PushGoFunc(glua.WrapFunc(strings.Repeat))
+	L.SetGlobal("repeat_string")
+
+	-- lua
+	print(repeat_string("ab", 3))
+*/
+func WrapFunc(fn any) GoFunc {
+	if gf, ok := fn.(GoFunc); ok {
+		return gf
+	}
+	if gf, ok := fn.(func(State) int); ok {
+		return gf
+	}
+
+	rv := reflect.ValueOf(fn)
+	if rv.Kind() != reflect.Func || rv.IsNil() {
+		panic(fmt.Sprintf("glua: WrapFunc expects a function, got %T", fn))
+	}
+
+	fi := funcInfoOf(rv.Type(), 0)
+	return func(L State) int {
+		return fi.call(L, rv, make([]reflect.Value, 0, len(fi.in)), 1)
+	}
+}
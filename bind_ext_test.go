@@ -0,0 +1,111 @@
+package glua_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Srlion/glua"
+	"github.com/Srlion/glua/gluatest"
+)
+
+type bindPos struct{ X, Y int }
+
+type bindTestPlayer struct {
+	Name  string
+	Score int
+	Pos   bindPos
+	Token string `lua:"-"`
+	ID    int    `lua:"readonly"`
+}
+
+func (p *bindTestPlayer) AddScore(n int) int {
+	p.Score += n
+	return p.Score
+}
+
+func (p *bindTestPlayer) Rename(name string) error {
+	if name == "" {
+		return errors.New("empty name")
+	}
+	p.Name = name
+	return nil
+}
+
+func (p *bindTestPlayer) String() string { return "player " + p.Name }
+
+func TestBind(t *testing.T) {
+	L := gluatest.New(t)
+
+	player := &bindTestPlayer{Name: "alice", ID: 7, Token: "secret"}
+	glua.Bind(player, glua.BindAs("glua_test_Player")).Push(L.State)
+	L.SetGlobal("player")
+
+	L.AssertGlobal("player.Name", "alice")
+	L.AssertGlobal("player.Token", nil)
+	L.AssertEqual(L.Eval("return tostring(player)")[0], "player alice")
+
+	L.Eval("player.Score = 10")
+	L.AssertEqual(L.Eval("return player:AddScore(5)")[0], 15)
+	if player.Score != 15 {
+		t.Fatalf("Score = %d, Lua writes don't reach the Go value", player.Score)
+	}
+
+	L.Eval("player.Pos.X = 3")
+	if player.Pos.X != 3 {
+		t.Fatalf("Pos.X = %d, nested struct fields aren't live views", player.Pos.X)
+	}
+
+	L.AssertError("player.ID = 2", "field 'ID' of glua_test_Player is read-only")
+	L.AssertError("player.Token = 'x'", "glua_test_Player has no field 'Token'")
+	L.AssertError("player.Score = 'many'", "number expected")
+	L.AssertError("player:Rename('')", "empty name")
+	L.Eval("player:Rename('bob')")
+	L.AssertGlobal("player.Name", "bob")
+
+	// the same pointer pushes the same userdata
+	glua.Bind(player, glua.BindAs("glua_test_Player")).Push(L.State)
+	L.GetGlobal("player")
+	if !L.AreRawEqual(-1, -2) {
+		t.Fatal("binding the same pointer twice pushed different userdata")
+	}
+	L.PopN(2)
+}
+
+func TestBindReadOnly(t *testing.T) {
+	L := gluatest.New(t)
+
+	player := &bindTestPlayer{Name: "alice"}
+	glua.Bind(player, glua.BindAs("glua_test_Player"), glua.BindReadOnly()).Push(L.State)
+	L.SetGlobal("player")
+
+	L.AssertError("player.Score = 1", "read-only")
+	L.AssertError("player.Pos.X = 1", "read-only")
+	L.AssertEqual(L.Eval("return player:AddScore(2)")[0], 2)
+}
+
+func TestWrapFunc(t *testing.T) {
+	L := gluatest.New(t)
+
+	L.PushGoFunc(glua.WrapFunc(strings.Repeat))
+	L.SetGlobal("repeat_string")
+	L.AssertEqual(L.Eval("return repeat_string('ab', 3)")[0], "ababab")
+	L.AssertError("repeat_string('ab')", "number expected")
+
+	L.PushGoFunc(glua.WrapFunc(func(L glua.State, sep string, parts ...int) string {
+		strs := make([]string, len(parts))
+		for i, p := range parts {
+			strs[i] = fmt.Sprint(p)
+		}
+		return strings.Join(strs, sep)
+	}))
+	L.SetGlobal("join")
+	L.AssertEqual(L.Eval("return join('-', 1, 2, 3)")[0], "1-2-3")
+	L.AssertEqual(L.Eval("return join('-')")[0], "")
+
+	L.PushGoFunc(glua.WrapFunc(func(m map[string]int, list []string) (int, int) { return m["a"], len(list) }))
+	L.SetGlobal("sizes")
+	L.AssertEqual(L.Eval("return select(2, sizes({a = 4}, {'x', 'y'}))")[0], 2)
+	L.AssertEqual(L.Eval("return sizes({a = 4}, {})")[0], 4)
+}
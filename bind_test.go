@@ -0,0 +1,87 @@
+package glua
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type bindBase struct {
+	ID   int
+	Name string
+}
+
+type bindPlayer struct {
+	bindBase
+	Name   string // hides bindBase.Name
+	Score  int
+	Token  string `lua:"-"`
+	Level  int    `lua:"readonly"`
+	hidden int
+}
+
+func (p *bindPlayer) AddScore(n int) int { p.Score += n; return p.Score }
+func (p bindPlayer) Greeting() string    { return "hi " + p.Name }
+
+func TestBindTypeMetadata(t *testing.T) {
+	bt := bindTypeOf(reflect.TypeFor[*bindPlayer]())
+
+	if got, want := bt.methodNames(), []string{"AddScore", "Greeting"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("methods = %v, want %v", got, want)
+	}
+
+	if got := strings.Join(sortedKeys(bt.fields), ","); got != "ID,Level,Name,Score" {
+		t.Fatalf("fields = %s, want ID,Level,Name,Score", got)
+	}
+	if !bt.fields["Level"].readOnly || bt.fields["Score"].readOnly {
+		t.Fatal("only Level should be read-only")
+	}
+	if got := bt.fields["Name"].index; len(got) != 1 {
+		t.Fatalf("Name resolves to the promoted field %v", got)
+	}
+	if got := bt.fields["ID"].index; !reflect.DeepEqual(got, []int{0, 0}) {
+		t.Fatalf("ID index = %v, want the promoted field", got)
+	}
+
+	if bindTypeOf(reflect.TypeFor[*bindPlayer]()) != bt {
+		t.Fatal("bind types aren't cached")
+	}
+}
+
+func TestFuncInfo(t *testing.T) {
+	fi := funcInfoOf(reflect.TypeOf(func(p *bindPlayer, L State, s string, rest ...int) (int, error) { return 0, nil }), 1)
+	if len(fi.in) != 2 || fi.in[0] != nil || fi.in[1] == nil {
+		t.Fatalf("in = %v, want a State slot then a converter", fi.in)
+	}
+	if fi.variadic == nil || fi.numOut != 1 || !fi.errLast {
+		t.Fatalf("got variadic %t, %d results and errLast %t", fi.variadic != nil, fi.numOut, fi.errLast)
+	}
+
+	fi = funcInfoOf(reflect.TypeOf(func() error { return nil }), 0)
+	if fi.numOut != 0 || !fi.errLast || fi.variadic != nil {
+		t.Fatalf("got %d results and errLast %t for func() error", fi.numOut, fi.errLast)
+	}
+}
+
+func TestBindNames(t *testing.T) {
+	type bindNameA struct{}
+	type bindNameB struct{}
+	t.Cleanup(func() {
+		bindNamesMu.Lock()
+		delete(bindNames, "glua_test_bind")
+		delete(bindNames, "glua_test_bind"+bindReadOnlySuffix)
+		bindNamesMu.Unlock()
+	})
+
+	a := Bind(bindNameA{}, BindAs("glua_test_bind"))
+	if _, ok := a.Value().(*bindNameA); !ok {
+		t.Fatalf("Value() = %T, want a pointer to the copy", a.Value())
+	}
+	if ro := Bind(&bindNameA{}, BindAs("glua_test_bind"), BindReadOnly()); ro.Name() != "glua_test_bind"+bindReadOnlySuffix {
+		t.Fatalf("read-only name = %q", ro.Name())
+	}
+
+	expectPanic(t, "already used by", func() { Bind(&bindNameB{}, BindAs("glua_test_bind")) })
+	expectPanic(t, "non-nil", func() { Bind((*bindNameA)(nil)) })
+	expectPanic(t, "WrapFunc expects a function", func() { WrapFunc(1) })
+}
@@ -0,0 +1,65 @@
+#include <stdatomic.h>
+#include "debug_hook.h"
+#include "glua.h"
+
+extern void goDebugHook(lua_State L, lua_Debug *ar);
+
+// Lines above this are always passed to Go, they are rare enough to not matter
+#define DEBUG_HOOK_MAX_LINES 65536
+
+static atomic_int debug_hook_mode = DEBUG_HOOK_OFF;
+static atomic_uchar debug_hook_lines[DEBUG_HOOK_MAX_LINES / 8];
+
+void debug_hook_set_mode(int mode)
+{
+    atomic_store_explicit(&debug_hook_mode, mode, memory_order_relaxed);
+}
+
+void debug_hook_set_line(int line, int enabled)
+{
+    if (line < 0 || line >= DEBUG_HOOK_MAX_LINES)
+    {
+        return;
+    }
+
+    unsigned char bit = (unsigned char)(1 << (line & 7));
+    if (enabled)
+    {
+        atomic_fetch_or_explicit(&debug_hook_lines[line >> 3], bit, memory_order_relaxed);
+    }
+    else
+    {
+        atomic_fetch_and_explicit(&debug_hook_lines[line >> 3], (unsigned char)~bit, memory_order_relaxed);
+    }
+}
+
+void debug_hook_clear_lines()
+{
+    for (size_t i = 0; i < sizeof(debug_hook_lines); ++i)
+    {
+        atomic_store_explicit(&debug_hook_lines[i], 0, memory_order_relaxed);
+    }
+}
+
+// Line hooks fire for every line executed, so we filter them here and only cross into Go
+// when a breakpoint could be on this line or when the debugger wants every line (stepping/pausing)
+void debug_hook(lua_State L, lua_Debug *ar)
+{
+    int mode = atomic_load_explicit(&debug_hook_mode, memory_order_relaxed);
+    if (mode == DEBUG_HOOK_OFF)
+    {
+        return;
+    }
+
+    if (mode == DEBUG_HOOK_BREAKPOINTS)
+    {
+        int line = ar->currentline;
+        if (line >= 0 && line < DEBUG_HOOK_MAX_LINES &&
+            (atomic_load_explicit(&debug_hook_lines[line >> 3], memory_order_relaxed) & (1 << (line & 7))) == 0)
+        {
+            return;
+        }
+    }
+
+    goDebugHook(L, ar);
+}
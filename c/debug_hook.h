@@ -0,0 +1,12 @@
+#pragma once
+#include <stdatomic.h>
+#include "glua.h"
+
+#define DEBUG_HOOK_OFF 0
+#define DEBUG_HOOK_BREAKPOINTS 1
+#define DEBUG_HOOK_ALL 2
+
+extern void debug_hook_set_mode(int mode);
+extern void debug_hook_set_line(int line, int enabled);
+extern void debug_hook_clear_lines();
+extern void debug_hook(lua_State L, lua_Debug *ar);
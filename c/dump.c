@@ -0,0 +1,15 @@
+#include "dump.h"
+#include "glua.h"
+
+extern int goDumpWriter(void *p, size_t sz, uintptr_t handle);
+
+static int dump_writer(lua_State L, const void *p, size_t sz, void *ud)
+{
+    return goDumpWriter((void *)p, sz, (uintptr_t)ud);
+}
+
+// Dumps the function at the top of the stack, the handle is passed back to Go with every written piece
+int dump_function(lua_State L, uintptr_t handle)
+{
+    return lua_dump_wrap(L, dump_writer, (void *)handle);
+}
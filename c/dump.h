@@ -0,0 +1,4 @@
+#pragma once
+#include "glua.h"
+
+extern int dump_function(lua_State L, uintptr_t handle);
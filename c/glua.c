@@ -1,67 +1,92 @@
 #include "glua.h"
 #include "_cgo_export.h"
 
-static const char *s_foundLuaSharedPath = NULL;
+#ifndef _WIN32
+#include <pthread.h>
+#endif
 
-void *LuaShared(void)
-{
-    const char **paths = NULL;
-    size_t path_count = 0;
-    void *handle = NULL;
+static const char *s_foundLuaSharedPath = NULL;
 
+// Paths the game keeps lua_shared at, relative to the working directory of srcds/gmod
+static const char *lua_shared_default_paths[] = {
 #ifdef _WIN32
 #ifdef _WIN64
-    static const char *win_paths[] = {
-        "lua_shared.dll",
-        "bin/win64/lua_shared.dll"};
+    "lua_shared.dll",
+    "bin/win64/lua_shared.dll",
 #else
-    static const char *win_paths[] = {
-        "lua_shared.dll",
-        "garrysmod/bin/lua_shared.dll",
-        "bin/lua_shared.dll"};
+    "lua_shared.dll",
+    "garrysmod/bin/lua_shared.dll",
+    "bin/lua_shared.dll",
 #endif
-    paths = win_paths;
-    path_count = sizeof(win_paths) / sizeof(win_paths[0]);
-
 #else
 #if defined(__x86_64__) || defined(_M_X64)
-    static const char *linux_paths[] = {
-        "lua_shared.so",
-        "bin/linux64/lua_shared.so"};
+    "lua_shared.so",
+    "bin/linux64/lua_shared.so",
 #else
-    static const char *linux_paths[] = {
-        "lua_shared_srv.so",
-        "garrysmod/bin/lua_shared_srv.so",
-        "bin/linux32/lua_shared.so"};
+    "lua_shared_srv.so",
+    "garrysmod/bin/lua_shared_srv.so",
+    "bin/linux32/lua_shared.so",
 #endif
-    paths = linux_paths;
-    path_count = sizeof(linux_paths) / sizeof(linux_paths[0]);
 #endif
+};
 
-    // Attempt to load the library from each path
-    for (size_t i = 0; i < path_count; ++i)
+const char *lua_shared_default_path(size_t i)
+{
+    if (i >= sizeof(lua_shared_default_paths) / sizeof(lua_shared_default_paths[0]))
     {
-        handle = LOAD_LIBRARY(paths[i]);
-        if (handle != NULL)
+        return NULL;
+    }
+    return lua_shared_default_paths[i];
+}
+
+/*
+Opens the library at path, with reuse it only succeeds if the library is already loaded in the process (eg. the copy
+srcds mapped), without it the library is loaded if needed.
+
+Either way the reference count of the library is incremented, so unload_lua_shared can always close it.
+
+On failure it returns NULL and sets err to a malloc'd description of the loader's error.
+*/
+void *open_lua_shared(const char *path, int reuse, char **err)
+{
+    LIB_HANDLE handle = NULL;
+    *err = NULL;
+
+#ifdef _WIN32
+    if (reuse)
+    {
+        if (!GetModuleHandleExA(0, path, &handle))
         {
-            s_foundLuaSharedPath = paths[i];
-            return handle; // Successfully loaded
+            handle = NULL;
         }
     }
+    else
+    {
+        handle = LOAD_LIBRARY(path);
+    }
+
+    if (handle == NULL)
+    {
+        *err = format("error code %lu", (unsigned long)GET_LOAD_ERROR());
+    }
+#else
+    dlerror(); // clear any previous error
+    handle = dlopen(path, reuse ? RTLD_LAZY | RTLD_NOLOAD : RTLD_LAZY);
+
+    if (handle == NULL)
+    {
+        const char *msg = GET_LOAD_ERROR();
+        *err = strdup(msg != NULL ? msg : "not loaded");
+    }
+#endif
 
-    return NULL; // Failed to load
+    return (void *)handle;
 }
 
 LIB_HANDLE hModule = NULL;
 
-const char *load_lua_shared()
+static const char *load_lua_shared_functions()
 {
-    hModule = LuaShared();
-    if (hModule == NULL)
-    {
-        return "Failed to load Lua shared library";
-    }
-
 #define X(return_type, func_name, ...)                             \
     func_name##_ptr = GET_FUNCTION(hModule, #func_name);           \
     if (func_name##_ptr == NULL)                                   \
@@ -71,11 +96,99 @@ const char *load_lua_shared()
 
     GLUA_FUNCTIONS
 
+#undef X
+
+    // optional functions stay NULL when missing
+#define X(return_type, func_name, ...) \
+    func_name##_ptr = GET_FUNCTION(hModule, #func_name);
+
+    GLUA_OPTIONAL_FUNCTIONS
+
 #undef X
 
     return NULL;
 }
 
+/*
+Returns the name of the i-th function glua loads (the required ones then the optional ones) and sets loaded to 1 if
+it was loaded from lua_shared, NULL past the last one.
+*/
+const char *lua_function_at(size_t i, int *loaded)
+{
+#define X(return_type, func_name, ...)     \
+    if (i == 0)                            \
+    {                                      \
+        *loaded = func_name##_ptr != NULL; \
+        return #func_name;                 \
+    }                                      \
+    i--;
+
+    GLUA_FUNCTIONS
+    GLUA_OPTIONAL_FUNCTIONS
+
+#undef X
+
+    return NULL;
+}
+
+// Returns the name of the i-th optional function that is missing, NULL past the last one
+const char *missing_lua_function(size_t i)
+{
+#define X(return_type, func_name, ...) \
+    if (func_name##_ptr == NULL)       \
+    {                                  \
+        if (i == 0)                    \
+        {                              \
+            return #func_name;         \
+        }                              \
+        i--;                           \
+    }
+
+    GLUA_OPTIONAL_FUNCTIONS
+
+#undef X
+
+    return NULL;
+}
+
+// Forgets every function pointer, so none points into a library that was closed
+static void clear_lua_shared_functions()
+{
+#define X(return_type, func_name, ...) \
+    func_name##_ptr = NULL;
+
+    GLUA_FUNCTIONS
+    GLUA_OPTIONAL_FUNCTIONS
+
+#undef X
+}
+
+/*
+Uses a handle from open_lua_shared and loads the functions from it.
+
+If a required function is missing the handle is closed and it returns a malloc'd error, the caller frees it.
+*/
+const char *use_lua_shared(void *handle, const char *path)
+{
+    hModule = (LIB_HANDLE)handle;
+
+    free((void *)s_foundLuaSharedPath);
+    s_foundLuaSharedPath = strdup(path);
+
+    const char *err = load_lua_shared_functions();
+    if (err != NULL)
+    {
+        clear_lua_shared_functions();
+        CLOSE_LIBRARY(hModule);
+        hModule = NULL;
+
+        free((void *)s_foundLuaSharedPath);
+        s_foundLuaSharedPath = NULL;
+    }
+
+    return err;
+}
+
 const char *unload_lua_shared()
 {
     if (hModule == NULL)
@@ -83,6 +196,7 @@ const char *unload_lua_shared()
         return "Lua shared library is not loaded";
     }
 
+    clear_lua_shared_functions();
     CLOSE_LIBRARY(hModule);
     hModule = NULL;
 
@@ -157,6 +271,7 @@ const char *get_lua_shared_path()
     }
 
 GLUA_FUNCTIONS
+GLUA_OPTIONAL_FUNCTIONS
 
 #undef CAT
 #undef SELECT
@@ -332,3 +447,12 @@ const char *lua_get_calling_file_name(lua_State L)
 
     return NULL;
 }
+
+uint64_t current_thread_id(void)
+{
+#ifdef _WIN32
+    return (uint64_t)GetCurrentThreadId();
+#else
+    return (uint64_t)pthread_self();
+#endif
+}
@@ -60,6 +60,7 @@ typedef uintptr_t lua_State;
 
 typedef LUA_NUMBER lua_Number;
 typedef int (*lua_Writer)(lua_State, const void *, size_t, void *);
+typedef const char *(*lua_Reader)(lua_State, void *, size_t *);
 
 typedef int (*lua_CFunction)(lua_State L);
 
@@ -87,16 +88,40 @@ typedef struct lua_Debug
     int i_ci; /* active function */
 } lua_Debug;
 
+/*
+** Event codes
+*/
+#define LUA_HOOKCALL 0
+#define LUA_HOOKRET 1
+#define LUA_HOOKLINE 2
+#define LUA_HOOKCOUNT 3
+#define LUA_HOOKTAILRET 4
+
+/*
+** Event masks
+*/
+#define LUA_MASKCALL (1 << LUA_HOOKCALL)
+#define LUA_MASKRET (1 << LUA_HOOKRET)
+#define LUA_MASKLINE (1 << LUA_HOOKLINE)
+#define LUA_MASKCOUNT (1 << LUA_HOOKCOUNT)
+
+typedef void (*lua_Hook)(lua_State L, lua_Debug *ar);
+
 #define X(return_type, func_name, ...)             \
     extern void *func_name##_ptr;                  \
     typedef return_type (*func_name)(__VA_ARGS__); \
     extern return_type func_name##_wrap(__VA_ARGS__);
 
 GLUA_FUNCTIONS
+GLUA_OPTIONAL_FUNCTIONS
 
 #undef X
 
-extern const char *load_lua_shared(void);
+extern const char *lua_function_at(size_t i, int *loaded);
+extern const char *missing_lua_function(size_t i);
+extern const char *lua_shared_default_path(size_t i);
+extern void *open_lua_shared(const char *path, int reuse, char **err);
+extern const char *use_lua_shared(void *handle, const char *path);
 extern const char *unload_lua_shared(void);
 extern const char *get_lua_shared_path(void);
 
@@ -114,3 +139,4 @@ extern const char *lua_check_func(lua_State, int);  // returns error instead of
 extern Result_Bool lua_check_bool(lua_State, int);
 
 extern const char *lua_get_calling_file_name(lua_State);
+extern uint64_t current_thread_id(void);
@@ -1,6 +1,7 @@
 #define GLUA_FUNCTIONS                                                                    \
     /* state manipulation */                                                              \
     X(lua_State, luaL_newstate)                                                           \
+    X(void, lua_close, lua_State)                                                         \
     X(lua_State, lua_newthread, lua_State)                                                \
     /* basic stack manipulation */                                                        \
     X(int, lua_gettop, lua_State)                                                         \
@@ -71,6 +72,20 @@
     X(int, luaL_loadstring, lua_State, const char *)                                      \
     X(int, luaL_loadfile, lua_State, const char *)                                        \
     X(const char *, luaL_findtable, lua_State, int, const char *, int)                    \
+    X(int, lua_dump, lua_State, lua_Writer, void *)                                       \
+    X(int, lua_loadx, lua_State, lua_Reader, void *, const char *, const char *)          \
+    X(int, lua_gc, lua_State, int, int)                                                   \
     /* Functions to be called by the debugger in specific events */                       \
     X(int, lua_getstack, lua_State, int, lua_Debug *)                                     \
     X(int, lua_getinfo, lua_State, const char *, lua_Debug *)
+
+// Functions that some builds of lua_shared may not export, a missing one doesn't fail loading and HasFeature
+// reports it. Their wrappers must not be called unless HasFeature returned true.
+#define GLUA_OPTIONAL_FUNCTIONS                                                           \
+    X(const char *, lua_getlocal, lua_State, const lua_Debug *, int)                      \
+    X(const char *, lua_setlocal, lua_State, const lua_Debug *, int)                      \
+    X(const char *, lua_getupvalue, lua_State, int, int)                                  \
+    X(const char *, lua_setupvalue, lua_State, int, int)                                  \
+    X(int, lua_sethook, lua_State, lua_Hook, int, int)                                    \
+    X(void, luaL_traceback, lua_State, lua_State, const char *, int)                      \
+    X(int, luaJIT_setmode, lua_State, int, int)
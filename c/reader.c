@@ -0,0 +1,15 @@
+#include "reader.h"
+#include "glua.h"
+
+extern char *goLoadReader(uintptr_t handle, size_t *size);
+
+static const char *reader(lua_State L, void *data, size_t *size)
+{
+    return goLoadReader((uintptr_t)data, size);
+}
+
+// Loads a chunk pulling its pieces from Go, the handle is passed back to Go with every read
+int load_reader(lua_State L, uintptr_t handle, const char *chunkname, const char *mode)
+{
+    return lua_loadx_wrap(L, reader, (void *)handle, chunkname, mode);
+}
@@ -0,0 +1,4 @@
+#pragma once
+#include "glua.h"
+
+extern int load_reader(lua_State L, uintptr_t handle, const char *chunkname, const char *mode);
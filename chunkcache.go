@@ -0,0 +1,215 @@
+package glua
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"sync"
+)
+
+const (
+	DefaultChunkCacheEntries = 1024
+	DefaultChunkCacheBytes   = 8 * 1024 * 1024
+)
+
+type ChunkCacheOptions struct {
+	// Maximum number of cached functions, defaults to DefaultChunkCacheEntries
+	MaxEntries int
+	// Maximum total size of the cached sources, defaults to DefaultChunkCacheBytes
+	MaxBytes int
+}
+
+type ChunkCacheStats struct {
+	Entries   int
+	Bytes     int
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+}
+
+type chunkKey struct {
+	hash [sha256.Size]byte
+	name string
+	env  uintptr // pointer of the environment table, 0 for the default one
+}
+
+type chunkEntry struct {
+	key  chunkKey
+	fn   Ref
+	env  Ref // keeps the environment alive, so its pointer can't be reused by another table
+	size int
+}
+
+// A cache of compiled chunks, so code that is run over and over (eg. generated snippets) is only compiled once.
+//
+// Functions are kept in the registry and evicted least recently used first. Caches are flushed when the module
+// is closed. A ChunkCache must only be used from the main thread.
+type ChunkCache struct {
+	opts    ChunkCacheOptions
+	entries map[chunkKey]*list.Element
+	lru     *list.List
+	stats   ChunkCacheStats
+}
+
+var (
+	chunkCachesMu sync.Mutex
+	chunkCaches   = map[*ChunkCache]struct{}{}
+)
+
+func init() {
+	OnClose("glua.chunk_caches", func(L State) error {
+		chunkCachesMu.Lock()
+		caches := make([]*ChunkCache, 0, len(chunkCaches))
+		for c := range chunkCaches {
+			caches = append(caches, c)
+		}
+		chunkCachesMu.Unlock()
+
+		for _, c := range caches {
+			c.Flush(L)
+		}
+		return nil
+	})
+}
+
+/*
+Creates a chunk cache, it's flushed every time the module is closed.
+
+# Example
+
+	var snippets = glua.NewChunkCache(glua.ChunkCacheOptions{MaxEntries: 512})
+
+	func runSnippet(L glua.State, code string) error {
+		return snippets.Run(L, code, "=snippet")
+	}
+*/
+func NewChunkCache(opts ChunkCacheOptions) *ChunkCache {
+	if opts.MaxEntries <= 0 {
+		opts.MaxEntries = DefaultChunkCacheEntries
+	}
+	if opts.MaxBytes <= 0 {
+		opts.MaxBytes = DefaultChunkCacheBytes
+	}
+
+	c := &ChunkCache{
+		opts:    opts,
+		entries: map[chunkKey]*list.Element{},
+		lru:     list.New(),
+	}
+
+	chunkCachesMu.Lock()
+	chunkCaches[c] = struct{}{}
+	chunkCachesMu.Unlock()
+
+	return c
+}
+
+/*
+Pushes the compiled function of code onto the stack, compiling it only if it's not cached.
+
+If envIdx isn't 0, the table at that index is set as the environment of the function, functions with different
+environments are cached separately.
+
+Like CompileBuffer, on failure the error message is pushed instead and nothing is cached.
+*/
+func (c *ChunkCache) Push(L State, code []byte, name string, envIdx int) error {
+	if envIdx < 0 && envIdx > LUA_REGISTRYINDEX {
+		envIdx = L.GetTop() + envIdx + 1
+	}
+
+	key := chunkKey{hash: sha256.Sum256(code), name: name}
+	if envIdx != 0 {
+		key.env = uintptr(L.GetPointer(envIdx))
+	}
+
+	if el, ok := c.entries[key]; ok {
+		entry := el.Value.(*chunkEntry)
+		if entry.fn.IsValid() {
+			c.stats.Hits++
+			c.lru.MoveToFront(el)
+			L.PushRef(entry.fn)
+			return nil
+		}
+		// from a previous module load that wasn't flushed, the refs belong to a registry that's gone
+		c.remove(L, el)
+	}
+
+	c.stats.Misses++
+
+	if err := L.CompileBuffer(code, name); err != nil {
+		return err
+	}
+
+	entry := &chunkEntry{key: key, size: len(code)}
+	if envIdx != 0 {
+		L.PushValue(envIdx)
+		L.PushValue(-1)
+		entry.env = L.NewRef()
+		L.SetFEnv(-2)
+	}
+
+	L.PushValue(-1)
+	entry.fn = L.NewRef()
+
+	// chunks bigger than the whole cache are still returned, just not kept
+	if entry.size > c.opts.MaxBytes {
+		L.FreeRef(entry.fn)
+		L.FreeRef(entry.env)
+		return nil
+	}
+
+	c.entries[key] = c.lru.PushFront(entry)
+	c.stats.Entries++
+	c.stats.Bytes += entry.size
+
+	for c.stats.Entries > c.opts.MaxEntries || c.stats.Bytes > c.opts.MaxBytes {
+		c.remove(L, c.lru.Back())
+		c.stats.Evictions++
+	}
+
+	return nil
+}
+
+/*
+Same as RunString, but the compiled chunk is cached.
+
+# Example
+
+	err := cache.Run(L, "return 1 + 1", "=snippet")
+*/
+func (c *ChunkCache) Run(L State, code string, name string) error {
+	if err := c.Push(L, []byte(code), name, 0); err != nil {
+		return err
+	}
+	return L.PCall(0, LUA_MULTRET, 0)
+}
+
+func (c *ChunkCache) remove(L State, el *list.Element) {
+	entry := c.lru.Remove(el).(*chunkEntry)
+	delete(c.entries, entry.key)
+
+	L.FreeRef(entry.fn)
+	L.FreeRef(entry.env)
+
+	c.stats.Entries--
+	c.stats.Bytes -= entry.size
+}
+
+// Removes every cached function.
+func (c *ChunkCache) Flush(L State) {
+	for c.lru.Len() > 0 {
+		c.remove(L, c.lru.Back())
+	}
+}
+
+// Flushes the cache and stops it from being flushed on close, the cache can't be used after it.
+func (c *ChunkCache) Close(L State) {
+	c.Flush(L)
+
+	chunkCachesMu.Lock()
+	delete(chunkCaches, c)
+	chunkCachesMu.Unlock()
+}
+
+func (c *ChunkCache) Stats() ChunkCacheStats {
+	return c.stats
+}
@@ -0,0 +1,119 @@
+package glua_test
+
+import (
+	"testing"
+
+	"github.com/Srlion/glua"
+	"github.com/Srlion/glua/gluatest"
+)
+
+func assertChunkStats(t *testing.T, c *glua.ChunkCache, want glua.ChunkCacheStats) {
+	t.Helper()
+	if got := c.Stats(); got != want {
+		t.Fatalf("stats = %+v, want %+v", got, want)
+	}
+}
+
+// Pushes the cached function of code and returns its first result.
+func runCached(t *testing.T, L *gluatest.State, c *glua.ChunkCache, code string, envIdx int) any {
+	t.Helper()
+
+	if err := c.Push(L.State, []byte(code), "=cached", envIdx); err != nil {
+		t.Fatal(err)
+	}
+	if err := L.PCall(0, 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer L.Pop()
+	return L.ToAny(-1)
+}
+
+func TestChunkCacheHits(t *testing.T) {
+	L := gluatest.New(t)
+	c := glua.NewChunkCache(glua.ChunkCacheOptions{})
+	defer c.Close(L.State)
+
+	code := []byte("return {}")
+	c.Push(L.State, code, "=a", 0)
+	c.Push(L.State, code, "=a", 0)
+	if !L.AreRawEqual(-1, -2) {
+		t.Fatal("a hit pushed a different function")
+	}
+	L.PopN(2)
+
+	// the name is part of the key, it shows up in errors
+	c.Push(L.State, code, "=b", 0)
+	L.Pop()
+	assertChunkStats(t, c, glua.ChunkCacheStats{Entries: 2, Bytes: 2 * len(code), Hits: 1, Misses: 2})
+
+	if err := c.Push(L.State, []byte("return ("), "=broken", 0); err == nil {
+		t.Fatal("a syntax error was cached")
+	}
+	L.Pop()
+	assertChunkStats(t, c, glua.ChunkCacheStats{Entries: 2, Bytes: 2 * len(code), Hits: 1, Misses: 3})
+
+	if err := c.Run(L.State, "cache_ran = (cache_ran or 0) + 1", "=run"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Run(L.State, "cache_ran = (cache_ran or 0) + 1", "=run"); err != nil {
+		t.Fatal(err)
+	}
+	L.AssertGlobal("cache_ran", 2)
+}
+
+func TestChunkCacheEviction(t *testing.T) {
+	L := gluatest.New(t)
+	c := glua.NewChunkCache(glua.ChunkCacheOptions{MaxEntries: 2, MaxBytes: 20})
+	defer c.Close(L.State)
+
+	runCached(t, L, c, "return 'a'", 0)
+	runCached(t, L, c, "return 'b'", 0)
+	runCached(t, L, c, "return 'a'", 0) // a is now the most recently used
+	runCached(t, L, c, "return 'c'", 0) // evicts b
+	assertChunkStats(t, c, glua.ChunkCacheStats{Entries: 2, Bytes: 20, Hits: 1, Misses: 3, Evictions: 1})
+
+	runCached(t, L, c, "return 'a'", 0)
+	runCached(t, L, c, "return 'b'", 0) // evicts c
+	assertChunkStats(t, c, glua.ChunkCacheStats{Entries: 2, Bytes: 20, Hits: 2, Misses: 4, Evictions: 2})
+
+	// evicts the least recently used entries until the sources fit again
+	runCached(t, L, c, "return 'bigger'", 0)
+	assertChunkStats(t, c, glua.ChunkCacheStats{Entries: 1, Bytes: 15, Hits: 2, Misses: 5, Evictions: 4})
+
+	// bigger than the whole cache, returned but not kept
+	if got := runCached(t, L, c, "return 'much too big'", 0); got != "much too big" {
+		t.Fatalf("got %v", got)
+	}
+	assertChunkStats(t, c, glua.ChunkCacheStats{Entries: 1, Bytes: 15, Hits: 2, Misses: 6, Evictions: 4})
+}
+
+func TestChunkCacheEnvironments(t *testing.T) {
+	L := gluatest.New(t)
+	c := glua.NewChunkCache(glua.ChunkCacheOptions{})
+	defer c.Close(L.State)
+
+	L.Eval("env1, env2 = {x = 1}, {x = 2}")
+	L.GetGlobal("env1")
+	L.GetGlobal("env2")
+
+	L.AssertEqual(runCached(t, L, c, "return x", -2), 1)
+	L.AssertEqual(runCached(t, L, c, "return x", -1), 2)
+	L.AssertEqual(runCached(t, L, c, "return x", 1), 1)
+	L.AssertEqual(runCached(t, L, c, "return x", 0), nil)
+	assertChunkStats(t, c, glua.ChunkCacheStats{Entries: 3, Bytes: 3 * len("return x"), Hits: 1, Misses: 3})
+	L.PopN(2)
+}
+
+func TestChunkCacheFlushedOnClose(t *testing.T) {
+	L := gluatest.New(t)
+	c := glua.NewChunkCache(glua.ChunkCacheOptions{})
+	defer c.Close(L.State)
+
+	runCached(t, L, c, "return 1", 0)
+	L.Reopen()
+	assertChunkStats(t, c, glua.ChunkCacheStats{Hits: 0, Misses: 1})
+
+	// compiled again in the new module load
+	runCached(t, L, c, "return 1", 0)
+	assertChunkStats(t, c, glua.ChunkCacheStats{Entries: 1, Bytes: len("return 1"), Misses: 2})
+}
@@ -0,0 +1,221 @@
+package glua
+
+import (
+	"fmt"
+	"reflect"
+	"runtime/cgo"
+	"strings"
+)
+
+// Classes are Go values (usually pointers) pushed as handle backed userdata with a shared metatable.
+//
+// Operator metamethods are derived from the methods of T, so a type only has to implement them in Go:
+//
+//	String() string        __tostring
+//	Equal(T) bool          __eq
+//	Len() int              __len
+//	Less(T) bool           __lt, and __le as !(b < a) unless LessOrEqual exists
+//	LessOrEqual(T) bool    __le
+//	Add/Sub/Mul/Div/Mod/Pow(T) T and Unm() T    __add, __sub, __mul, __div, __mod, __pow, __unm
+//	Call(L State) int      __call, the arguments start at 2 (1 is the object)
+//
+// Metamethods given explicitly to RegisterClass take priority over derived ones.
+
+type Class[T any] struct {
+	name string
+}
+
+/*
+Registers T as a class with the given metatable name, its metatable is created every time the module is opened.
+
+Methods whose name starts with "__" are set on the metatable, the others are looked up through __index. __gc frees
+the handle (and external size) of the userdata unless it's given.
+
+# Example
+
+	type Money struct{ Cents int64 }
+
+	func (m *Money) String() string        { return fmt.Sprintf("$%d.%02d", m.Cents/100, m.Cents%100) }
+	func (m *Money) Add(o *Money) *Money   { return &Money{m.Cents + o.Cents} }
+	func (m *Money) Less(o *Money) bool    { return m.Cents < o.Cents }
+
+	var MoneyClass *glua.Class[*Money]
+
+	func init() {
+		MoneyClass = glua.RegisterClass[*Money]("Money", map[string]glua.GoFunc{
+			"Cents": func(L glua.State) int {
+				L.PushNumber(MoneyClass.Check(L, 1).Cents)
+				return 1
+			},
+		})
+	}
+
+	-- lua, with __tostring, __add, __lt and __le derived
+	print(a + b, a < b)
+*/
+func RegisterClass[T any](name string, methods map[string]GoFunc) *Class[T] {
+	c := &Class[T]{name: name}
+
+	addStubClass(name, reflect.TypeFor[T](), methods, c.derivedMetamethods())
+
+	OnOpen("class:"+name, func(L State) error {
+		if !L.NewMetaTable(name) {
+			L.Pop()
+			return fmt.Errorf("metatable %s already exists", name)
+		}
+
+		SetDerivedMetamethods[T](L, -1, name)
+
+		L.NewTable()
+		for method, fn := range methods {
+			L.PushGoFunc(fn)
+			if strings.HasPrefix(method, "__") {
+				L.SetField(-3, method)
+			} else {
+				L.SetField(-2, method)
+			}
+		}
+		L.SetField(-2, "__index")
+
+		L.Pop()
+		return nil
+	})
+
+	return c
+}
+
+// Returns the metatable name of the class.
+func (c *Class[T]) Name() string {
+	return c.name
+}
+
+// Pushes v as a userdata of the class.
+func (c *Class[T]) Push(L State, v T) cgo.Handle {
+	return L.NewUserData(v, &c.name)
+}
+
+// Returns the value of the userdata at the given argument, raising an error if it isn't of the class.
+func (c *Class[T]) Check(L State, arg int) T {
+	return L.GetUserData(arg, &c.name).Value().(T)
+}
+
+/*
+Sets the metamethods derived from the methods of T (see Class) on the table at the given index, for metatables
+created by hand with NewMetaTable. metatable is the name the userdata are created with in NewUserData.
+
+# Example
+
+	if L.NewMetaTable("Money") {
+		glua.SetDerivedMetamethods[*Money](L, -1, "Money")
+		// methods, __index...
+	}
+*/
+func SetDerivedMetamethods[T any](L State, idx int, metatable string) {
+	idx = absIndex(L, idx)
+
+	c := &Class[T]{name: metatable}
+	for method, fn := range c.derivedMetamethods() {
+		L.PushGoFunc(fn)
+		L.SetField(idx, method)
+	}
+}
+
+func (c *Class[T]) derivedMetamethods() map[string]GoFunc {
+	t := reflect.TypeFor[T]()
+	implements := t.Implements
+
+	mm := map[string]GoFunc{
+		"__gc": func(L State) int {
+			L.FreeUserData(1)
+			return 0
+		},
+	}
+
+	if implements(reflect.TypeFor[fmt.Stringer]()) {
+		mm["__tostring"] = func(L State) int {
+			L.PushString(any(c.Check(L, 1)).(fmt.Stringer).String())
+			return 1
+		}
+	}
+
+	if implements(reflect.TypeFor[interface{ Equal(T) bool }]()) {
+		mm["__eq"] = func(L State) int {
+			a, b := c.Check(L, 1), c.Check(L, 2)
+			L.PushBool(any(a).(interface{ Equal(T) bool }).Equal(b))
+			return 1
+		}
+	}
+
+	if implements(reflect.TypeFor[interface{ Len() int }]()) {
+		mm["__len"] = func(L State) int {
+			L.PushNumber(any(c.Check(L, 1)).(interface{ Len() int }).Len())
+			return 1
+		}
+	}
+
+	if implements(reflect.TypeFor[interface{ Less(T) bool }]()) {
+		less := func(a, b T) bool {
+			return any(a).(interface{ Less(T) bool }).Less(b)
+		}
+		mm["__lt"] = func(L State) int {
+			L.PushBool(less(c.Check(L, 1), c.Check(L, 2)))
+			return 1
+		}
+		mm["__le"] = func(L State) int {
+			L.PushBool(!less(c.Check(L, 2), c.Check(L, 1)))
+			return 1
+		}
+	}
+
+	if implements(reflect.TypeFor[interface{ LessOrEqual(T) bool }]()) {
+		mm["__le"] = func(L State) int {
+			a, b := c.Check(L, 1), c.Check(L, 2)
+			L.PushBool(any(a).(interface{ LessOrEqual(T) bool }).LessOrEqual(b))
+			return 1
+		}
+	}
+
+	arith := func(event string, iface reflect.Type, op func(a, b T) T) {
+		if !implements(iface) {
+			return
+		}
+		mm[event] = func(L State) int {
+			c.Push(L, op(c.Check(L, 1), c.Check(L, 2)))
+			return 1
+		}
+	}
+
+	arith("__add", reflect.TypeFor[interface{ Add(T) T }](), func(a, b T) T {
+		return any(a).(interface{ Add(T) T }).Add(b)
+	})
+	arith("__sub", reflect.TypeFor[interface{ Sub(T) T }](), func(a, b T) T {
+		return any(a).(interface{ Sub(T) T }).Sub(b)
+	})
+	arith("__mul", reflect.TypeFor[interface{ Mul(T) T }](), func(a, b T) T {
+		return any(a).(interface{ Mul(T) T }).Mul(b)
+	})
+	arith("__div", reflect.TypeFor[interface{ Div(T) T }](), func(a, b T) T {
+		return any(a).(interface{ Div(T) T }).Div(b)
+	})
+	arith("__mod", reflect.TypeFor[interface{ Mod(T) T }](), func(a, b T) T {
+		return any(a).(interface{ Mod(T) T }).Mod(b)
+	})
+	arith("__pow", reflect.TypeFor[interface{ Pow(T) T }](), func(a, b T) T {
+		return any(a).(interface{ Pow(T) T }).Pow(b)
+	})
+
+	if implements(reflect.TypeFor[interface{ Unm() T }]()) {
+		mm["__unm"] = func(L State) int {
+			c.Push(L, any(c.Check(L, 1)).(interface{ Unm() T }).Unm())
+			return 1
+		}
+	}
+
+	if implements(reflect.TypeFor[interface{ Call(State) int }]()) {
+		mm["__call"] = func(L State) int {
+			return any(c.Check(L, 1)).(interface{ Call(State) int }).Call(L)
+		}
+	}
+
+	return mm
+}
@@ -0,0 +1,116 @@
+package glua_test
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/Srlion/glua"
+	"github.com/Srlion/glua/gluatest"
+)
+
+// Implements every interface a metamethod is derived from, except LessOrEqual.
+type classNum struct{ n float64 }
+
+func (a *classNum) String() string            { return fmt.Sprintf("num(%g)", a.n) }
+func (a *classNum) Equal(b *classNum) bool    { return a.n == b.n }
+func (a *classNum) Len() int                  { return int(a.n) }
+func (a *classNum) Less(b *classNum) bool     { return a.n < b.n }
+func (a *classNum) Add(b *classNum) *classNum { return &classNum{a.n + b.n} }
+func (a *classNum) Sub(b *classNum) *classNum { return &classNum{a.n - b.n} }
+func (a *classNum) Mul(b *classNum) *classNum { return &classNum{a.n * b.n} }
+func (a *classNum) Div(b *classNum) *classNum { return &classNum{a.n / b.n} }
+func (a *classNum) Mod(b *classNum) *classNum { return &classNum{math.Mod(a.n, b.n)} }
+func (a *classNum) Pow(b *classNum) *classNum { return &classNum{math.Pow(a.n, b.n)} }
+func (a *classNum) Unm() *classNum            { return &classNum{-a.n} }
+
+func (a *classNum) Call(L glua.State) int {
+	L.PushNumber(a.n + float64(L.CheckNumber(2)))
+	return 1
+}
+
+// Versions that count as equal within one, so __le is visibly LessOrEqual and not derived from Less.
+type classVersion struct{ v int }
+
+func (a *classVersion) Less(b *classVersion) bool        { return a.v < b.v }
+func (a *classVersion) LessOrEqual(b *classVersion) bool { return a.v <= b.v+1 }
+
+var (
+	classNumClass     *glua.Class[*classNum]
+	classVersionClass *glua.Class[*classVersion]
+)
+
+func init() {
+	classNumClass = glua.RegisterClass[*classNum]("ClassNum", map[string]glua.GoFunc{
+		"Value": func(L glua.State) int {
+			L.PushNumber(classNumClass.Check(L, 1).n)
+			return 1
+		},
+		// explicit metamethods take priority over derived ones
+		"__concat": func(L glua.State) int {
+			L.PushString("concat")
+			return 1
+		},
+	})
+	classVersionClass = glua.RegisterClass[*classVersion]("ClassVersion", nil)
+}
+
+func TestClassDerivedMetamethods(t *testing.T) {
+	L := gluatest.New(t)
+
+	L.PushGoFunc(func(L glua.State) int {
+		classNumClass.Push(L, &classNum{float64(L.CheckNumber(1))})
+		return 1
+	})
+	L.SetGlobal("num")
+	L.PushGoFunc(func(L glua.State) int {
+		classVersionClass.Push(L, &classVersion{int(L.CheckNumber(1))})
+		return 1
+	})
+	L.SetGlobal("version")
+
+	L.Eval(`a, b = num(7), num(2)`)
+
+	L.AssertGlobal("tostring(a)", "num(7)")
+	L.AssertGlobal("a:Value()", 7)
+	L.AssertGlobal("#a", 7)
+
+	L.AssertGlobal("a == num(7)", true)
+	L.AssertGlobal("a == b", false)
+	L.AssertGlobal("a ~= b", true)
+
+	L.AssertGlobal("b < a", true)
+	L.AssertGlobal("a < b", false)
+	// without LessOrEqual, a <= b is not (b < a)
+	L.AssertGlobal("b <= a", true)
+	L.AssertGlobal("a <= num(7)", true)
+	L.AssertGlobal("a <= b", false)
+
+	for expr, want := range map[string]float64{
+		"a + b": 9,
+		"a - b": 5,
+		"a * b": 14,
+		"a / b": 3.5,
+		"a % b": 1,
+		"a ^ b": 49,
+		"-a":    -7,
+	} {
+		L.AssertGlobal("("+expr+"):Value()", want)
+	}
+	L.AssertGlobal("tostring(a + b - b)", "num(7)")
+
+	L.AssertGlobal("a(3)", 10)
+	L.AssertGlobal("a .. b", "concat")
+
+	// operands of another class raise an error instead of being misread
+	L.AssertError("return a + version(1)", "ClassNum")
+
+	L.Eval(`v1, v2 = version(1), version(2)`)
+	L.AssertGlobal("v1 < v2", true)
+	L.AssertGlobal("v2 < v1", false)
+	L.AssertGlobal("v2 <= v1", true)
+	L.AssertGlobal("version(3) <= v1", false)
+	// nothing else is derived
+	L.AssertError("return v1 + v2", "attempt to perform arithmetic")
+	L.AssertError("return #v1", "attempt to get length")
+}
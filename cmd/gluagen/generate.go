@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strconv"
+	"strings"
+)
+
+type writer struct {
+	bytes.Buffer
+}
+
+func (w *writer) line(format string, args ...any) {
+	fmt.Fprintf(&w.Buffer, format, args...)
+	w.WriteByte('\n')
+}
+
+// Generates the source of the bindings file.
+func generate(pkg *packageDecl, lib string) ([]byte, error) {
+	var w writer
+
+	w.line("// Code generated by gluagen. DO NOT EDIT.")
+	w.line("")
+	w.line("package %s", pkg.name)
+	w.line("")
+	w.line("import %q", gluaImportPath)
+	w.line("")
+
+	// the method maps are filled in init, the wrappers use the class variables so they can't be in their
+	// initializers without an initialization cycle
+	if len(pkg.classes) > 0 {
+		w.line("var (")
+		for _, c := range pkg.classes {
+			w.line("%s = map[string]glua.GoFunc{}", methodsVar(c))
+			w.line("%s = glua.RegisterClass[*%s](%q, %s)", classVar(c), c.goName, c.luaName, methodsVar(c))
+		}
+		w.line(")")
+		w.line("")
+	}
+
+	w.line("func init() {")
+	for _, it := range pkg.interfaces {
+		w.line("glua.RegisterAdapter(func(o *glua.LuaObject) %s { return %s{o} })", it.goName, adapterType(it))
+	}
+	if len(pkg.funcs) > 0 {
+		w.line("glua.Library(%q, map[string]any{", lib)
+		for _, fn := range pkg.funcs {
+			w.line("%q: glua.GoFunc(%s),", fn.luaName, funcWrapper(fn))
+		}
+		w.line("})")
+	}
+	for _, c := range pkg.classes {
+		for _, m := range c.methods {
+			w.line("%s[%q] = %s", methodsVar(c), m.luaName, methodWrapper(c, m))
+		}
+	}
+	w.line("}")
+
+	for _, fn := range pkg.funcs {
+		w.line("")
+		writeWrapper(&w, funcWrapper(fn), fn, nil)
+	}
+	for _, c := range pkg.classes {
+		for _, m := range c.methods {
+			w.line("")
+			writeWrapper(&w, methodWrapper(c, m), m, c)
+		}
+	}
+
+	for _, it := range pkg.interfaces {
+		w.line("")
+		writeAdapter(&w, it)
+	}
+
+	src, err := format.Source(w.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting generated code: %w\n%s", err, w.String())
+	}
+	return src, nil
+}
+
+func writeWrapper(w *writer, name string, fn *funcDecl, class *classDecl) {
+	w.line("func %s(L glua.State) int {", name)
+
+	arg := 1
+	callee := fn.goName
+	if class != nil {
+		w.line("self := %s.Check(L, 1)", classVar(class))
+		callee = "self." + fn.goName
+		arg++
+	}
+
+	args := make([]string, len(fn.params))
+	for i, p := range fn.params {
+		if p.typ.kind == kindState {
+			args[i] = "L"
+			continue
+		}
+		v := "p" + strconv.Itoa(i)
+		w.line("%s := %s", v, checkExpr(p.typ, arg))
+		args[i] = v
+		arg++
+	}
+
+	var results []string
+	for i := range fn.results {
+		results = append(results, "r"+strconv.Itoa(i))
+	}
+	if fn.errLast {
+		results = append(results, "err")
+	}
+
+	call := callee + "(" + strings.Join(args, ", ") + ")"
+	if len(results) > 0 {
+		w.line("%s := %s", strings.Join(results, ", "), call)
+	} else {
+		w.line("%s", call)
+	}
+
+	if fn.errLast {
+		w.line("if err != nil {")
+		w.line("panic(err.Error())")
+		w.line("}")
+	}
+
+	for i, r := range fn.results {
+		writePush(w, r.typ, results[i])
+	}
+
+	w.line("return %d", len(fn.results))
+	w.line("}")
+}
+
+// Writes the type implementing the interface with a Lua table, every method calls the function with the same name
+// on the table. Methods with an error result return the Lua errors, the others panic with them (which is a Lua error
+// if the method was called from a GoFunc).
+func writeAdapter(w *writer, it *interfaceDecl) {
+	name := adapterType(it)
+
+	w.line("type %s struct{ o *glua.LuaObject }", name)
+
+	for _, m := range it.methods {
+		w.line("")
+
+		params := make([]string, len(m.params))
+		args := []string{strconv.Quote(m.goName)}
+		for i, p := range m.params {
+			v := "p" + strconv.Itoa(i)
+			params[i] = v + " " + p.typ.expr
+			args = append(args, v)
+		}
+
+		var types, results []string
+		for i, r := range m.results {
+			types = append(types, r.typ.expr)
+			results = append(results, "r"+strconv.Itoa(i))
+		}
+		if m.errLast {
+			types = append(types, "error")
+		}
+
+		signature := "func (a " + name + ") " + m.goName + "(" + strings.Join(params, ", ") + ")"
+		switch {
+		case len(types) == 1:
+			signature += " " + types[0]
+		case len(types) > 1:
+			signature += " (" + strings.Join(types, ", ") + ")"
+		}
+		w.line("%s {", signature)
+
+		fail := "panic(err)"
+		if m.errLast {
+			fail = "return " + strings.Join(append(append([]string{}, results...), "err"), ", ")
+		}
+
+		for i, r := range m.results {
+			w.line("var %s %s", results[i], r.typ.expr)
+		}
+
+		call := "a.o.Call(" + strings.Join(args, ", ") + ")"
+		if len(m.results) == 0 {
+			w.line("if _, err := %s; err != nil {", call)
+			w.line("%s", fail)
+			w.line("}")
+		} else {
+			w.line("res, err := %s", call)
+			w.line("if err != nil {")
+			w.line("%s", fail)
+			w.line("}")
+			for i, r := range m.results {
+				w.line("if %s, err = glua.ResultAs[%s](res, %d); err != nil {", results[i], r.typ.expr, i)
+				w.line("%s", fail)
+				w.line("}")
+			}
+		}
+
+		if m.errLast {
+			w.line("return %s", strings.Join(append(results, "nil"), ", "))
+		} else if len(results) > 0 {
+			w.line("return %s", strings.Join(results, ", "))
+		}
+		w.line("}")
+	}
+}
+
+func checkExpr(t goType, arg int) string {
+	switch t.kind {
+	case kindNumber:
+		return fmt.Sprintf("%s(L.CheckNumber(%d))", t.expr, arg)
+	case kindString:
+		return fmt.Sprintf("L.CheckString(%d)", arg)
+	case kindBool:
+		return fmt.Sprintf("L.CheckBool(%d)", arg)
+	case kindBytes:
+		return fmt.Sprintf("L.CheckBinaryString(%d)", arg)
+	case kindLuaObject:
+		return fmt.Sprintf("L.NewLuaObject(%d)", arg)
+	case kindClass:
+		if t.ptr {
+			return fmt.Sprintf("%s.Check(L, %d)", classVar(t.class), arg)
+		}
+		return fmt.Sprintf("*%s.Check(L, %d)", classVar(t.class), arg)
+	}
+	panic("unreachable")
+}
+
+func writePush(w *writer, t goType, v string) {
+	switch t.kind {
+	case kindNumber:
+		w.line("L.PushNumber(%s)", v)
+	case kindString:
+		w.line("L.PushString(%s)", v)
+	case kindBool:
+		w.line("L.PushBool(%s)", v)
+	case kindBytes:
+		w.line("L.PushBinaryString(%s)", v)
+	case kindClass:
+		if !t.ptr {
+			w.line("%s.Push(L, &%s)", classVar(t.class), v)
+			return
+		}
+		w.line("if %s == nil {", v)
+		w.line("L.PushNil()")
+		w.line("} else {")
+		w.line("%s.Push(L, %s)", classVar(t.class), v)
+		w.line("}")
+	default:
+		panic("unreachable")
+	}
+}
+
+func adapterType(it *interfaceDecl) string {
+	return "gluaAdapter" + it.goName
+}
+
+func classVar(c *classDecl) string {
+	return "gluaClass" + c.goName
+}
+
+func methodsVar(c *classDecl) string {
+	return "gluaMethods" + c.goName
+}
+
+func funcWrapper(fn *funcDecl) string {
+	return "gluagen_" + fn.goName
+}
+
+func methodWrapper(c *classDecl, m *funcDecl) string {
+	return "gluagen_" + c.goName + "_" + m.goName
+}
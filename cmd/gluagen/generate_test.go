@@ -0,0 +1,211 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func parseSource(t *testing.T, src string) (*packageDecl, error) {
+	t.Helper()
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "src.go"), []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return parsePackage(dir, filepath.Join(dir, "glua_gen.go"))
+}
+
+func TestGenerateAdapter(t *testing.T) {
+	pkg, err := parseSource(t, `package handlers
+
+import "github.com/Srlion/glua"
+
+// Handles messages.
+//
+//glua:interface
+type Handler interface {
+	Name() string
+	Handle(msg string, ctx *glua.LuaObject) error
+	Size() (w, h int)
+}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := generate(pkg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := string(src)
+
+	for _, want := range []string{
+		`glua.RegisterAdapter(func(o *glua.LuaObject) Handler { return gluaAdapterHandler{o} })`,
+		`func (a gluaAdapterHandler) Name() string {`,
+		`func (a gluaAdapterHandler) Handle(p0 string, p1 *glua.LuaObject) error {`,
+		`func (a gluaAdapterHandler) Size() (int, int) {`,
+		`if r1, err = glua.ResultAs[int](res, 1); err != nil {`,
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated code is missing %q:\n%s", want, code)
+		}
+	}
+
+	stubs := string(generateStubs(pkg, ""))
+	for _, want := range []string{
+		"---@class Handler",
+		"---@field Handle fun(self, msg: string, ctx: any)",
+		"---@field Size fun(self): integer, integer",
+	} {
+		if !strings.Contains(stubs, want) {
+			t.Errorf("stubs are missing %q:\n%s", want, stubs)
+		}
+	}
+}
+
+func TestInterfaceRejectsClasses(t *testing.T) {
+	_, err := parseSource(t, `package handlers
+
+//glua:class
+type Player struct{}
+
+//glua:interface
+type Spawner interface {
+	Spawn() *Player
+}
+`)
+	if err == nil || !strings.Contains(err.Error(), "can't be returned from Lua") {
+		t.Fatalf("parsePackage = %v, want an unsupported result error", err)
+	}
+}
+
+func TestGenerateFunctions(t *testing.T) {
+	pkg, err := parseSource(t, `package mymod
+
+import lua "github.com/Srlion/glua"
+
+//glua:export greet
+func Greet(L lua.State, name string, times int, loud bool) string { return "" }
+
+//glua:export
+func Parse(data []byte, L lua.State, strict bool) (n int, ok bool, err error) { return 0, false, nil }
+
+//glua:export
+func Fail() error { return nil }
+
+func notExported(x int) {}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := generate(pkg, "mymod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := string(src)
+
+	for _, want := range []string{
+		`glua.Library("mymod", map[string]any{`,
+		`"greet": glua.GoFunc(gluagen_Greet),`,
+		`"Parse": glua.GoFunc(gluagen_Parse),`,
+		// State parameters don't take a Lua argument
+		`p1 := L.CheckString(1)`,
+		`p2 := int(L.CheckNumber(2))`,
+		`p3 := L.CheckBool(3)`,
+		`r0 := Greet(L, p1, p2, p3)`,
+		`p0 := L.CheckBinaryString(1)`,
+		`p2 := L.CheckBool(2)`,
+		// a trailing error is raised instead of returned
+		`r0, r1, err := Parse(p0, L, p2)`,
+		"if err != nil {\n\t\tpanic(err.Error())\n\t}\n\tL.PushNumber(r0)\n\tL.PushBool(r1)\n\treturn 2",
+		"err := Fail()\n\tif err != nil {\n\t\tpanic(err.Error())\n\t}\n\treturn 0",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated code is missing %q:\n%s", want, code)
+		}
+	}
+	if strings.Contains(code, "notExported") {
+		t.Errorf("generated code wraps an unmarked function:\n%s", code)
+	}
+}
+
+func TestGenerateClasses(t *testing.T) {
+	pkg, err := parseSource(t, `package mymod
+
+import "github.com/Srlion/glua"
+
+// Money in cents.
+//
+//glua:class
+type Money struct{ Cents int64 }
+
+//glua:export add
+func (m *Money) Plus(o *Money) *Money { return nil }
+
+func (m *Money) Scaled(L glua.State, f float64) Money { return Money{} }
+
+func (m Money) Same(o Money) (bool, error) { return false, nil }
+
+//glua:skip
+func (m *Money) Channel() chan int { return nil }
+
+func (m *Money) private() {}
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pkg.classes) != 1 {
+		t.Fatalf("got %d classes, want 1", len(pkg.classes))
+	}
+	var names []string
+	for _, m := range pkg.classes[0].methods {
+		names = append(names, m.luaName)
+	}
+	if got, want := strings.Join(names, ","), "add,Scaled,Same"; got != want {
+		t.Fatalf("methods = %s, want %s", got, want)
+	}
+
+	src, err := generate(pkg, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := string(src)
+
+	for _, want := range []string{
+		`gluaClassMoney   = glua.RegisterClass[*Money]("Money", gluaMethodsMoney)`,
+		`gluaMethodsMoney["add"] = gluagen_Money_Plus`,
+		// the receiver is argument 1
+		"self := gluaClassMoney.Check(L, 1)\n\tp0 := gluaClassMoney.Check(L, 2)\n\tr0 := self.Plus(p0)",
+		// *T results can be nil, T results are pushed by address
+		"if r0 == nil {\n\t\tL.PushNil()\n\t} else {\n\t\tgluaClassMoney.Push(L, r0)\n\t}",
+		"p1 := float64(L.CheckNumber(2))\n\tr0 := self.Scaled(L, p1)\n\tgluaClassMoney.Push(L, &r0)",
+		// T parameters are copied out of the userdata
+		"p0 := *gluaClassMoney.Check(L, 2)\n\tr0, err := self.Same(p0)",
+	} {
+		if !strings.Contains(code, want) {
+			t.Errorf("generated code is missing %q:\n%s", want, code)
+		}
+	}
+	for _, unwanted := range []string{"Channel", "private"} {
+		if strings.Contains(code, unwanted) {
+			t.Errorf("generated code wraps %s:\n%s", unwanted, code)
+		}
+	}
+}
+
+func TestUnmarkedUnsupportedMethod(t *testing.T) {
+	_, err := parseSource(t, `package mymod
+
+//glua:class
+type Money struct{}
+
+func (m *Money) Channel() chan int { return nil }
+`)
+	if err == nil || !strings.Contains(err.Error(), "mark it with //glua:skip") {
+		t.Fatalf("parsePackage = %v, want an error suggesting //glua:skip", err)
+	}
+}
@@ -0,0 +1,98 @@
+// gluagen generates GoFunc wrappers for annotated Go functions and types, so bindings call Check*/Push* directly
+// instead of going through reflection like glua.Bind.
+//
+// Functions marked with //glua:export are registered in the library given with -lib, types marked with
+// //glua:class are registered with glua.RegisterClass and get a wrapper for every exported method (methods marked
+// with //glua:skip are left out). Both annotations take an optional Lua name.
+//
+//	//go:generate go run github.com/Srlion/glua/cmd/gluagen -lib mymod
+//
+//	//glua:export add
+//	func Add(a, b int) int { return a + b }
+//
+//	//glua:class Player
+//	type Player struct{ name string }
+//
+//	func (p *Player) Name() string { return p.name }
+//
+// Supported parameter and result types are numbers, string, bool, []byte, annotated classes (T or *T), glua.State
+// (passed through, it doesn't take a Lua argument), *glua.LuaObject (parameters only) and a trailing error result,
+// which raises a Lua error. The class of T is in the variable gluaClassT, use it to push values from Go:
+//
+//	gluaClassPlayer.Push(L, player)
+//
+// Interfaces marked with //glua:interface get an adapter registered with glua.RegisterAdapter, so glua.Implement
+// (and Go functions bound with reflection) accept any Lua table with the methods of the interface. Arguments are
+// pushed with PushAny and results converted with glua.ResultAs, classes and glua.State aren't supported there. If
+// the Lua call fails, methods ending with an error result return it and the others panic.
+//
+//	//glua:interface
+//	type Handler interface {
+//		Name() string
+//		Handle(msg string) error
+//	}
+//
+// With -stubs, a LuaLS `---@meta` file describing the bindings (with their parameter names and doc comments) is
+// written too, for editor autocomplete:
+//
+//	//go:generate go run github.com/Srlion/glua/cmd/gluagen -lib mymod -stubs ../lua/types/mymod.lua
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+func main() {
+	dir := flag.String("dir", ".", "directory of the package to generate bindings for")
+	lib := flag.String("lib", "", "library the exported functions are registered in, eg. mymod.util")
+	out := flag.String("o", "glua_gen.go", "output file, relative to -dir")
+	stubs := flag.String("stubs", "", "also write LuaLS stubs to this file, relative to -dir")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: gluagen [-lib name] [-dir dir] [-o file] [-stubs file]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := run(*dir, *lib, *out, *stubs); err != nil {
+		fmt.Fprintln(os.Stderr, "gluagen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(dir, lib, out, stubs string) error {
+	if !filepath.IsAbs(out) {
+		out = filepath.Join(dir, out)
+	}
+	if stubs != "" && !filepath.IsAbs(stubs) {
+		stubs = filepath.Join(dir, stubs)
+	}
+
+	pkg, err := parsePackage(dir, out)
+	if err != nil {
+		return err
+	}
+
+	if len(pkg.funcs) == 0 && len(pkg.classes) == 0 && len(pkg.interfaces) == 0 {
+		return fmt.Errorf("nothing in %s is annotated with //glua:export, //glua:class or //glua:interface", dir)
+	}
+	if len(pkg.funcs) > 0 && lib == "" {
+		return fmt.Errorf("-lib is required to register exported functions")
+	}
+
+	src, err := generate(pkg, lib)
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(out, src, 0o644); err != nil {
+		return err
+	}
+
+	if stubs != "" {
+		return os.WriteFile(stubs, generateStubs(pkg, lib), 0o644)
+	}
+	return nil
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const gluaImportPath = "github.com/Srlion/glua"
+
+const (
+	exportDirective    = "//glua:export"
+	classDirective     = "//glua:class"
+	skipDirective      = "//glua:skip"
+	interfaceDirective = "//glua:interface"
+)
+
+type typeKind int
+
+const (
+	kindNumber typeKind = iota
+	kindString
+	kindBool
+	kindBytes
+	kindState
+	kindLuaObject
+	kindClass
+)
+
+type goType struct {
+	kind  typeKind
+	expr  string     // the type as written in the generated file
+	class *classDecl // kindClass
+	ptr   bool       // kindClass: *T instead of T
+}
+
+type param struct {
+	name string
+	typ  goType
+}
+
+type funcDecl struct {
+	goName  string
+	luaName string
+	doc     string
+	params  []param
+	results []param
+	errLast bool // the last result is an error, it's not in results
+	pos     token.Position
+}
+
+type classDecl struct {
+	goName  string
+	luaName string
+	doc     string
+	methods []*funcDecl
+	pos     token.Position
+}
+
+// An interface implemented by Lua tables, its methods keep their Go names in Lua.
+type interfaceDecl struct {
+	goName  string
+	doc     string
+	methods []*funcDecl
+	pos     token.Position
+}
+
+type packageDecl struct {
+	name       string
+	funcs      []*funcDecl
+	classes    []*classDecl
+	interfaces []*interfaceDecl
+}
+
+// Parses the package in dir (skipping tests, files excluded by build constraints and the output file) and
+// returns the annotated functions, classes and interfaces.
+func parsePackage(dir, out string) (*packageDecl, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	outAbs, _ := filepath.Abs(out)
+
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		if path, _ := filepath.Abs(filepath.Join(dir, name)); path == outAbs {
+			continue
+		}
+		if ok, err := build.Default.MatchFile(dir, name); err != nil || !ok {
+			continue
+		}
+
+		f, err := parser.ParseFile(fset, filepath.Join(dir, name), nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no Go files in %s", dir)
+	}
+
+	pkg := &packageDecl{name: files[0].Name.Name}
+	classes := map[string]*classDecl{}
+
+	var interfaces []*ast.TypeSpec
+	docs := map[*ast.TypeSpec]*ast.CommentGroup{}
+	gluaNames := map[*ast.TypeSpec]string{}
+
+	for _, f := range files {
+		for _, decl := range f.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				ts := spec.(*ast.TypeSpec)
+				doc := ts.Doc
+				if doc == nil && len(gen.Specs) == 1 {
+					doc = gen.Doc
+				}
+
+				if _, ok := directive(doc, interfaceDirective); ok {
+					interfaces = append(interfaces, ts)
+					docs[ts] = doc
+					gluaNames[ts] = gluaImportName(f)
+					continue
+				}
+
+				luaName, ok := directive(doc, classDirective)
+				if !ok {
+					continue
+				}
+				if luaName == "" {
+					luaName = ts.Name.Name
+				}
+
+				c := &classDecl{
+					goName:  ts.Name.Name,
+					luaName: luaName,
+					doc:     doc.Text(),
+					pos:     fset.Position(ts.Pos()),
+				}
+				classes[c.goName] = c
+				pkg.classes = append(pkg.classes, c)
+			}
+		}
+	}
+
+	for _, f := range files {
+		gluaName := gluaImportName(f)
+
+		for _, decl := range f.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if !ok {
+				continue
+			}
+
+			if fn.Recv == nil {
+				luaName, ok := directive(fn.Doc, exportDirective)
+				if !ok {
+					continue
+				}
+
+				d, err := parseFunc(fset, fn, luaName, gluaName, classes)
+				if err != nil {
+					return nil, err
+				}
+				pkg.funcs = append(pkg.funcs, d)
+				continue
+			}
+
+			class := classes[receiverName(fn.Recv)]
+			if class == nil || !fn.Name.IsExported() {
+				continue
+			}
+			if _, skip := directive(fn.Doc, skipDirective); skip {
+				continue
+			}
+
+			luaName, _ := directive(fn.Doc, exportDirective)
+			d, err := parseFunc(fset, fn, luaName, gluaName, classes)
+			if err != nil {
+				return nil, fmt.Errorf("%w (mark it with %s to leave it out)", err, skipDirective)
+			}
+			class.methods = append(class.methods, d)
+		}
+	}
+
+	// after the classes are known, so their use is reported as unsupported instead of unknown
+	for _, ts := range interfaces {
+		d, err := parseInterface(fset, ts, docs[ts], gluaNames[ts], classes)
+		if err != nil {
+			return nil, err
+		}
+		pkg.interfaces = append(pkg.interfaces, d)
+	}
+
+	return pkg, nil
+}
+
+func parseInterface(fset *token.FileSet, ts *ast.TypeSpec, doc *ast.CommentGroup, gluaName string, classes map[string]*classDecl) (*interfaceDecl, error) {
+	d := &interfaceDecl{
+		goName: ts.Name.Name,
+		doc:    doc.Text(),
+		pos:    fset.Position(ts.Pos()),
+	}
+
+	it, ok := ts.Type.(*ast.InterfaceType)
+	if !ok || ts.TypeParams != nil {
+		return nil, fmt.Errorf("%s: %s: %s needs a non generic interface type", d.pos, d.goName, interfaceDirective)
+	}
+
+	for _, field := range it.Methods.List {
+		ft, ok := field.Type.(*ast.FuncType)
+		if !ok || len(field.Names) == 0 {
+			return nil, fmt.Errorf("%s: %s: embedded interfaces are not supported, list the methods", fset.Position(field.Pos()), d.goName)
+		}
+
+		m, err := parseSignature(fset, field.Names[0].Name, "", field.Doc, ft, field.Pos(), gluaName, classes)
+		if err != nil {
+			return nil, err
+		}
+
+		// arguments are pushed with PushAny and results converted with glua.ResultAs
+		for _, p := range m.params {
+			if p.typ.kind == kindState || p.typ.kind == kindClass {
+				return nil, fmt.Errorf("%s: %s.%s: %s can't be passed to Lua", m.pos, d.goName, m.goName, p.typ.expr)
+			}
+		}
+		for _, r := range m.results {
+			if r.typ.kind == kindClass {
+				return nil, fmt.Errorf("%s: %s.%s: %s can't be returned from Lua", m.pos, d.goName, m.goName, r.typ.expr)
+			}
+		}
+
+		d.methods = append(d.methods, m)
+	}
+
+	if len(d.methods) == 0 {
+		return nil, fmt.Errorf("%s: %s: the interface has no methods", d.pos, d.goName)
+	}
+	return d, nil
+}
+
+func parseFunc(fset *token.FileSet, fn *ast.FuncDecl, luaName, gluaName string, classes map[string]*classDecl) (*funcDecl, error) {
+	return parseSignature(fset, fn.Name.Name, luaName, fn.Doc, fn.Type, fn.Pos(), gluaName, classes)
+}
+
+func parseSignature(fset *token.FileSet, name, luaName string, doc *ast.CommentGroup, ft *ast.FuncType, pos token.Pos, gluaName string, classes map[string]*classDecl) (*funcDecl, error) {
+	d := &funcDecl{
+		goName:  name,
+		luaName: luaName,
+		doc:     doc.Text(),
+		pos:     fset.Position(pos),
+	}
+	if d.luaName == "" {
+		d.luaName = d.goName
+	}
+
+	fail := func(format string, args ...any) error {
+		return fmt.Errorf("%s: %s: %s", d.pos, d.goName, fmt.Sprintf(format, args...))
+	}
+
+	for i, field := range ft.Params.List {
+		if _, ok := field.Type.(*ast.Ellipsis); ok {
+			return nil, fail("variadic parameters are not supported")
+		}
+
+		t, err := resolveType(field.Type, gluaName, classes)
+		if err != nil {
+			return nil, fail("parameter %d: %v", i+1, err)
+		}
+
+		names := field.Names
+		if len(names) == 0 {
+			names = []*ast.Ident{{Name: "arg" + strconv.Itoa(len(d.params)+1)}}
+		}
+		for _, name := range names {
+			d.params = append(d.params, param{name: name.Name, typ: t})
+		}
+	}
+
+	if ft.Results != nil {
+		list := ft.Results.List
+		if n := len(list); n > 0 && len(list[n-1].Names) <= 1 && isIdent(list[n-1].Type, "error") {
+			d.errLast = true
+			list = list[:n-1]
+		}
+
+		for i, field := range list {
+			t, err := resolveType(field.Type, gluaName, classes)
+			if err != nil {
+				return nil, fail("result %d: %v", i+1, err)
+			}
+			if t.kind == kindState || t.kind == kindLuaObject {
+				return nil, fail("result %d: %s can't be returned", i+1, t.expr)
+			}
+
+			count := max(len(field.Names), 1)
+			for j := 0; j < count; j++ {
+				name := ""
+				if len(field.Names) > 0 {
+					name = field.Names[j].Name
+				}
+				d.results = append(d.results, param{name: name, typ: t})
+			}
+		}
+	}
+
+	return d, nil
+}
+
+var numberTypes = map[string]bool{
+	"int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true, "uintptr": true,
+	"float32": true, "float64": true, "byte": true, "rune": true,
+}
+
+func resolveType(expr ast.Expr, gluaName string, classes map[string]*classDecl) (goType, error) {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		switch {
+		case numberTypes[e.Name]:
+			return goType{kind: kindNumber, expr: e.Name}, nil
+		case e.Name == "string":
+			return goType{kind: kindString, expr: e.Name}, nil
+		case e.Name == "bool":
+			return goType{kind: kindBool, expr: e.Name}, nil
+		case classes[e.Name] != nil:
+			return goType{kind: kindClass, expr: e.Name, class: classes[e.Name]}, nil
+		}
+	case *ast.StarExpr:
+		if id, ok := e.X.(*ast.Ident); ok && classes[id.Name] != nil {
+			return goType{kind: kindClass, expr: "*" + id.Name, class: classes[id.Name], ptr: true}, nil
+		}
+		if sel, ok := e.X.(*ast.SelectorExpr); ok && isGluaSelector(sel, gluaName, "LuaObject") {
+			return goType{kind: kindLuaObject, expr: "*glua.LuaObject"}, nil
+		}
+	case *ast.ArrayType:
+		if e.Len == nil && (isIdent(e.Elt, "byte") || isIdent(e.Elt, "uint8")) {
+			return goType{kind: kindBytes, expr: "[]byte"}, nil
+		}
+	case *ast.SelectorExpr:
+		if isGluaSelector(e, gluaName, "State") {
+			return goType{kind: kindState, expr: "glua.State"}, nil
+		}
+	}
+
+	return goType{}, fmt.Errorf("unsupported type %s", exprString(expr))
+}
+
+// Returns the argument of the directive if it's in the comment group.
+func directive(doc *ast.CommentGroup, name string) (string, bool) {
+	if doc == nil {
+		return "", false
+	}
+	for _, c := range doc.List {
+		rest, ok := strings.CutPrefix(c.Text, name)
+		if !ok || (rest != "" && rest[0] != ' ' && rest[0] != '\t') {
+			continue
+		}
+		return strings.TrimSpace(rest), true
+	}
+	return "", false
+}
+
+// Returns the name glua is imported as in the file, "" if it isn't imported.
+func gluaImportName(f *ast.File) string {
+	for _, imp := range f.Imports {
+		path, _ := strconv.Unquote(imp.Path.Value)
+		if path != gluaImportPath {
+			continue
+		}
+		if imp.Name != nil {
+			return imp.Name.Name
+		}
+		return "glua"
+	}
+	return ""
+}
+
+func isGluaSelector(sel *ast.SelectorExpr, gluaName, name string) bool {
+	return gluaName != "" && isIdent(sel.X, gluaName) && sel.Sel.Name == name
+}
+
+func isIdent(expr ast.Expr, name string) bool {
+	id, ok := expr.(*ast.Ident)
+	return ok && id.Name == name
+}
+
+func receiverName(recv *ast.FieldList) string {
+	if recv == nil || len(recv.List) == 0 {
+		return ""
+	}
+	t := recv.List[0].Type
+	if star, ok := t.(*ast.StarExpr); ok {
+		t = star.X
+	}
+	if id, ok := t.(*ast.Ident); ok {
+		return id.Name
+	}
+	return "" // generic receivers aren't supported
+}
+
+func exprString(expr ast.Expr) string {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		return e.Name
+	case *ast.StarExpr:
+		return "*" + exprString(e.X)
+	case *ast.SelectorExpr:
+		return exprString(e.X) + "." + e.Sel.Name
+	case *ast.ArrayType:
+		if e.Len == nil {
+			return "[]" + exprString(e.Elt)
+		}
+		return "[...]" + exprString(e.Elt)
+	case *ast.MapType:
+		return "map[" + exprString(e.Key) + "]" + exprString(e.Value)
+	case *ast.InterfaceType:
+		return "interface{...}"
+	case *ast.FuncType:
+		return "func(...)"
+	default:
+		return fmt.Sprintf("%T", expr)
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"strings"
+)
+
+// Generates a LuaLS `---@meta` file describing the bindings, with the parameter names and doc comments of the Go
+// declarations.
+func generateStubs(pkg *packageDecl, lib string) []byte {
+	var w writer
+
+	w.line("---@meta")
+
+	for _, c := range pkg.classes {
+		local := luaIdent(c.luaName)
+
+		w.line("")
+		writeLuaDoc(&w, c.doc)
+		w.line("---@class %s", c.luaName)
+		w.line("local %s = {}", local)
+
+		for _, m := range c.methods {
+			w.line("")
+			writeStubFunc(&w, local+":"+m.luaName, m)
+		}
+	}
+
+	for _, it := range pkg.interfaces {
+		w.line("")
+		writeLuaDoc(&w, it.doc)
+		w.line("---@class %s", it.goName)
+		for _, m := range it.methods {
+			w.line("---@field %s %s", m.goName, funType(m))
+		}
+	}
+
+	if len(pkg.funcs) > 0 {
+		w.line("")
+		parts := strings.Split(lib, ".")
+		for i := range parts {
+			w.line("%s = {}", strings.Join(parts[:i+1], "."))
+		}
+
+		for _, fn := range pkg.funcs {
+			w.line("")
+			writeStubFunc(&w, lib+"."+fn.luaName, fn)
+		}
+	}
+
+	return w.Bytes()
+}
+
+func writeStubFunc(w *writer, name string, fn *funcDecl) {
+	writeLuaDoc(w, fn.doc)
+
+	var params []string
+	for _, p := range fn.params {
+		if p.typ.kind == kindState {
+			continue
+		}
+		w.line("---@param %s %s", p.name, luaType(p.typ, false))
+		params = append(params, p.name)
+	}
+	for _, r := range fn.results {
+		if r.name != "" {
+			w.line("---@return %s %s", luaType(r.typ, true), r.name)
+		} else {
+			w.line("---@return %s", luaType(r.typ, true))
+		}
+	}
+
+	w.line("function %s(%s) end", name, strings.Join(params, ", "))
+}
+
+// Returns the fun() type of a method implemented in Lua.
+func funType(m *funcDecl) string {
+	params := []string{"self"}
+	for _, p := range m.params {
+		params = append(params, p.name+": "+luaType(p.typ, false))
+	}
+
+	var results []string
+	for _, r := range m.results {
+		results = append(results, luaType(r.typ, true))
+	}
+	s := "fun(" + strings.Join(params, ", ") + ")"
+	if len(results) > 0 {
+		s += ": " + strings.Join(results, ", ")
+	}
+	return s
+}
+
+func writeLuaDoc(w *writer, doc string) {
+	doc = strings.TrimSpace(doc)
+	if doc == "" {
+		return
+	}
+	for _, line := range strings.Split(doc, "\n") {
+		w.line("%s", strings.TrimSpace("--- "+line))
+	}
+}
+
+// Returns the LuaLS type of t, nil pointers are only possible in results (they push nil, Check raises an error).
+func luaType(t goType, result bool) string {
+	switch t.kind {
+	case kindNumber:
+		if t.expr == "float32" || t.expr == "float64" {
+			return "number"
+		}
+		return "integer"
+	case kindString, kindBytes:
+		return "string"
+	case kindBool:
+		return "boolean"
+	case kindClass:
+		if t.ptr && result {
+			return t.class.luaName + "?"
+		}
+		return t.class.luaName
+	default:
+		return "any"
+	}
+}
+
+// Returns a Lua identifier for the local holding the class table.
+func luaIdent(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+//go:embed loader/host.c
+var hostSource []byte
+
+//go:embed loader/gmodenv.lua
+var hostEnv []byte
+
+// Returns the directory the loader is cached in, it changes with the sources so upgrades rebuild it.
+func hostDir() string {
+	cache, err := os.UserCacheDir()
+	if err != nil {
+		cache = os.TempDir()
+	}
+
+	sum := sha256.New()
+	sum.Write(hostSource)
+	sum.Write(hostEnv)
+	sum.Write([]byte(runtime.GOOS + "/" + runtime.GOARCH))
+
+	return filepath.Join(cache, "gluahost", hex.EncodeToString(sum.Sum(nil))[:16])
+}
+
+// Writes the Lua environment next to the loader and returns its path.
+func hostEnvPath() (string, error) {
+	dir := hostDir()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(dir, "gmodenv.lua")
+	if err := os.WriteFile(path, hostEnv, 0o644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// Builds the loader if it isn't cached yet and returns its path.
+func buildHost() (string, error) {
+	dir := hostDir()
+
+	exe := filepath.Join(dir, "host")
+	if runtime.GOOS == "windows" {
+		exe += ".exe"
+	}
+	if _, err := os.Stat(exe); err == nil {
+		return exe, nil
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	src := filepath.Join(dir, "host.c")
+	if err := os.WriteFile(src, hostSource, 0o644); err != nil {
+		return "", err
+	}
+
+	// built next to the final path and renamed, so concurrent runs never execute a partial binary
+	tmp := exe + ".tmp" + fmt.Sprint(os.Getpid())
+	defer os.Remove(tmp)
+
+	cc := strings.Fields(os.Getenv("CC"))
+	if len(cc) == 0 {
+		cc = []string{"cc"}
+	}
+
+	args := append(cc[1:], "-O2", "-o", tmp, src)
+	if runtime.GOOS == "linux" {
+		args = append(args, "-ldl")
+	}
+
+	cmd := exec.Command(cc[0], args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return "", fmt.Errorf("building the loader with %s: %w\n%s", cc[0], err, out)
+	}
+
+	if err := os.Rename(tmp, exe); err != nil {
+		return "", err
+	}
+	return exe, nil
+}
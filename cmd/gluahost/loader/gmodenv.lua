@@ -0,0 +1,367 @@
+-- A Lua port of the gmodenv package for the gluahost loader, which runs without Go. It emulates timer, hook,
+-- ErrorNoHalt(WithStack), Msg/MsgN/MsgC/print, SERVER/CLIENT, CurTime/FrameTime and include/AddCSLuaFile backed by
+-- a directory.
+--
+-- Time only moves when frame is called, so timers and Think hooks are deterministic. The host calls the functions
+-- of the returned table: frame runs a frame and errors returns the number of errors reported so far.
+
+local luaDir, client = ...
+
+local FRAME_TIME = 1 / 66
+
+local write = io.write
+local select, type, tostring, pcall, unpack = select, type, tostring, pcall, unpack
+
+local curTime = 0
+local errors = 0
+local timers = {} -- in creation order, so frames are deterministic
+local hooks = {}
+local csLuaFiles = {}
+
+local function pack(...)
+	return { n = select("#", ...), ... }
+end
+
+local function check(value, expected, arg)
+	if type(value) ~= expected then
+		error(("bad argument #%d (%s expected, got %s)"):format(arg, expected, type(value)), 3)
+	end
+	return value
+end
+
+local function tostrings(sep, skipTables, ...)
+	local parts = {}
+	for i = 1, select("#", ...) do
+		local v = select(i, ...)
+		if not (skipTables and type(v) == "table") then
+			parts[#parts + 1] = tostring(v)
+		end
+	end
+	return table.concat(parts, sep)
+end
+
+local function reportError(msg)
+	errors = errors + 1
+	write("[ERROR] ", msg, "\n")
+end
+
+SERVER = not client
+CLIENT = client
+
+function print(...)
+	write(tostrings("\t", false, ...), "\n")
+end
+
+function Msg(...)
+	write(tostrings("", false, ...))
+end
+
+function MsgN(...)
+	write(tostrings("", false, ...), "\n")
+end
+
+function MsgC(...)
+	write(tostrings("", true, ...))
+end
+
+function ErrorNoHalt(...)
+	reportError(tostrings("", false, ...))
+end
+
+function ErrorNoHaltWithStack(...)
+	reportError(debug.traceback(tostrings("", false, ...), 2))
+end
+
+function CurTime()
+	return curTime
+end
+
+RealTime = CurTime
+
+function FrameTime()
+	return FRAME_TIME
+end
+
+-- timer
+
+local function findTimer(name)
+	for _, t in ipairs(timers) do
+		if t.name == name then
+			return t
+		end
+	end
+end
+
+local function removeTimer(t)
+	for i, other in ipairs(timers) do
+		if other == t then
+			table.remove(timers, i)
+			break
+		end
+	end
+	t.removed = true
+end
+
+timer = {}
+
+function timer.Create(name, delay, reps, fn)
+	check(name, "string", 1)
+	check(delay, "number", 2)
+	check(reps, "number", 3)
+	check(fn, "function", 4)
+
+	local old = findTimer(name)
+	if old then
+		removeTimer(old)
+	end
+
+	timers[#timers + 1] = { name = name, delay = delay, reps = reps, calls = 0, next = curTime + delay, fn = fn }
+end
+
+function timer.Simple(delay, fn)
+	check(delay, "number", 1)
+	check(fn, "function", 2)
+
+	timers[#timers + 1] = { delay = delay, reps = 1, calls = 0, next = curTime + delay, fn = fn }
+end
+
+function timer.Remove(name)
+	local t = findTimer(check(name, "string", 1))
+	if t then
+		removeTimer(t)
+	end
+end
+
+function timer.Exists(name)
+	return findTimer(check(name, "string", 1)) ~= nil
+end
+
+function timer.Adjust(name, delay, reps, fn)
+	local t = findTimer(check(name, "string", 1))
+	if not t then
+		return false
+	end
+
+	t.delay = check(delay, "number", 2)
+	t.next = curTime + t.delay
+	if reps ~= nil then
+		t.reps = check(reps, "number", 3)
+		t.calls = 0
+	end
+	if fn ~= nil then
+		t.fn = check(fn, "function", 4)
+	end
+	return true
+end
+
+function timer.TimeLeft(name)
+	local t = findTimer(check(name, "string", 1))
+	if t then
+		return t.next - curTime
+	end
+end
+
+-- hook
+
+local function removeHook(event, name)
+	local list = hooks[event]
+	if not list then
+		return
+	end
+	for i, h in ipairs(list) do
+		if h.name == name then
+			h.removed = true
+			table.remove(list, i)
+			return
+		end
+	end
+end
+
+-- Calls every hook of event, stopping at the first one that returns a non nil value
+local function runHook(event, ...)
+	local list = hooks[event]
+	if not list then
+		return
+	end
+
+	for _, h in ipairs({ unpack(list) }) do
+		if not h.removed then -- removed by a hook that ran before it
+			local res = pack(pcall(h.fn, ...))
+			if not res[1] then
+				reportError(tostring(res[2]))
+			elseif res.n > 1 and res[2] ~= nil then
+				return unpack(res, 2, res.n)
+			end
+		end
+	end
+end
+
+hook = {}
+
+function hook.Add(event, name, fn)
+	check(event, "string", 1)
+	check(name, "string", 2)
+	check(fn, "function", 3)
+
+	removeHook(event, name)
+
+	hooks[event] = hooks[event] or {}
+	table.insert(hooks[event], { name = name, fn = fn })
+end
+
+function hook.Remove(event, name)
+	removeHook(check(event, "string", 1), check(name, "string", 2))
+end
+
+function hook.Run(event, ...)
+	return runHook(check(event, "string", 1), ...)
+end
+
+function hook.Call(event, gm, ...) -- there is no gamemode
+	return runHook(check(event, "string", 1), ...)
+end
+
+function hook.GetTable()
+	local tbl = {}
+	for event, list in pairs(hooks) do
+		tbl[event] = {}
+		for _, h in ipairs(list) do
+			tbl[event][h.name] = h.fn
+		end
+	end
+	return tbl
+end
+
+-- include/AddCSLuaFile
+
+local function cleanPath(path)
+	local parts = {}
+	for part in path:gsub("\\", "/"):gmatch("[^/]+") do
+		if part == ".." and #parts > 0 and parts[#parts] ~= ".." then
+			parts[#parts] = nil
+		elseif part ~= "." then
+			parts[#parts + 1] = part
+		end
+	end
+	return table.concat(parts, "/")
+end
+
+local function fileExists(path)
+	local f = io.open(path, "rb")
+	if f then
+		f:close()
+		return true
+	end
+	return false
+end
+
+-- Returns the file of the function at the given level, relative to the lua directory
+local function callingFile(level)
+	local info = debug.getinfo(level + 1, "S")
+	if not info then
+		return ""
+	end
+	local src = info.short_src:gsub("\\", "/")
+	return (src:gsub("^lua/", ""))
+end
+
+-- Resolves an include path the way gmod does: relative to the calling file first, then relative to luaDir.
+local function resolveLuaFile(file, caller)
+	if luaDir == "" then
+		return nil, "no lua directory set"
+	end
+
+	file = cleanPath(file)
+
+	local candidates = {}
+	if caller ~= "" then
+		candidates[#candidates + 1] = cleanPath((caller:match("^(.*)/") or ".") .. "/" .. file)
+	end
+	candidates[#candidates + 1] = file
+
+	for _, rel in ipairs(candidates) do
+		if rel:sub(1, 3) ~= "../" and rel ~= ".." and fileExists(luaDir .. "/" .. rel) then
+			return rel
+		end
+	end
+
+	return nil, ("couldn't include file '%s' - File not found"):format(file)
+end
+
+function include(file)
+	local rel, err = resolveLuaFile(check(file, "string", 1), callingFile(2))
+	if not rel then
+		reportError(err)
+		return
+	end
+
+	local f = assert(io.open(luaDir .. "/" .. rel, "rb"))
+	local code = f:read("*a")
+	f:close()
+
+	local fn, compileErr = loadstring(code, "@lua/" .. rel)
+	if not fn then
+		reportError(compileErr)
+		return
+	end
+
+	return fn()
+end
+
+function AddCSLuaFile(file)
+	local rel
+	if file == nil then
+		rel = callingFile(2)
+	else
+		local err
+		rel, err = resolveLuaFile(check(file, "string", 1), callingFile(2))
+		if not rel then
+			reportError(err)
+			return
+		end
+	end
+
+	for _, other in ipairs(csLuaFiles) do
+		if other == rel then
+			return
+		end
+	end
+	csLuaFiles[#csLuaFiles + 1] = rel
+end
+
+local host = {}
+
+-- Advances time by one frame, runs due timers and then the Think and Tick hooks.
+function host.frame()
+	curTime = curTime + FRAME_TIME
+
+	for _, t in ipairs({ unpack(timers) }) do
+		if not t.removed and t.next <= curTime then
+			t.calls = t.calls + 1
+			local finished = t.reps > 0 and t.calls >= t.reps
+			t.next = t.next + math.max(t.delay, 0)
+			if t.next < curTime then -- zero delay timers run every frame
+				t.next = curTime
+			end
+
+			local ok, err = pcall(t.fn)
+			if not ok then
+				reportError(tostring(err))
+			end
+
+			if finished and not t.removed then
+				removeTimer(t)
+			end
+		end
+	end
+
+	runHook("Think")
+	runHook("Tick")
+	io.stdout:flush()
+end
+
+function host.errors()
+	return errors
+end
+
+return host
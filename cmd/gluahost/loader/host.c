@@ -0,0 +1,318 @@
+// The gluahost loader. It's a plain C program (built and started by the gluahost command) so the module is the only
+// Go runtime in the process, Go doesn't support loading a c-shared Go library into a Go program.
+//
+// usage: host -module <path> -lua-shared <path> -env <gmodenv.lua> [-lua-dir <dir>] [-client] [-frames <n>]
+//             [-interval-us <n>] [files.lua...]
+//
+// Exit status: 0 on success, 1 if a Lua error happened, 2 on usage errors and 3 if loading failed.
+
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+
+#ifdef _WIN32
+#include <windows.h>
+#define LIB_HANDLE HMODULE
+#define LOAD_LIBRARY(lib) LoadLibraryA(lib)
+#define GET_FUNCTION(lib, func) ((void *)GetProcAddress(lib, func))
+#else
+#include <dlfcn.h>
+#include <unistd.h>
+#define LIB_HANDLE void *
+#define LOAD_LIBRARY(lib) dlopen(lib, RTLD_NOW | RTLD_GLOBAL)
+#define GET_FUNCTION(lib, func) dlsym(lib, func)
+#endif
+
+#define LUA_REGISTRYINDEX (-10000)
+#define LUA_GLOBALSINDEX (-10002)
+
+typedef struct lua_State lua_State;
+
+// The lua_shared functions the host needs, resolved by name like glua does
+#define HOST_FUNCTIONS                                        \
+    X(lua_State *, luaL_newstate, void)                       \
+    X(void, luaL_openlibs, lua_State *)                       \
+    X(int, luaL_loadfile, lua_State *, const char *)          \
+    X(int, lua_gettop, lua_State *)                           \
+    X(void, lua_settop, lua_State *, int)                     \
+    X(void, lua_insert, lua_State *, int)                     \
+    X(void, lua_getfield, lua_State *, int, const char *)     \
+    X(void, lua_setfield, lua_State *, int, const char *)     \
+    X(void, lua_pushstring, lua_State *, const char *)        \
+    X(void, lua_pushboolean, lua_State *, int)                \
+    X(int, lua_pcall, lua_State *, int, int, int)             \
+    X(double, lua_tonumber, lua_State *, int)                 \
+    X(const char *, lua_tolstring, lua_State *, int, size_t *)
+
+#define X(ret, name, ...) static ret (*p_##name)(__VA_ARGS__);
+HOST_FUNCTIONS
+#undef X
+
+typedef int (*gmod13_fn)(lua_State *);
+
+struct options
+{
+    const char *module;
+    const char *lua_shared;
+    const char *env;
+    const char *lua_dir;
+    int client;
+    int frames;
+    long interval_us;
+    char **files;
+    int nfiles;
+};
+
+static int usage(void)
+{
+    fprintf(stderr, "usage: host -module <path> -lua-shared <path> -env <gmodenv.lua> [-lua-dir <dir>] [-client] "
+                    "[-frames <n>] [-interval-us <n>] [files.lua...]\n");
+    return 2;
+}
+
+static int parse_args(int argc, char **argv, struct options *o)
+{
+    memset(o, 0, sizeof(*o));
+    o->frames = 1;
+    o->lua_dir = "";
+
+    int i = 1;
+    for (; i < argc && argv[i][0] == '-'; i++)
+    {
+        const char *arg = argv[i];
+        if (strcmp(arg, "-client") == 0)
+        {
+            o->client = 1;
+            continue;
+        }
+        if (i + 1 >= argc)
+        {
+            return 0;
+        }
+
+        const char *value = argv[++i];
+        if (strcmp(arg, "-module") == 0)
+            o->module = value;
+        else if (strcmp(arg, "-lua-shared") == 0)
+            o->lua_shared = value;
+        else if (strcmp(arg, "-env") == 0)
+            o->env = value;
+        else if (strcmp(arg, "-lua-dir") == 0)
+            o->lua_dir = value;
+        else if (strcmp(arg, "-frames") == 0)
+            o->frames = atoi(value);
+        else if (strcmp(arg, "-interval-us") == 0)
+            o->interval_us = atol(value);
+        else
+            return 0;
+    }
+
+    o->files = argv + i;
+    o->nfiles = argc - i;
+    return o->module != NULL && o->lua_shared != NULL && o->env != NULL;
+}
+
+static void sleep_us(long us)
+{
+    if (us <= 0)
+    {
+        return;
+    }
+#ifdef _WIN32
+    Sleep((DWORD)(us / 1000));
+#else
+    usleep((useconds_t)us);
+#endif
+}
+
+static const char *load_error(void)
+{
+#ifdef _WIN32
+    static char buf[64];
+    snprintf(buf, sizeof(buf), "error %lu", (unsigned long)GetLastError());
+    return buf;
+#else
+    const char *err = dlerror();
+    return err != NULL ? err : "unknown error";
+#endif
+}
+
+static int load_lua_shared(const char *path)
+{
+    LIB_HANDLE lib = LOAD_LIBRARY(path);
+    if (lib == NULL)
+    {
+        fprintf(stderr, "gluahost: failed to load lua_shared %s: %s\n", path, load_error());
+        return 0;
+    }
+
+#define X(ret, name, ...)                                                           \
+    p_##name = (ret(*)(__VA_ARGS__))GET_FUNCTION(lib, #name);                       \
+    if (p_##name == NULL)                                                           \
+    {                                                                               \
+        fprintf(stderr, "gluahost: %s doesn't export %s\n", path, #name);           \
+        return 0;                                                                   \
+    }
+    HOST_FUNCTIONS
+#undef X
+
+    return 1;
+}
+
+// Pushes debug.traceback, to be used as the error handler of lua_pcall
+static int push_traceback(lua_State *L)
+{
+    p_lua_getfield(L, LUA_GLOBALSINDEX, "debug");
+    p_lua_getfield(L, -1, "traceback");
+    p_lua_insert(L, -2);
+    p_lua_settop(L, -2);
+    return p_lua_gettop(L);
+}
+
+static void print_error(lua_State *L)
+{
+    const char *msg = p_lua_tolstring(L, -1, NULL);
+    fprintf(stderr, "%s\n", msg != NULL ? msg : "(error object is not a string)");
+}
+
+// Calls the function of the environment table (kept in the registry) with the given name and returns its first
+// result as a number
+static double call_env(lua_State *L, const char *name)
+{
+    int top = p_lua_gettop(L);
+    double res = 0;
+
+    p_lua_getfield(L, LUA_REGISTRYINDEX, "gluahost.env");
+    p_lua_getfield(L, -1, name);
+    if (p_lua_pcall(L, 0, 1, 0) != 0)
+    {
+        print_error(L);
+        res = -1;
+    }
+    else
+    {
+        res = p_lua_tonumber(L, -1);
+    }
+
+    p_lua_settop(L, top);
+    return res;
+}
+
+static void run_frames(lua_State *L, const struct options *o)
+{
+    for (int i = 0; i < o->frames; i++)
+    {
+        if (i > 0)
+        {
+            sleep_us(o->interval_us);
+        }
+        call_env(L, "frame");
+    }
+}
+
+static int install_env(lua_State *L, const struct options *o)
+{
+    int errFunc = push_traceback(L);
+
+    if (p_luaL_loadfile(L, o->env) != 0)
+    {
+        print_error(L);
+        return 0;
+    }
+    p_lua_pushstring(L, o->lua_dir);
+    p_lua_pushboolean(L, o->client);
+    if (p_lua_pcall(L, 2, 1, errFunc) != 0)
+    {
+        print_error(L);
+        return 0;
+    }
+
+    p_lua_setfield(L, LUA_REGISTRYINDEX, "gluahost.env");
+    p_lua_settop(L, 0);
+    return 1;
+}
+
+static int run_file(lua_State *L, const char *file)
+{
+    p_lua_settop(L, 0);
+    int errFunc = push_traceback(L);
+
+    int ok = p_luaL_loadfile(L, file) == 0 && p_lua_pcall(L, 0, 0, errFunc) == 0;
+    if (!ok)
+    {
+        print_error(L);
+    }
+
+    p_lua_settop(L, 0);
+    return ok;
+}
+
+int main(int argc, char **argv)
+{
+    struct options o;
+    if (!parse_args(argc, argv, &o))
+    {
+        return usage();
+    }
+
+    // the module has its own copy of glua, it finds the library through the environment and reuses our handle
+#ifdef _WIN32
+    _putenv_s("GLUA_LUA_SHARED", o.lua_shared);
+#else
+    setenv("GLUA_LUA_SHARED", o.lua_shared, 1);
+#endif
+
+    if (!load_lua_shared(o.lua_shared))
+    {
+        return 3;
+    }
+
+    lua_State *L = p_luaL_newstate();
+    p_luaL_openlibs(L);
+
+    if (!install_env(L, &o))
+    {
+        return 3;
+    }
+
+    LIB_HANDLE module = LOAD_LIBRARY(o.module);
+    if (module == NULL)
+    {
+        fprintf(stderr, "gluahost: failed to load module %s: %s\n", o.module, load_error());
+        return 3;
+    }
+
+    gmod13_fn gmod_open = (gmod13_fn)GET_FUNCTION(module, "gmod13_open");
+    gmod13_fn gmod_close = (gmod13_fn)GET_FUNCTION(module, "gmod13_close");
+    if (gmod_open == NULL || gmod_close == NULL)
+    {
+        fprintf(stderr, "gluahost: module doesn't export %s\n", gmod_open == NULL ? "gmod13_open" : "gmod13_close");
+        return 3;
+    }
+
+    int ok = 1;
+
+    // the module remembers this thread as the Lua thread, everything below runs on it
+    gmod_open(L);
+    run_frames(L, &o);
+
+    for (int i = 0; i < o.nfiles; i++)
+    {
+        if (!run_file(L, o.files[i]))
+        {
+            ok = 0;
+        }
+        run_frames(L, &o);
+    }
+
+    p_lua_settop(L, 0);
+    gmod_close(L);
+
+    if (call_env(L, "errors") != 0)
+    {
+        ok = 0;
+    }
+
+    fflush(stdout);
+    return ok ? 0 : 1;
+}
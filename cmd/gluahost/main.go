@@ -0,0 +1,114 @@
+// gluahost loads a built gmsv_*/gmcl_* module outside of Garry's Mod, so modules can be exercised in CI.
+//
+// It creates a Lua state from a stand-in lua_shared (any LuaJIT 2.1 build exporting the same symbols glua looks up),
+// calls gmod13_open, runs frames so the think queue gets processed, runs the given Lua files and calls gmod13_close.
+// The gmod globals modules usually need (timer, hook, include...) are emulated by loader/gmodenv.lua, a Lua port of the
+// gmodenv package.
+//
+// The module is a Go c-shared library and a process can only hold one Go runtime, so the loader is a small C
+// program (loader/host.c). gluahost only builds it with the C compiler cgo uses ($CC, cc by default), caches it and runs
+// it, the module never shares a process with gluahost itself.
+//
+// The exit status is 1 if any Lua error happened.
+//
+//	gluahost -module bin/gmsv_mymod_linux64.dll -lua-shared /usr/lib/libluajit-5.1.so.2 tests/*.lua
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+func main() {
+	modulePath := flag.String("module", "", "path to the built module (required)")
+	luaSharedPath := flag.String("lua-shared", "", "path to the stand-in lua_shared library (required)")
+	luaDir := flag.String("lua-dir", "", "directory include and AddCSLuaFile resolve paths against")
+	client := flag.Bool("client", false, "set CLIENT instead of SERVER")
+	frames := flag.Int("frames", 1, "frames to run after opening the module and after each file")
+	interval := flag.Duration("interval", 15*time.Millisecond, "time between frames")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: gluahost -module <path> -lua-shared <path> [flags] [files.lua...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *modulePath == "" || *luaSharedPath == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	host, err := buildHost()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gluahost:", err)
+		os.Exit(1)
+	}
+
+	args, err := hostArgs(*modulePath, *luaSharedPath, *luaDir, *client, *frames, *interval, flag.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "gluahost:", err)
+		os.Exit(1)
+	}
+
+	os.Exit(runHost(host, args))
+}
+
+// Returns the arguments of the loader, paths are made absolute.
+func hostArgs(modulePath, luaSharedPath, luaDir string, client bool, frames int, interval time.Duration, files []string) ([]string, error) {
+	abs := func(path string) string {
+		if path == "" {
+			return ""
+		}
+		p, err := filepath.Abs(path)
+		if err != nil {
+			return path
+		}
+		return p
+	}
+
+	env, err := hostEnvPath()
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{
+		"-module", abs(modulePath),
+		"-lua-shared", abs(luaSharedPath),
+		"-env", env,
+		"-frames", strconv.Itoa(frames),
+		"-interval-us", strconv.FormatInt(interval.Microseconds(), 10),
+	}
+	if luaDir != "" {
+		args = append(args, "-lua-dir", abs(luaDir))
+	}
+	if client {
+		args = append(args, "-client")
+	}
+	for _, file := range files {
+		args = append(args, abs(file))
+	}
+	return args, nil
+}
+
+// Runs the loader with the output of gluahost and returns its exit status.
+func runHost(host string, args []string) int {
+	cmd := exec.Command(host, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.ExitCode()
+		}
+		fmt.Fprintln(os.Stderr, "gluahost:", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Srlion/glua/gluatest"
+	"github.com/Srlion/glua/gmodenv"
+)
+
+// Builds the loader in a temporary cache, skips the test if there is no C compiler.
+func testHost(t *testing.T) string {
+	t.Helper()
+
+	cc := "cc"
+	if fields := strings.Fields(os.Getenv("CC")); len(fields) > 0 {
+		cc = fields[0]
+	}
+	if _, err := exec.LookPath(cc); err != nil {
+		t.Skipf("no C compiler: %v", err)
+	}
+
+	cache := t.TempDir()
+	t.Setenv("XDG_CACHE_HOME", cache)
+	t.Setenv("HOME", cache)
+	t.Setenv("LocalAppData", cache)
+
+	host, err := buildHost()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return host
+}
+
+func runTestHost(t *testing.T, host string, args []string) (int, string) {
+	t.Helper()
+
+	var out bytes.Buffer
+	cmd := exec.Command(host, args...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return exitErr.ExitCode(), out.String()
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	return 0, out.String()
+}
+
+func TestHostUsage(t *testing.T) {
+	host := testHost(t)
+
+	if code, _ := runTestHost(t, host, nil); code != 2 {
+		t.Fatalf("exit status %d without arguments, want 2", code)
+	}
+
+	args, err := hostArgs("mod.so", filepath.Join(t.TempDir(), "missing.so"), "", false, 1, 0, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, out := runTestHost(t, host, args)
+	if code != 3 || !strings.Contains(out, "failed to load lua_shared") {
+		t.Fatalf("exit status %d with a missing lua_shared, want 3:\n%s", code, out)
+	}
+}
+
+// Returns the LuaJIT build the tests run against, skips the test if there is none.
+func testLuaShared(t *testing.T) string {
+	t.Helper()
+
+	luaShared := os.Getenv(gluatest.LuaSharedEnv)
+	if luaShared == "" {
+		t.Skip(gluatest.LuaSharedEnv + " is not set")
+	}
+	return luaShared
+}
+
+// Builds the example module into dir.
+func buildExample(t *testing.T, dir string) string {
+	t.Helper()
+
+	module := filepath.Join(dir, "gmsv_example.so")
+	build := exec.Command("go", "build", "-buildmode=c-shared", "-o", module, "../../_example")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("building the example module: %v\n%s", err, out)
+	}
+	return module
+}
+
+// Builds the example module and runs Lua files against it, needs a LuaJIT build like gluatest.
+func TestHostRunsModule(t *testing.T) {
+	luaShared := testLuaShared(t)
+	host := testHost(t)
+
+	dir := t.TempDir()
+	module := buildExample(t, dir)
+
+	ok := filepath.Join(dir, "ok.lua")
+	os.WriteFile(ok, []byte(`
+		assert(test("hi") == "Hello from Go!")
+		timer.Simple(0, function() print("timer ran") end)
+	`), 0o644)
+	fail := filepath.Join(dir, "fail.lua")
+	os.WriteFile(fail, []byte(`error("boom")`), 0o644)
+
+	args, err := hostArgs(module, luaShared, "", false, 2, time.Millisecond, []string{ok})
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, out := runTestHost(t, host, args)
+	if code != 0 || !strings.Contains(out, "timer ran") {
+		t.Fatalf("exit status %d, want 0:\n%s", code, out)
+	}
+
+	args, _ = hostArgs(module, luaShared, "", false, 1, 0, []string{fail})
+	if code, out := runTestHost(t, host, args); code != 1 || !strings.Contains(out, "boom") {
+		t.Fatalf("exit status %d for a failing file, want 1:\n%s", code, out)
+	}
+}
+
+// Frames the fixtures run after the module is opened and after the file
+const envFixtureFrames = 3
+
+/*
+Runs the scripts of testdata/env with the loader's Lua port of gmodenv and with the gmodenv package, and compares
+what they print. The port is written by hand, this keeps the two from drifting apart.
+*/
+func TestEnvImplementationsAgree(t *testing.T) {
+	luaShared := testLuaShared(t)
+	host := testHost(t)
+	module := buildExample(t, t.TempDir())
+
+	luaDir, err := filepath.Abs("testdata/env/lua")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixtures, err := filepath.Glob("testdata/env/*.lua")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, fixture := range fixtures {
+		t.Run(filepath.Base(fixture), func(t *testing.T) {
+			file, err := filepath.Abs(fixture)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			args, err := hostArgs(module, luaShared, luaDir, false, envFixtureFrames, 0, []string{file})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var stdout, stderr bytes.Buffer
+			cmd := exec.Command(host, args...)
+			cmd.Stdout = &stdout
+			cmd.Stderr = &stderr
+			if err := cmd.Run(); err != nil {
+				if _, ok := err.(*exec.ExitError); !ok {
+					t.Fatal(err)
+				}
+			}
+
+			goOutput := runGoEnv(t, file, luaDir)
+			if stdout.String() != goOutput {
+				t.Errorf("gmodenv.lua and gmodenv print different output\ngmodenv.lua:\n%s\ngmodenv:\n%s\nloader stderr:\n%s",
+					stdout.String(), goOutput, stderr.String())
+			}
+		})
+	}
+}
+
+// Runs file against the gmodenv package the way the loader does, and returns what it printed.
+func runGoEnv(t *testing.T, file, luaDir string) string {
+	t.Helper()
+
+	L := gluatest.NewEnv(t, gmodenv.Options{LuaDir: luaDir, OnError: func(string) {}})
+	L.Step(envFixtureFrames)
+
+	code, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the loader uses luaL_loadfile, which names the chunk after the path
+	if err := L.CompileBuffer(code, "@"+file); err != nil {
+		t.Fatal(err)
+	}
+	if err := L.PCall(0, 0, 0); err != nil {
+		t.Fatalf("running %s: %v", file, err)
+	}
+	L.Step(envFixtureFrames)
+
+	return L.Env.Output()
+}
@@ -0,0 +1,34 @@
+local order = {}
+hook.Add("Test", "a", function(x) order[#order + 1] = "a" .. x end)
+hook.Add("Test", "b", function(x) return "b" .. x, "second" end)
+hook.Add("Test", "c", function(x) order[#order + 1] = "c" .. x end)
+
+print("run", hook.Run("Test", 1))
+print("call", hook.Call("Test", nil, 2))
+hook.Remove("Test", "b")
+print("after remove", hook.Run("Test", 3))
+print("order", table.concat(order, ","))
+
+-- re-adding a hook moves it to the end
+hook.Add("Test", "a", function() order[#order + 1] = "new a" end)
+hook.Run("Test", 4)
+print("order", table.concat(order, ","))
+
+local names = {}
+for name in pairs(hook.GetTable().Test) do
+	names[#names + 1] = name
+end
+table.sort(names)
+print("table", table.concat(names, ","))
+print("missing event", hook.Run("Missing"))
+
+local thinks, ticks = 0, 0
+hook.Add("Think", "count", function() thinks = thinks + 1 end)
+hook.Add("Think", "failing", function() error("think failed", 0) end)
+hook.Add("Think", "removes", function() hook.Remove("Think", "removed") end)
+hook.Add("Think", "removed", function() print("removed hook ran") end)
+hook.Add("Tick", "count", function()
+	ticks = ticks + 1
+	print("frame", thinks, ticks)
+end)
+print("bad arguments", (pcall(hook.Add, "Think")))
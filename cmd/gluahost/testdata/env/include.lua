@@ -0,0 +1,5 @@
+print("include", include("lib/a.lua"))
+print("root", include("b.lua"))
+include("missing.lua")
+AddCSLuaFile("lib/a.lua")
+print("compile error", include("broken.lua"))
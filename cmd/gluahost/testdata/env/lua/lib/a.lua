@@ -0,0 +1,2 @@
+-- b.lua next to this file wins over the one at the root
+return "a", include("b.lua")
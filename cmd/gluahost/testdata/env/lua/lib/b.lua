@@ -0,0 +1 @@
+return "lib/b"
@@ -0,0 +1,8 @@
+print("a", 1, nil, true)
+print()
+Msg("msg", 2, " ")
+MsgN("msgn")
+MsgC({ r = 255, g = 0, b = 0 }, "colored", { r = 1 }, " text\n")
+ErrorNoHalt("no ", "halt")
+print("realm", SERVER, CLIENT)
+print("time", CurTime() > 0, RealTime() == CurTime(), string.format("%.6f", FrameTime()))
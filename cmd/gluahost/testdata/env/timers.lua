@@ -0,0 +1,24 @@
+-- timers scheduled in frames, the host runs 3 frames after this file
+local frame = FrameTime()
+local calls = {}
+local function count(name)
+	calls[name] = (calls[name] or 0) + 1
+	print(name, calls[name])
+end
+
+timer.Create("rep", frame, 2, function() count("rep") end)
+timer.Simple(frame * 2, function() count("simple") end)
+timer.Create("forever", 0, 0, function() count("forever") end)
+timer.Create("self", 0, 0, function()
+	count("self")
+	timer.Remove("self")
+end)
+timer.Create("replaced", 0, 1, function() count("first") end)
+timer.Create("replaced", 0, 1, function() count("second") end)
+timer.Create("adjusted", 100, 0, function() count("adjusted") end)
+timer.Create("failing", 0, 1, function() error("timer failed", 0) end)
+
+print("exists", timer.Exists("rep"), timer.Exists("missing"))
+print("adjust", timer.Adjust("adjusted", frame, 1), timer.Adjust("missing", 1))
+print("left", string.format("%.4f", timer.TimeLeft("rep")), timer.TimeLeft("missing"))
+print("bad arguments", (pcall(timer.Create, 1)), (pcall(timer.Simple, "soon")))
@@ -0,0 +1,385 @@
+package glua
+
+/*
+#include "c/glua.h"
+*/
+import "C"
+import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// A console to run Lua on a live server from a terminal, eg. `nc localhost 21111` or `nc -U /tmp/mymod.sock`.
+//
+// The protocol is line based: if a token is set the first line has to be the token, then every line is Lua code.
+// When a chunk is incomplete (eg. an unfinished function) the console asks for more lines with ">> " until it
+// compiles. Chunks run on the main thread through the think queue and everything they print (print, Msg, MsgN and
+// MsgC) is sent back while they run.
+
+const DefaultConsoleAddr = "127.0.0.1:21111"
+
+const (
+	consolePrompt             = "> "
+	consoleContinuationPrompt = ">> "
+)
+
+type ConsoleOptions struct {
+	// "tcp" or "unix", defaults to "tcp"
+	Network string
+	// Address for tcp (must be a loopback address, defaults to DefaultConsoleAddr) or socket path for unix
+	Addr string
+	// Shared secret that has to be sent as the first line, required for tcp
+	Token string
+}
+
+type Console struct {
+	opts ConsoleOptions
+	ln   net.Listener
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+/*
+Starts a console server, it's opt-in so nothing listens unless this is called.
+
+# Example
+
+	console, err := glua.StartConsole(glua.ConsoleOptions{Token: os.Getenv("MYMOD_CONSOLE_TOKEN")})
+	if err != nil {
+		fmt.Println(err)
+		return 0
+	}
+
+	// in gmod13_close
+	console.Close()
+*/
+func StartConsole(opts ConsoleOptions) (*Console, error) {
+	if opts.Network == "" {
+		opts.Network = "tcp"
+	}
+
+	switch opts.Network {
+	case "tcp":
+		if opts.Addr == "" {
+			opts.Addr = DefaultConsoleAddr
+		}
+		if opts.Token == "" {
+			return nil, errors.New("a token is required for tcp consoles")
+		}
+		if err := checkLoopbackAddr(opts.Addr); err != nil {
+			return nil, err
+		}
+	case "unix":
+		if opts.Addr == "" {
+			return nil, errors.New("a socket path is required for unix consoles")
+		}
+		os.Remove(opts.Addr) // stale socket from a previous run
+	default:
+		return nil, errors.New("unsupported console network: " + opts.Network)
+	}
+
+	ln, err := net.Listen(opts.Network, opts.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.Network == "unix" {
+		os.Chmod(opts.Addr, 0o600)
+	}
+
+	c := &Console{
+		opts:  opts,
+		ln:    ln,
+		conns: map[net.Conn]struct{}{},
+		done:  make(chan struct{}),
+	}
+
+	go c.acceptLoop()
+
+	return c, nil
+}
+
+func checkLoopbackAddr(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+
+	if host == "localhost" {
+		return nil
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !ip.IsLoopback() {
+		return errors.New("console address must be a loopback address, got: " + addr)
+	}
+
+	return nil
+}
+
+// Returns the address the console is listening on, useful when listening on port 0.
+func (c *Console) Addr() net.Addr {
+	return c.ln.Addr()
+}
+
+// Stops the console and disconnects all clients.
+func (c *Console) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		close(c.done)
+		err = c.ln.Close()
+
+		c.mu.Lock()
+		for conn := range c.conns {
+			conn.Close()
+		}
+		c.mu.Unlock()
+	})
+	return err
+}
+
+func (c *Console) acceptLoop() {
+	for {
+		conn, err := c.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		c.mu.Lock()
+		c.conns[conn] = struct{}{}
+		c.mu.Unlock()
+
+		go func() {
+			defer func() {
+				c.mu.Lock()
+				delete(c.conns, conn)
+				c.mu.Unlock()
+				conn.Close()
+			}()
+			c.serve(conn)
+		}()
+	}
+}
+
+func (c *Console) serve(conn net.Conn) {
+	r := bufio.NewScanner(conn)
+	r.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	w := bufio.NewWriter(conn)
+
+	if c.opts.Token != "" {
+		if !r.Scan() {
+			return
+		}
+		token := strings.TrimRight(r.Text(), "\r")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(c.opts.Token)) != 1 {
+			w.WriteString("invalid token\n")
+			w.Flush()
+			return
+		}
+	}
+
+	var chunk strings.Builder
+	for {
+		if chunk.Len() == 0 {
+			w.WriteString(consolePrompt)
+		} else {
+			w.WriteString(consoleContinuationPrompt)
+		}
+		if w.Flush() != nil || !r.Scan() {
+			return
+		}
+
+		line := strings.TrimRight(r.Text(), "\r")
+		if chunk.Len() == 0 && strings.TrimSpace(line) == "" {
+			continue
+		}
+		if chunk.Len() > 0 {
+			chunk.WriteByte('\n')
+		}
+		chunk.WriteString(line)
+
+		incomplete, ok := c.run(chunk.String(), w)
+		if !ok {
+			w.WriteString("lua state is not open\n")
+			w.Flush()
+			return
+		}
+		if incomplete {
+			continue
+		}
+
+		chunk.Reset()
+	}
+}
+
+// Output of a running chunk, it's written on the main thread and sent to the client as it's produced.
+type consoleOutput struct {
+	mu    sync.Mutex
+	buf   strings.Builder
+	ready chan struct{}
+}
+
+func newConsoleOutput() *consoleOutput {
+	return &consoleOutput{ready: make(chan struct{}, 1)}
+}
+
+// Never blocks, so a slow client can't stall the main thread.
+func (o *consoleOutput) WriteString(s string) {
+	o.mu.Lock()
+	o.buf.WriteString(s)
+	o.mu.Unlock()
+
+	select {
+	case o.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Returns what was written since the last call.
+func (o *consoleOutput) take() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	s := o.buf.String()
+	o.buf.Reset()
+	return s
+}
+
+// Runs a chunk on the main thread, writing its output to w while it runs, and waits for it to finish.
+func (c *Console) run(code string, w *bufio.Writer) (incomplete bool, ok bool) {
+	if !IS_STATE_OPEN.Load() {
+		return false, false
+	}
+
+	out := newConsoleOutput()
+	ch := make(chan bool, 1)
+
+	WaitLuaThink(func(L State) int {
+		incomplete := false
+		// always send a result, a panicking chunk would leave the client waiting forever
+		defer func() {
+			if r := recover(); r != nil {
+				out.WriteString(fmt.Sprintf("error: %v\n", r))
+				incomplete = false
+			}
+			ch <- incomplete
+		}()
+		incomplete = runConsoleChunk(L, code, out)
+		return 0
+	})
+
+	for {
+		select {
+		case <-out.ready:
+			w.WriteString(out.take())
+			w.Flush()
+		case incomplete := <-ch:
+			w.WriteString(out.take())
+			return incomplete, true
+		case <-c.done:
+			return false, false
+		}
+	}
+}
+
+/*
+Compiles and runs a chunk the same way the Lua REPL does, first as an expression then as a statement.
+
+While it runs print, Msg, MsgN and MsgC write to out instead of the server console. Returns incomplete if the chunk
+could become valid with more lines.
+*/
+func runConsoleChunk(L State, code string, out *consoleOutput) bool {
+	top := L.GetTop()
+	defer L.SetTop(top)
+
+	if err := L.CompileBuffer([]byte("return "+code), "=console"); err != nil {
+		L.Pop()
+		if err := L.CompileBuffer([]byte(code), "=console"); err != nil {
+			if strings.HasSuffix(err.Error(), "'<eof>'") {
+				return true
+			}
+			out.WriteString("error: " + err.Error() + "\n")
+			return false
+		}
+	}
+
+	captures := []struct {
+		name string
+		fn   GoFunc
+	}{
+		{"print", func(L State) int {
+			out.WriteString(strings.Join(consoleToStrings(L, 1, L.GetTop()), "\t") + "\n")
+			return 0
+		}},
+		{"Msg", func(L State) int {
+			out.WriteString(strings.Join(consoleToStrings(L, 1, L.GetTop()), ""))
+			return 0
+		}},
+		{"MsgN", func(L State) int {
+			out.WriteString(strings.Join(consoleToStrings(L, 1, L.GetTop()), "") + "\n")
+			return 0
+		}},
+		// tables are colors, the console has none
+		{"MsgC", func(L State) int {
+			for i := 1; i <= L.GetTop(); i++ {
+				if !L.IsTable(i) {
+					out.WriteString(strings.Join(consoleToStrings(L, i, i), ""))
+				}
+			}
+			return 0
+		}},
+	}
+	for _, capture := range captures {
+		L.GetGlobal(capture.name)
+		old := L.CreateRef()
+		defer func() {
+			L.FromRef(old)
+			L.SetGlobal(capture.name)
+			L.DeleteRef(old)
+		}()
+
+		handle := registerGoFunc(capture.fn, false)
+		defer releaseGoFunc(handle)
+
+		L.PushLightUserData(handle)
+		L.PushCClosure(C.lua_call_go, 1)
+		L.SetGlobal(capture.name)
+	}
+
+	if err := L.PCall(0, LUA_MULTRET, 0); err != nil {
+		out.WriteString(fmt.Sprintf("error: %s\n", err))
+		return false
+	}
+
+	if L.GetTop() > top {
+		out.WriteString(strings.Join(consoleToStrings(L, top+1, L.GetTop()), "\t") + "\n")
+	}
+
+	return false
+}
+
+// Converts the values between from and to (inclusive) with tostring.
+func consoleToStrings(L State, from, to int) []string {
+	parts := make([]string, 0, to-from+1)
+	for i := from; i <= to; i++ {
+		L.GetGlobal("tostring")
+		L.PushValue(i)
+		if err := L.PCall(1, 1, 0); err != nil {
+			parts = append(parts, "<"+err.Error()+">")
+		} else {
+			parts = append(parts, L.GetString(-1))
+		}
+		L.Pop()
+	}
+	return parts
+}
@@ -0,0 +1,173 @@
+package glua_test
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Srlion/glua"
+	"github.com/Srlion/glua/gluatest"
+)
+
+// Sends a line to the console and runs frames until the next prompt, returns everything before it.
+func consoleSend(t *testing.T, L *gluatest.State, conn net.Conn, r *bufio.Reader, line string) string {
+	t.Helper()
+
+	if _, err := conn.Write([]byte(line + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	return consoleReply(t, L, r, line)
+}
+
+// Runs frames until the next prompt and returns everything up to it.
+func consoleReply(t *testing.T, L *gluatest.State, r *bufio.Reader, line string) string {
+	t.Helper()
+
+	type reply struct {
+		out string
+		err error
+	}
+	replies := make(chan reply, 1)
+	go func() {
+		var out strings.Builder
+		for {
+			b, err := r.ReadByte()
+			if err != nil {
+				replies <- reply{out.String(), err}
+				return
+			}
+			out.WriteByte(b)
+			// prompts don't end with a newline
+			if s := out.String(); strings.HasSuffix(s, "> ") && (len(s) == 2 || strings.HasSuffix(s, "\n> ") || strings.HasSuffix(s, ">> ")) {
+				replies <- reply{s, nil}
+				return
+			}
+		}
+	}()
+
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case res := <-replies:
+			if res.err != nil {
+				t.Fatalf("reading the reply to %q: %v (got %q)", line, res.err, res.out)
+			}
+			return res.out
+		case <-deadline:
+			t.Fatalf("no reply to %q", line)
+		default:
+			L.Flush()
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+func TestConsole(t *testing.T) {
+	L := gluatest.New(t)
+	L.Eval("original = {print = print, Msg = Msg, MsgN = MsgN, MsgC = MsgC}")
+
+	c, err := glua.StartConsole(glua.ConsoleOptions{Addr: "127.0.0.1:0", Token: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	conn, err := net.Dial("tcp", c.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	r := bufio.NewReader(conn)
+
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"secret", "> "},
+		{"1 + 1", "2\n> "},
+		{"return 1, 'a', nil", "1\ta\tnil\n> "},
+		{"x = 5", "> "},
+		{"print(x, 'printed')", "5\tprinted\n> "},
+		{"function f()", ">> "},
+		{"  return x * 2", ">> "},
+		{"end", "> "},
+		{"f()", "10\n> "},
+		{"Msg('a', 1) MsgN('b') MsgC({r = 255, g = 0, b = 0}, 'c', 2, '\\n')", "a1b\nc2\n> "},
+		{"error('boom')", "error: "},
+		{"local =", "error: "},
+	}
+	for _, tt := range tests {
+		got := consoleSend(t, L, conn, r, tt.line)
+		if !strings.HasPrefix(got, tt.want) || !strings.HasSuffix(got, "> ") {
+			t.Errorf("%q: got %q, want %q", tt.line, got, tt.want)
+		}
+	}
+
+	L.AssertGlobal("x", 5)
+	// the output functions are restored after every chunk
+	L.AssertGlobal("print == original.print and Msg == original.Msg and MsgN == original.MsgN and MsgC == original.MsgC", true)
+}
+
+func TestConsoleStreamsOutput(t *testing.T) {
+	L := gluatest.New(t)
+
+	c, err := glua.StartConsole(glua.ConsoleOptions{Addr: "127.0.0.1:0", Token: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	conn, err := net.Dial("tcp", c.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+	r := bufio.NewReader(conn)
+
+	consoleSend(t, L, conn, r, "secret")
+
+	// the chunk blocks until the client got what it printed before
+	streamed := make(chan string, 1)
+	waited := false
+	L.PushGoFunc(func(L glua.State) int {
+		waited = true
+		select {
+		case line := <-streamed:
+			if line != "before\n" {
+				t.Errorf("the client got %q while the chunk was running", line)
+			}
+		case <-time.After(5 * time.Second):
+			t.Error("the output wasn't sent while the chunk was running")
+		}
+		return 0
+	})
+	L.SetGlobal("wait_for_client")
+
+	line := "print('before') wait_for_client() Msg('after')"
+	if _, err := conn.Write([]byte(line + "\n")); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		line, _ := r.ReadString('\n')
+		streamed <- line
+	}()
+
+	deadline := time.After(5 * time.Second)
+	for !waited {
+		select {
+		case <-deadline:
+			t.Fatal("the chunk didn't run")
+		default:
+			L.Flush()
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	if got := consoleReply(t, L, r, line); got != "after> " {
+		t.Fatalf("got %q after the chunk finished, want %q", got, "after> ")
+	}
+}
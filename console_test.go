@@ -0,0 +1,106 @@
+package glua
+
+import (
+	"bufio"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStartConsoleOptions(t *testing.T) {
+	tests := []struct {
+		opts ConsoleOptions
+		err  string
+	}{
+		{ConsoleOptions{}, "a token is required"},
+		{ConsoleOptions{Addr: "0.0.0.0:0", Token: "x"}, "must be a loopback address"},
+		{ConsoleOptions{Addr: "example.com:0", Token: "x"}, "must be a loopback address"},
+		{ConsoleOptions{Network: "unix"}, "a socket path is required"},
+		{ConsoleOptions{Network: "udp", Addr: "127.0.0.1:0"}, "unsupported console network"},
+	}
+	for _, tt := range tests {
+		c, err := StartConsole(tt.opts)
+		if err == nil {
+			c.Close()
+			t.Errorf("StartConsole(%+v) succeeded, want %q", tt.opts, tt.err)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("StartConsole(%+v) = %q, want %q", tt.opts, err, tt.err)
+		}
+	}
+}
+
+// Connects to the console and returns a reader for its output, the connection is closed with the test.
+func dialConsole(t *testing.T, c *Console) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial(c.Addr().Network(), c.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn, bufio.NewReader(conn)
+}
+
+func TestConsoleRejectsInvalidToken(t *testing.T) {
+	c, err := StartConsole(ConsoleOptions{Addr: "127.0.0.1:0", Token: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	conn, r := dialConsole(t, c)
+	conn.Write([]byte("wrong\n"))
+
+	line, _ := r.ReadString('\n')
+	if line != "invalid token\n" {
+		t.Fatalf("got %q, want the token to be rejected", line)
+	}
+}
+
+func TestConsoleWithoutOpenState(t *testing.T) {
+	if IS_STATE_OPEN.Load() {
+		t.Skip("a Lua state is open")
+	}
+
+	c, err := StartConsole(ConsoleOptions{Network: "unix", Addr: filepath.Join(t.TempDir(), "console.sock")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	conn, r := dialConsole(t, c)
+	conn.Write([]byte("print(1)\n"))
+
+	out, _ := r.ReadString('\n')
+	if out != consolePrompt+"lua state is not open\n" {
+		t.Fatalf("got %q", out)
+	}
+}
+
+func TestConsoleCloseDisconnectsClients(t *testing.T) {
+	c, err := StartConsole(ConsoleOptions{Addr: "127.0.0.1:0", Token: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, r := dialConsole(t, c)
+	// wait for the connection to be served before closing
+	for {
+		c.mu.Lock()
+		n := len(c.conns)
+		c.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	c.Close()
+
+	if _, err := r.ReadString('\n'); err == nil {
+		t.Fatal("the connection is still open after Close")
+	}
+}
@@ -0,0 +1,297 @@
+package glua
+
+import (
+	"fmt"
+	"reflect"
+)
+
+/*
+Pushes a Go value onto the stack.
+
+  - nil -> nil
+  - bool, numbers, string -> boolean, number, string
+  - []byte -> string
+  - GoFunc -> function
+  - *LuaObject -> the Lua value it references
+  - slices and arrays -> sequences, maps -> tables
+  - other functions -> function, see WrapFunc
+  - structs and pointers to structs -> userdata, see Bind
+
+Returns an error (and pushes nothing) for anything else.
+*/
+func (L State) PushAny(v any) error {
+	if v == nil {
+		L.PushNil()
+		return nil
+	}
+
+	switch v := v.(type) {
+	case GoFunc:
+		L.PushGoFunc(v)
+		return nil
+	case []byte:
+		L.PushBinaryString(v)
+		return nil
+	case *LuaObject:
+		v.push(L)
+		return nil
+	case *Bound:
+		v.Push(L)
+		return nil
+	}
+
+	return L.pushReflect(reflect.ValueOf(v))
+}
+
+func (L State) pushReflect(rv reflect.Value) error {
+	switch rv.Kind() {
+	case reflect.Bool:
+		L.PushBool(rv.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		L.PushNumber(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		L.PushNumber(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		L.PushNumber(rv.Float())
+	case reflect.String:
+		L.PushString(rv.String())
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.IsNil() {
+			L.PushNil()
+			return nil
+		}
+		L.CreateTable(rv.Len(), 0)
+		for i := 0; i < rv.Len(); i++ {
+			if err := L.PushAny(rv.Index(i).Interface()); err != nil {
+				L.Pop()
+				return err
+			}
+			L.RawSetI(-2, i+1)
+		}
+	case reflect.Map:
+		if rv.IsNil() {
+			L.PushNil()
+			return nil
+		}
+		L.CreateTable(0, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			if err := L.PushAny(iter.Key().Interface()); err != nil {
+				L.Pop()
+				return err
+			}
+			if err := L.PushAny(iter.Value().Interface()); err != nil {
+				L.PopN(2)
+				return err
+			}
+			L.RawSet(-3)
+		}
+	case reflect.Func:
+		if rv.IsNil() {
+			L.PushNil()
+			return nil
+		}
+		L.PushGoFunc(WrapFunc(rv.Interface()))
+	case reflect.Struct:
+		Bind(rv.Interface()).Push(L)
+	case reflect.Pointer:
+		if rv.IsNil() {
+			L.PushNil()
+			return nil
+		}
+		if rv.Elem().Kind() == reflect.Struct {
+			Bind(rv.Interface()).Push(L)
+			return nil
+		}
+		return L.pushReflect(rv.Elem())
+	case reflect.Interface:
+		if rv.IsNil() {
+			L.PushNil()
+			return nil
+		}
+		return L.PushAny(rv.Elem().Interface())
+	default:
+		return fmt.Errorf("can't push %s to lua", rv.Type())
+	}
+
+	return nil
+}
+
+/*
+Converts the value at the given index to Go.
+
+  - nil -> nil
+  - boolean -> bool
+  - number -> float64
+  - string -> string
+  - table -> []any if it's a sequence, map[any]any otherwise
+  - functions, userdata and threads -> *LuaObject
+*/
+func (L State) ToAny(idx int) any {
+	return L.toAny(absIndex(L, idx), map[uintptr]bool{})
+}
+
+func (L State) toAny(idx int, visiting map[uintptr]bool) any {
+	switch L.Type(idx) {
+	case LUA_TNIL, LUA_TNONE:
+		return nil
+	case LUA_TBOOLEAN:
+		return L.GetBool(idx)
+	case LUA_TNUMBER:
+		return float64(L.GetNumber(idx))
+	case LUA_TSTRING:
+		return L.GetString(idx)
+	case LUA_TTABLE:
+		ptr := uintptr(L.GetPointer(idx))
+		if visiting[ptr] {
+			return L.NewLuaObject(idx) // cycles stay references instead of recursing forever
+		}
+		visiting[ptr] = true
+		defer delete(visiting, ptr)
+
+		m := map[any]any{}
+		L.PushNil()
+		for L.Next(idx) {
+			m[L.toAny(L.GetTop()-1, visiting)] = L.toAny(L.GetTop(), visiting)
+			L.Pop()
+		}
+		if seq, ok := anySequence(m); ok {
+			return seq
+		}
+		return m
+	default:
+		return L.NewLuaObject(idx)
+	}
+}
+
+func anySequence(m map[any]any) ([]any, bool) {
+	if len(m) == 0 {
+		return nil, false
+	}
+
+	seq := make([]any, len(m))
+	for k, v := range m {
+		n, ok := k.(float64)
+		if !ok || n != float64(int(n)) || n < 1 || int(n) > len(m) {
+			return nil, false
+		}
+		seq[int(n)-1] = v
+	}
+	return seq, true
+}
+
+// Converts the value at the given index to a Go value of type t, bound userdata give their Go value and interfaces
+// with an adapter (see RegisterAdapter) are implemented by the Lua value.
+func (L State) toType(idx int, t reflect.Type) (reflect.Value, error) {
+	idx = absIndex(L, idx)
+
+	if v, ok := L.toBound(idx); ok {
+		rv := reflect.ValueOf(v)
+		if rv.Type().AssignableTo(t) {
+			out := reflect.New(t).Elem()
+			out.Set(rv)
+			return out, nil
+		}
+		if rv.Type().Elem() == t {
+			return rv.Elem(), nil // bound values are pointers, by value arguments get a copy
+		}
+	}
+
+	if t.Kind() == reflect.Interface && t.NumMethod() > 0 && L.IsTable(idx) {
+		if v, ok, err := implementType(L, idx, t); ok {
+			return v, err
+		}
+	}
+
+	return convertAny(L.ToAny(idx), t)
+}
+
+// Converts a value returned by ToAny to type t.
+func convertAny(v any, t reflect.Type) (reflect.Value, error) {
+	if v == nil {
+		return reflect.Zero(t), nil
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Type().AssignableTo(t) {
+		out := reflect.New(t).Elem()
+		out.Set(rv)
+		return out, nil
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		if n, ok := v.(float64); ok {
+			return reflect.ValueOf(n).Convert(t), nil
+		}
+	case reflect.String:
+		if s, ok := v.(string); ok {
+			return reflect.ValueOf(s).Convert(t), nil
+		}
+	case reflect.Slice:
+		if s, ok := v.(string); ok && t.Elem().Kind() == reflect.Uint8 {
+			return reflect.ValueOf([]byte(s)).Convert(t), nil
+		}
+		if m, ok := v.(map[any]any); ok && len(m) == 0 {
+			return reflect.MakeSlice(t, 0, 0), nil
+		}
+		if seq, ok := v.([]any); ok {
+			out := reflect.MakeSlice(t, len(seq), len(seq))
+			for i, item := range seq {
+				ev, err := convertAny(item, t.Elem())
+				if err != nil {
+					return reflect.Value{}, fmt.Errorf("index %d: %w", i+1, err)
+				}
+				out.Index(i).Set(ev)
+			}
+			return out, nil
+		}
+	case reflect.Map:
+		var m map[any]any
+		switch v := v.(type) {
+		case map[any]any:
+			m = v
+		case []any:
+			m = make(map[any]any, len(v))
+			for i, item := range v {
+				m[float64(i+1)] = item
+			}
+		}
+		if m != nil {
+			out := reflect.MakeMapWithSize(t, len(m))
+			for k, item := range m {
+				kv, err := convertAny(k, t.Key())
+				if err != nil {
+					return reflect.Value{}, fmt.Errorf("key %v: %w", k, err)
+				}
+				ev, err := convertAny(item, t.Elem())
+				if err != nil {
+					return reflect.Value{}, fmt.Errorf("key %v: %w", k, err)
+				}
+				out.SetMapIndex(kv, ev)
+			}
+			return out, nil
+		}
+	}
+
+	return reflect.Value{}, fmt.Errorf("can't convert %s to %s", luaTypeNameOf(v), t)
+}
+
+func luaTypeNameOf(v any) string {
+	switch v.(type) {
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any, map[any]any:
+		return "table"
+	case *LuaObject:
+		return v.(*LuaObject).typeName
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
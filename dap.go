@@ -0,0 +1,902 @@
+package glua
+
+/*
+#include "c/glua.h"
+#include "c/debug_hook.h"
+*/
+import "C"
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// A Debug Adapter Protocol (https://microsoft.github.io/debug-adapter-protocol/) server, so editors like VS Code
+// can set breakpoints and step through Lua code.
+//
+// The Lua state is single threaded, so when the debugger stops, the main thread is blocked inside the line hook
+// and requests that need to touch the state (stack traces, variables, evaluate) are sent to it to run there.
+
+const DefaultDebugServerAddr = "127.0.0.1:21110"
+
+const debugThreadID = 1 // the Lua state only has one thread we can stop
+
+const (
+	stepNone = iota
+	stepIn
+	stepOver
+	stepOut
+)
+
+const (
+	debugVarLocals = iota
+	debugVarUpvalues
+	debugVarTable
+)
+
+type DebugServerOptions struct {
+	// Address to listen on, defaults to DefaultDebugServerAddr
+	Addr string
+	// Directory that relative Lua sources (eg. "addons/x/lua/y.lua") are resolved against when they can't be matched
+	// to a breakpoint path, usually the garrysmod folder
+	SourceRoot string
+}
+
+type DebugServer struct {
+	opts DebugServerOptions
+	ln   net.Listener
+
+	writeMu sync.Mutex
+	seq     int
+	conn    net.Conn
+
+	mu             sync.Mutex
+	attached       bool
+	breakpoints    map[string]map[int]bool // normalized client path -> lines
+	sourcePaths    map[string]string       // lua file source -> client path, "" if it has no breakpoints
+	stepMode       int
+	stepDepth      int
+	pauseRequested bool
+
+	stopped   atomic.Bool
+	mainCalls chan func(L State)
+	resume    chan int // step mode to resume with
+	done      chan struct{}
+	closeOnce sync.Once
+
+	varRefs []debugVarRef // only touched on the main thread while stopped
+}
+
+type debugVarRef struct {
+	kind  int
+	level int
+	ref   int
+}
+
+type dapMessage struct {
+	Seq        int             `json:"seq"`
+	Type       string          `json:"type"`
+	Command    string          `json:"command,omitempty"`
+	Event      string          `json:"event,omitempty"`
+	RequestSeq int             `json:"request_seq,omitempty"`
+	Success    *bool           `json:"success,omitempty"`
+	Message    string          `json:"message,omitempty"`
+	Arguments  json.RawMessage `json:"arguments,omitempty"`
+	Body       any             `json:"body,omitempty"`
+}
+
+type dapVariable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	Type               string `json:"type,omitempty"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+var activeDebugServer atomic.Pointer[DebugServer]
+
+/*
+Starts a Debug Adapter Protocol server listening on a local TCP port.
+
+Only one server can be running at a time and only one client can be connected to it.
+
+The line hook is only installed while a client is attached, because LuaJIT doesn't compile traces while hooks are
+active. Attaching and detaching happen through the think queue, so the server only starts working once the think
+queue runs (or PollThinkQueue is called in headless states).
+
+# Example
+
+	srv, err := L.StartDebugServer(glua.DebugServerOptions{SourceRoot: "garrysmod"})
+	if err != nil {
+		fmt.Println(err)
+		return 0
+	}
+
+	// in gmod13_close
+	srv.Close(L)
+
+Then point VS Code at it with an "attach" configuration using `"debugServer": 21110`.
+*/
+func (L State) StartDebugServer(opts DebugServerOptions) (*DebugServer, error) {
+	if !HasFeature("lua_sethook") {
+		return nil, errors.New("lua_shared doesn't export lua_sethook, the debugger can't work without it")
+	}
+
+	if opts.Addr == "" {
+		opts.Addr = DefaultDebugServerAddr
+	}
+
+	s := &DebugServer{
+		opts:        opts,
+		breakpoints: map[string]map[int]bool{},
+		sourcePaths: map[string]string{},
+		mainCalls:   make(chan func(L State)),
+		resume:      make(chan int),
+		done:        make(chan struct{}),
+	}
+
+	if !activeDebugServer.CompareAndSwap(nil, s) {
+		return nil, errors.New("debug server is already running")
+	}
+
+	ln, err := net.Listen("tcp", opts.Addr)
+	if err != nil {
+		activeDebugServer.Store(nil)
+		return nil, err
+	}
+	s.ln = ln
+
+	C.debug_hook_clear_lines()
+	C.debug_hook_set_mode(C.DEBUG_HOOK_OFF)
+
+	go s.acceptLoop()
+
+	return s, nil
+}
+
+// Returns the address the server is listening on, useful when listening on port 0.
+func (s *DebugServer) Addr() net.Addr {
+	return s.ln.Addr()
+}
+
+/*
+Stops the server, disconnects the client and removes the hook.
+
+It must be called from the main thread, eg. in gmod13_close.
+*/
+func (s *DebugServer) Close(L State) error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.done)
+		err = s.ln.Close()
+
+		s.writeMu.Lock()
+		if s.conn != nil {
+			s.conn.Close()
+		}
+		s.writeMu.Unlock()
+
+		C.debug_hook_set_mode(C.DEBUG_HOOK_OFF)
+		C.debug_hook_clear_lines()
+		L.setDebugHook(false)
+
+		activeDebugServer.CompareAndSwap(s, nil)
+	})
+	return err
+}
+
+func (L State) setDebugHook(enabled bool) {
+	if enabled {
+		C.lua_sethook_wrap(L.c(), C.lua_Hook(C.debug_hook), LUA_MASKLINE, 0)
+	} else {
+		C.lua_sethook_wrap(L.c(), nil, 0, 0)
+	}
+}
+
+func (s *DebugServer) acceptLoop() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+
+		s.writeMu.Lock()
+		busy := s.conn != nil
+		if !busy {
+			s.conn = conn
+			s.seq = 0
+		}
+		s.writeMu.Unlock()
+
+		if busy {
+			conn.Close()
+			continue
+		}
+
+		s.serve(conn)
+
+		s.writeMu.Lock()
+		s.conn = nil
+		s.writeMu.Unlock()
+		conn.Close()
+	}
+}
+
+func (s *DebugServer) serve(conn net.Conn) {
+	defer s.detach()
+
+	r := bufio.NewReader(conn)
+	for {
+		msg, err := readDAPMessage(r)
+		if err != nil {
+			return
+		}
+		if msg.Type != "request" {
+			continue
+		}
+		if !s.handleRequest(msg) {
+			return
+		}
+	}
+}
+
+func readDAPMessage(r *bufio.Reader) (*dapMessage, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	length, err := strconv.Atoi(header.Get("Content-Length"))
+	if err != nil || length < 0 {
+		return nil, errors.New("invalid Content-Length header")
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	msg := &dapMessage{}
+	if err := json.Unmarshal(body, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (s *DebugServer) send(msg *dapMessage) {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	if s.conn == nil {
+		return
+	}
+
+	s.seq++
+	msg.Seq = s.seq
+
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+
+	fmt.Fprintf(s.conn, "Content-Length: %d\r\n\r\n", len(body))
+	s.conn.Write(body)
+}
+
+func (s *DebugServer) respond(req *dapMessage, body any) {
+	success := true
+	s.send(&dapMessage{Type: "response", RequestSeq: req.Seq, Command: req.Command, Success: &success, Body: body})
+}
+
+func (s *DebugServer) respondError(req *dapMessage, err string) {
+	success := false
+	s.send(&dapMessage{Type: "response", RequestSeq: req.Seq, Command: req.Command, Success: &success, Message: err})
+}
+
+func (s *DebugServer) sendEvent(event string, body any) {
+	s.send(&dapMessage{Type: "event", Event: event, Body: body})
+}
+
+// Runs fn on the main thread while it's stopped, returns false if it's not stopped.
+func (s *DebugServer) onMain(fn func(L State)) bool {
+	if !s.stopped.Load() {
+		return false
+	}
+
+	done := make(chan struct{})
+	select {
+	case s.mainCalls <- func(L State) { defer close(done); fn(L) }:
+	case <-s.done:
+		return false
+	}
+
+	select {
+	case <-done:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+func (s *DebugServer) resumeWith(mode int) {
+	if !s.stopped.Load() {
+		return
+	}
+
+	select {
+	case s.resume <- mode:
+	case <-s.done:
+	}
+}
+
+// Returns false when the client asked to disconnect.
+func (s *DebugServer) handleRequest(req *dapMessage) bool {
+	switch req.Command {
+	case "initialize":
+		s.respond(req, map[string]any{
+			"supportsConfigurationDoneRequest": true,
+			"supportsEvaluateForHovers":        true,
+		})
+		s.sendEvent("initialized", nil)
+	case "attach", "launch":
+		s.attach()
+		s.respond(req, nil)
+	case "setBreakpoints":
+		s.setBreakpoints(req)
+	case "setExceptionBreakpoints", "configurationDone":
+		s.respond(req, nil)
+	case "threads":
+		s.respond(req, map[string]any{
+			"threads": []map[string]any{{"id": debugThreadID, "name": "main"}},
+		})
+	case "stackTrace":
+		s.stackTrace(req)
+	case "scopes":
+		s.scopes(req)
+	case "variables":
+		s.variables(req)
+	case "evaluate":
+		s.evaluate(req)
+	case "continue":
+		s.respond(req, map[string]any{"allThreadsContinued": true})
+		s.resumeWith(stepNone)
+	case "next":
+		s.respond(req, nil)
+		s.resumeWith(stepOver)
+	case "stepIn":
+		s.respond(req, nil)
+		s.resumeWith(stepIn)
+	case "stepOut":
+		s.respond(req, nil)
+		s.resumeWith(stepOut)
+	case "pause":
+		s.mu.Lock()
+		s.pauseRequested = true
+		s.mu.Unlock()
+		C.debug_hook_set_mode(C.DEBUG_HOOK_ALL)
+		s.respond(req, nil)
+	case "disconnect", "terminate":
+		s.respond(req, nil)
+		return false
+	default:
+		s.respondError(req, "unsupported request: "+req.Command)
+	}
+
+	return true
+}
+
+func (s *DebugServer) attach() {
+	s.mu.Lock()
+	already := s.attached
+	s.attached = true
+	s.mu.Unlock()
+
+	if already {
+		return
+	}
+
+	s.updateHookMode()
+	WaitLuaThink(func(L State) int {
+		L.setDebugHook(true)
+		return 0
+	})
+}
+
+func (s *DebugServer) detach() {
+	s.mu.Lock()
+	wasAttached := s.attached
+	s.attached = false
+	s.breakpoints = map[string]map[int]bool{}
+	s.sourcePaths = map[string]string{}
+	s.stepMode = stepNone
+	s.pauseRequested = false
+	s.mu.Unlock()
+
+	C.debug_hook_set_mode(C.DEBUG_HOOK_OFF)
+	C.debug_hook_clear_lines()
+
+	s.resumeWith(stepNone)
+
+	if wasAttached {
+		WaitLuaThink(func(L State) int {
+			L.setDebugHook(false)
+			return 0
+		})
+	}
+}
+
+// Picks the cheapest hook mode for the current state, must be called without s.mu held.
+func (s *DebugServer) updateHookMode() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case !s.attached:
+		C.debug_hook_set_mode(C.DEBUG_HOOK_OFF)
+	case s.pauseRequested || s.stepMode != stepNone:
+		C.debug_hook_set_mode(C.DEBUG_HOOK_ALL)
+	default:
+		C.debug_hook_set_mode(C.DEBUG_HOOK_BREAKPOINTS)
+	}
+}
+
+func normalizeDebugPath(path string) string {
+	path = strings.TrimPrefix(path, "@")
+	path = filepath.ToSlash(path)
+	path = strings.TrimPrefix(path, "./")
+	return strings.ToLower(path)
+}
+
+func (s *DebugServer) setBreakpoints(req *dapMessage) {
+	var args struct {
+		Source struct {
+			Path string `json:"path"`
+		} `json:"source"`
+		Breakpoints []struct {
+			Line int `json:"line"`
+		} `json:"breakpoints"`
+	}
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		s.respondError(req, err.Error())
+		return
+	}
+
+	lines := map[int]bool{}
+	result := make([]map[string]any, 0, len(args.Breakpoints))
+	for _, bp := range args.Breakpoints {
+		lines[bp.Line] = true
+		result = append(result, map[string]any{"verified": true, "line": bp.Line})
+	}
+
+	s.mu.Lock()
+	path := normalizeDebugPath(args.Source.Path)
+	if len(lines) == 0 {
+		delete(s.breakpoints, path)
+	} else {
+		s.breakpoints[path] = lines
+	}
+	s.sourcePaths = map[string]string{}
+
+	C.debug_hook_clear_lines()
+	for _, lines := range s.breakpoints {
+		for line := range lines {
+			C.debug_hook_set_line(C.int(line), 1)
+		}
+	}
+	s.mu.Unlock()
+
+	s.updateHookMode()
+	s.respond(req, map[string]any{"breakpoints": result})
+}
+
+// Finds the breakpoint path that a Lua source belongs to, must be called with s.mu held.
+//
+// Only file sources ("@path") can have breakpoints and are cached, chunks loaded from strings would make the cache
+// grow forever.
+func (s *DebugServer) clientPath(source string) string {
+	if !strings.HasPrefix(source, "@") {
+		return ""
+	}
+
+	if path, ok := s.sourcePaths[source]; ok {
+		return path
+	}
+
+	path := ""
+	src := normalizeDebugPath(source)
+	for clientPath := range s.breakpoints {
+		if clientPath == src || strings.HasSuffix(clientPath, "/"+src) {
+			path = clientPath
+			break
+		}
+	}
+
+	s.sourcePaths[source] = path
+	return path
+}
+
+//export goDebugHook
+func goDebugHook(L State, ar *C.lua_Debug) {
+	s := activeDebugServer.Load()
+	if s == nil || s.stopped.Load() || ar.event != LUA_HOOKLINE {
+		return
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Println("[ERROR] debug hook: ", r)
+		}
+	}()
+
+	s.onLine(L, ar)
+}
+
+func (s *DebugServer) onLine(L State, ar *C.lua_Debug) {
+	reason := ""
+
+	s.mu.Lock()
+	if s.pauseRequested {
+		reason = "pause"
+	} else if s.stepMode != stepNone {
+		depth := L.StackDepth()
+		switch s.stepMode {
+		case stepIn:
+			reason = "step"
+		case stepOver:
+			if depth <= s.stepDepth {
+				reason = "step"
+			}
+		case stepOut:
+			if depth < s.stepDepth {
+				reason = "step"
+			}
+		}
+	}
+
+	if reason == "" && len(s.breakpoints) > 0 {
+		cWhat := CStr("S")
+		C.lua_getinfo_wrap(L.c(), cWhat.c, ar)
+		cWhat.free()
+
+		path := s.clientPath(newDebugInfo(ar).Source)
+		if path != "" && s.breakpoints[path][int(ar.currentline)] {
+			reason = "breakpoint"
+		}
+	}
+	s.mu.Unlock()
+
+	if reason != "" {
+		s.stop(L, reason)
+	}
+}
+
+// Blocks the main thread until the client resumes it.
+func (s *DebugServer) stop(L State, reason string) {
+	s.mu.Lock()
+	s.pauseRequested = false
+	s.stepMode = stepNone
+	s.mu.Unlock()
+
+	top := L.GetTop()
+	s.stopped.Store(true)
+	s.sendEvent("stopped", map[string]any{
+		"reason":            reason,
+		"threadId":          debugThreadID,
+		"allThreadsStopped": true,
+	})
+
+	mode := stepNone
+loop:
+	for {
+		select {
+		case fn := <-s.mainCalls:
+			fn(L)
+			L.SetTop(top)
+		case mode = <-s.resume:
+			break loop
+		case <-s.done:
+			break loop
+		}
+	}
+
+	s.releaseVarRefs(L)
+
+	s.mu.Lock()
+	s.stepMode = mode
+	if mode == stepOver || mode == stepOut {
+		s.stepDepth = L.StackDepth()
+	}
+	s.mu.Unlock()
+
+	s.stopped.Store(false)
+	s.updateHookMode()
+}
+
+func (s *DebugServer) newVarRef(ref debugVarRef) int {
+	s.varRefs = append(s.varRefs, ref)
+	return len(s.varRefs)
+}
+
+func (s *DebugServer) releaseVarRefs(L State) {
+	for _, ref := range s.varRefs {
+		if ref.kind == debugVarTable {
+			L.DeleteRef(ref.ref)
+		}
+	}
+	s.varRefs = nil
+}
+
+func (s *DebugServer) stackTrace(req *dapMessage) {
+	var args struct {
+		StartFrame int `json:"startFrame"`
+		Levels     int `json:"levels"`
+	}
+	json.Unmarshal(req.Arguments, &args)
+
+	frames := []map[string]any{}
+	total := 0
+	ok := s.onMain(func(L State) {
+		total = L.StackDepth()
+		end := total
+		if args.Levels > 0 && args.StartFrame+args.Levels < end {
+			end = args.StartFrame + args.Levels
+		}
+
+		for level := args.StartFrame; level < end; level++ {
+			info, ok := L.GetInfo(level, "nSl")
+			if !ok {
+				break
+			}
+			frames = append(frames, s.stackFrame(level, info))
+		}
+	})
+	if !ok {
+		s.respondError(req, "not stopped")
+		return
+	}
+
+	s.respond(req, map[string]any{"stackFrames": frames, "totalFrames": total})
+}
+
+func (s *DebugServer) stackFrame(level int, info DebugInfo) map[string]any {
+	name := info.Name
+	switch {
+	case name != "":
+	case info.What == "main":
+		name = "main chunk"
+	default:
+		name = "?"
+	}
+
+	frame := map[string]any{
+		"id":     level + 1,
+		"name":   name,
+		"line":   max(info.CurrentLine, 0),
+		"column": 0,
+	}
+
+	if !strings.HasPrefix(info.Source, "@") {
+		frame["presentationHint"] = "subtle"
+		return frame
+	}
+
+	s.mu.Lock()
+	path := s.clientPath(info.Source)
+	s.mu.Unlock()
+
+	if path == "" {
+		path = strings.TrimPrefix(info.Source, "@")
+		if s.opts.SourceRoot != "" && !filepath.IsAbs(path) {
+			path = filepath.Join(s.opts.SourceRoot, path)
+		}
+	}
+
+	frame["source"] = map[string]any{"name": filepath.Base(path), "path": path}
+	return frame
+}
+
+func (s *DebugServer) scopes(req *dapMessage) {
+	var args struct {
+		FrameID int `json:"frameId"`
+	}
+	json.Unmarshal(req.Arguments, &args)
+
+	var scopes []map[string]any
+	ok := s.onMain(func(L State) {
+		level := args.FrameID - 1
+		scopes = []map[string]any{
+			{"name": "Locals", "variablesReference": s.newVarRef(debugVarRef{kind: debugVarLocals, level: level}), "expensive": false},
+			{"name": "Upvalues", "variablesReference": s.newVarRef(debugVarRef{kind: debugVarUpvalues, level: level}), "expensive": false},
+		}
+	})
+	if !ok {
+		s.respondError(req, "not stopped")
+		return
+	}
+
+	s.respond(req, map[string]any{"scopes": scopes})
+}
+
+func (s *DebugServer) variables(req *dapMessage) {
+	var args struct {
+		VariablesReference int `json:"variablesReference"`
+	}
+	json.Unmarshal(req.Arguments, &args)
+
+	vars := []dapVariable{}
+	ok := s.onMain(func(L State) {
+		if args.VariablesReference < 1 || args.VariablesReference > len(s.varRefs) {
+			return
+		}
+
+		ref := s.varRefs[args.VariablesReference-1]
+		switch ref.kind {
+		case debugVarLocals:
+			for name, idx := range L.Locals(ref.level) {
+				if !strings.HasPrefix(name, "(") { // (*temporary) and friends
+					vars = append(vars, s.variable(L, name, idx))
+				}
+			}
+		case debugVarUpvalues:
+			if !L.PushStackFunction(ref.level) {
+				return
+			}
+			for name, idx := range L.Upvalues(-1) {
+				if name == "" { // C functions don't have upvalue names
+					name = "?"
+				}
+				vars = append(vars, s.variable(L, name, idx))
+			}
+			L.Pop()
+		case debugVarTable:
+			L.FromRef(ref.ref)
+			t := L.GetTop()
+			L.PushNil()
+			for L.Next(t) {
+				vars = append(vars, s.variable(L, s.keyName(L, -2), -1))
+				L.Pop()
+			}
+			L.Pop()
+		}
+	})
+	if !ok {
+		s.respondError(req, "not stopped")
+		return
+	}
+
+	s.respond(req, map[string]any{"variables": vars})
+}
+
+func (s *DebugServer) keyName(L State, idx int) string {
+	switch L.Type(idx) {
+	case LUA_TSTRING:
+		return L.GetString(idx)
+	case LUA_TNUMBER:
+		return "[" + formatDebugNumber(L.GetNumber(idx)) + "]"
+	default:
+		return "[" + s.describe(L, idx) + "]"
+	}
+}
+
+// Builds a variable from the value at idx, tables get a reference so they can be expanded.
+func (s *DebugServer) variable(L State, name string, idx int) dapVariable {
+	v := dapVariable{
+		Name:  name,
+		Value: s.describe(L, idx),
+		Type:  L.TypeName(L.Type(idx)),
+	}
+
+	if L.IsTable(idx) {
+		L.PushValue(idx)
+		v.VariablesReference = s.newVarRef(debugVarRef{kind: debugVarTable, ref: L.CreateRef()})
+	}
+
+	return v
+}
+
+// Describes a value without calling any metamethods, so inspecting can't run Lua code.
+func (s *DebugServer) describe(L State, idx int) string {
+	switch t := L.Type(idx); t {
+	case LUA_TNIL, LUA_TNONE:
+		return "nil"
+	case LUA_TBOOLEAN:
+		return strconv.FormatBool(L.GetBool(idx))
+	case LUA_TNUMBER:
+		return formatDebugNumber(L.GetNumber(idx))
+	case LUA_TSTRING:
+		str := L.GetString(idx)
+		if len(str) > 512 {
+			str = str[:512] + "..."
+		}
+		return strconv.Quote(str)
+	default:
+		return fmt.Sprintf("%s: %p", L.TypeName(t), L.GetPointer(idx))
+	}
+}
+
+func formatDebugNumber(n LUA_NUMBER) string {
+	return strconv.FormatFloat(float64(n), 'g', -1, 64)
+}
+
+func (s *DebugServer) evaluate(req *dapMessage) {
+	var args struct {
+		Expression string `json:"expression"`
+		FrameID    int    `json:"frameId"`
+	}
+	if err := json.Unmarshal(req.Arguments, &args); err != nil {
+		s.respondError(req, err.Error())
+		return
+	}
+
+	var result dapVariable
+	var evalErr error
+	ok := s.onMain(func(L State) {
+		if err := L.CompileString("return " + args.Expression); err != nil {
+			L.Pop()
+			if evalErr = L.CompileString(args.Expression); evalErr != nil {
+				return
+			}
+		}
+
+		if args.FrameID > 0 {
+			s.pushFrameEnv(L, args.FrameID-1)
+			L.SetFEnv(-2)
+		}
+
+		if evalErr = L.PCall(0, 1, 0); evalErr != nil {
+			return
+		}
+		result = s.variable(L, "", -1)
+	})
+	if !ok {
+		s.respondError(req, "not stopped")
+		return
+	}
+	if evalErr != nil {
+		s.respondError(req, evalErr.Error())
+		return
+	}
+
+	s.respond(req, map[string]any{
+		"result":             result.Value,
+		"type":               result.Type,
+		"variablesReference": result.VariablesReference,
+	})
+}
+
+// Pushes a table with the upvalues and locals of the function at level, falling back to globals.
+func (s *DebugServer) pushFrameEnv(L State, level int) {
+	L.NewTable()
+
+	env := L.GetTop()
+
+	if L.PushStackFunction(level) {
+		for name, idx := range L.Upvalues(-1) {
+			if name != "" {
+				L.PushValue(idx)
+				L.SetField(env, name)
+			}
+		}
+		L.Pop()
+	}
+
+	for name, idx := range L.Locals(level) {
+		if !strings.HasPrefix(name, "(") {
+			L.PushValue(idx)
+			L.SetField(env, name)
+		}
+	}
+
+	L.NewTable()
+	L.PushValue(LUA_GLOBALSINDEX)
+	L.SetField(-2, "__index")
+	L.SetMetatable(-2)
+}
@@ -0,0 +1,136 @@
+package glua_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Srlion/glua"
+	"github.com/Srlion/glua/gluatest"
+)
+
+type dapClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+	seq  int
+}
+
+type dapMsg struct {
+	Type    string          `json:"type"`
+	Command string          `json:"command"`
+	Event   string          `json:"event"`
+	Success bool            `json:"success"`
+	Body    json.RawMessage `json:"body"`
+}
+
+func (c *dapClient) send(command string, args any) {
+	c.seq++
+	body, _ := json.Marshal(map[string]any{"seq": c.seq, "type": "request", "command": command, "arguments": args})
+	fmt.Fprintf(c.conn, "Content-Length: %d\r\n\r\n%s", len(body), body)
+}
+
+// Reads messages until one matches, skipping the others.
+func (c *dapClient) wait(typ, name string) dapMsg {
+	for {
+		header, err := textproto.NewReader(c.r).ReadMIMEHeader()
+		if err != nil {
+			c.t.Errorf("waiting for %s %s: %v", typ, name, err)
+			return dapMsg{}
+		}
+		length, _ := strconv.Atoi(header.Get("Content-Length"))
+		body := make([]byte, length)
+		if _, err := io.ReadFull(c.r, body); err != nil {
+			c.t.Errorf("waiting for %s %s: %v", typ, name, err)
+			return dapMsg{}
+		}
+
+		var msg dapMsg
+		json.Unmarshal(body, &msg)
+		if msg.Type == typ && (msg.Command == name || msg.Event == name) {
+			return msg
+		}
+	}
+}
+
+func (c *dapClient) request(command string, args any) dapMsg {
+	c.send(command, args)
+	res := c.wait("response", command)
+	if !res.Success {
+		c.t.Errorf("%s failed: %s", command, res.Body)
+	}
+	return res
+}
+
+func TestDebugServerBreakpoint(t *testing.T) {
+	L := gluatest.New(t)
+	if !glua.HasFeature("lua_sethook") {
+		t.Skip("lua_shared doesn't export lua_sethook")
+	}
+
+	srv, err := L.StartDebugServer(glua.DebugServerOptions{Addr: "127.0.0.1:0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Close(L.State)
+
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	c := &dapClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+	c.request("initialize", map[string]any{"adapterID": "glua"})
+	c.request("attach", nil)
+	L.Flush() // installs the hook
+
+	c.request("setBreakpoints", map[string]any{
+		"source":      map[string]any{"path": "/project/lua/test.lua"},
+		"breakpoints": []map[string]any{{"line": 3}},
+	})
+
+	type frame struct {
+		Name string `json:"name"`
+		Line int    `json:"line"`
+	}
+	frames := make(chan []frame, 1)
+	go func() {
+		c.wait("event", "stopped")
+
+		res := c.request("stackTrace", map[string]any{"threadId": 1})
+		var body struct {
+			StackFrames []frame `json:"stackFrames"`
+		}
+		json.Unmarshal(res.Body, &body)
+		frames <- body.StackFrames
+
+		c.request("continue", map[string]any{"threadId": 1})
+	}()
+
+	code := "local x = 1\nx = x + 1\nresult = x * 10\n"
+	if err := L.CompileBuffer([]byte(code), "@lua/test.lua"); err != nil {
+		t.Fatal(err)
+	}
+	if err := L.PCall(0, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case got := <-frames:
+		if len(got) == 0 || got[0].Line != 3 {
+			t.Fatalf("stopped at %+v, want line 3", got)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the breakpoint wasn't hit")
+	}
+
+	L.AssertGlobal("result", 20)
+}
@@ -0,0 +1,27 @@
+package glua
+
+import "testing"
+
+func TestClientPathCachesFileSourcesOnly(t *testing.T) {
+	s := &DebugServer{
+		breakpoints: map[string]map[int]bool{"/project/lua/autorun/init.lua": {3: true}},
+		sourcePaths: map[string]string{},
+	}
+
+	if got := s.clientPath("@lua/autorun/init.lua"); got != "/project/lua/autorun/init.lua" {
+		t.Fatalf("clientPath = %q", got)
+	}
+	if got := s.clientPath("@lua/other.lua"); got != "" {
+		t.Fatalf("clientPath of a file without breakpoints = %q", got)
+	}
+
+	for i := 0; i < 100; i++ {
+		if got := s.clientPath("return " + string(rune('a'+i%26))); got != "" {
+			t.Fatalf("clientPath of a string chunk = %q", got)
+		}
+	}
+
+	if len(s.sourcePaths) != 2 {
+		t.Fatalf("%d sources cached, want the 2 file sources", len(s.sourcePaths))
+	}
+}
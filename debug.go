@@ -0,0 +1,330 @@
+package glua
+
+/*
+#include "c/glua.h"
+*/
+import "C"
+import "iter"
+
+const (
+	LUA_HOOKCALL    = 0
+	LUA_HOOKRET     = 1
+	LUA_HOOKLINE    = 2
+	LUA_HOOKCOUNT   = 3
+	LUA_HOOKTAILRET = 4
+)
+
+const (
+	LUA_MASKCALL  = 1 << LUA_HOOKCALL
+	LUA_MASKRET   = 1 << LUA_HOOKRET
+	LUA_MASKLINE  = 1 << LUA_HOOKLINE
+	LUA_MASKCOUNT = 1 << LUA_HOOKCOUNT
+)
+
+// DebugInfo is the Go side copy of lua_Debug, only the fields requested with "what" are filled.
+type DebugInfo struct {
+	Name            string // (n)
+	NameWhat        string // (n) "global", "local", "field", "method"
+	What            string // (S) "Lua", "C", "main", "tail"
+	Source          string // (S)
+	ShortSrc        string // (S)
+	CurrentLine     int    // (l)
+	NUps            int    // (u) number of upvalues
+	LineDefined     int    // (S)
+	LastLineDefined int    // (S)
+}
+
+func newDebugInfo(ar *C.lua_Debug) DebugInfo {
+	info := DebugInfo{
+		CurrentLine:     int(ar.currentline),
+		NUps:            int(ar.nups),
+		LineDefined:     int(ar.linedefined),
+		LastLineDefined: int(ar.lastlinedefined),
+		ShortSrc:        C.GoString(&ar.short_src[0]),
+	}
+	if ar.name != nil {
+		info.Name = C.GoString(ar.name)
+	}
+	if ar.namewhat != nil {
+		info.NameWhat = C.GoString(ar.namewhat)
+	}
+	if ar.what != nil {
+		info.What = C.GoString(ar.what)
+	}
+	if ar.source != nil {
+		info.Source = C.GoString(ar.source)
+	}
+	return info
+}
+
+/*
+Returns information about the function running at the given level of the call stack.
+
+Level 0 is the current running function, level n+1 is the function that has called level n.
+
+what selects the fields to fill, same as lua_getinfo: "n", "S", "l", "u" (and "f" to push the function onto the stack).
+
+Returns false if the level is greater than the stack depth.
+
+# Example
+
+	info, ok := L.GetInfo(1, "Sl")
+	if ok {
+		fmt.Println(info.ShortSrc, info.CurrentLine)
+	}
+*/
+func (L State) GetInfo(level int, what string) (DebugInfo, bool) {
+	var ar C.lua_Debug
+	if C.lua_getstack_wrap(L.c(), C.int(level), &ar) == 0 {
+		return DebugInfo{}, false
+	}
+
+	cWhat := CStr(what)
+	defer cWhat.free()
+
+	if C.lua_getinfo_wrap(L.c(), cWhat.c, &ar) == 0 {
+		return DebugInfo{}, false
+	}
+
+	return newDebugInfo(&ar), true
+}
+
+/*
+Returns the number of active levels in the call stack.
+*/
+func (L State) StackDepth() int {
+	var ar C.lua_Debug
+	depth := 0
+	for C.lua_getstack_wrap(L.c(), C.int(depth), &ar) != 0 {
+		depth++
+	}
+	return depth
+}
+
+func absIndex(L State, idx int) int {
+	if idx < 0 && idx > LUA_REGISTRYINDEX {
+		return L.GetTop() + idx + 1
+	}
+	return idx
+}
+
+/*
+Gets the name of local variable n (starting at 1) of the function at the given level and pushes its value onto the
+stack. Level 0 is the running function, so inside a Go function level 1 is the Lua function that called it.
+
+Returns false and pushes nothing if the level or the local doesn't exist, or if lua_shared doesn't export
+lua_getlocal. Names starting with "(" are internal values like "(*temporary)".
+
+# Example
+
+	name, ok := L.GetLocal(1, 1)
+	if ok {
+		fmt.Println(name, L.TypeName(L.Type(-1)))
+		L.Pop()
+	}
+*/
+func (L State) GetLocal(level, n int) (string, bool) {
+	if !HasFeature("lua_getlocal") {
+		return "", false
+	}
+
+	var ar C.lua_Debug
+	if C.lua_getstack_wrap(L.c(), C.int(level), &ar) == 0 {
+		return "", false
+	}
+
+	name := C.lua_getlocal_wrap(L.c(), &ar, C.int(n))
+	if name == nil {
+		return "", false
+	}
+
+	return C.GoString(name), true
+}
+
+/*
+Pops a value from the stack and assigns it to local variable n of the function at the given level, see GetLocal.
+
+Returns the name of the local, or false if it doesn't exist (the value is popped either way).
+*/
+func (L State) SetLocal(level, n int) (string, bool) {
+	if !HasFeature("lua_setlocal") {
+		L.Pop()
+		return "", false
+	}
+
+	var ar C.lua_Debug
+	if C.lua_getstack_wrap(L.c(), C.int(level), &ar) == 0 {
+		L.Pop()
+		return "", false
+	}
+
+	// lua_setlocal pops the value even if the local doesn't exist
+	name := C.lua_setlocal_wrap(L.c(), &ar, C.int(n))
+	if name == nil {
+		return "", false
+	}
+
+	return C.GoString(name), true
+}
+
+/*
+Gets the name of upvalue n (starting at 1) of the function at the given index and pushes its value onto the stack.
+
+Upvalues of C functions have an empty name. Returns false and pushes nothing if the upvalue doesn't exist, or if
+lua_shared doesn't export lua_getupvalue.
+
+# Example
+
+	// callback is a Lua function passed to us
+	L.CheckFunc(1)
+	name, ok := L.GetUpvalue(1, 1)
+	if ok {
+		fmt.Println(name, L.TypeName(L.Type(-1)))
+		L.Pop()
+	}
+*/
+func (L State) GetUpvalue(funcIdx, n int) (string, bool) {
+	if !HasFeature("lua_getupvalue") {
+		return "", false
+	}
+
+	name := C.lua_getupvalue_wrap(L.c(), C.int(funcIdx), C.int(n))
+	if name == nil {
+		return "", false
+	}
+
+	return C.GoString(name), true
+}
+
+/*
+Pops a value from the stack and assigns it to upvalue n of the function at the given index, see GetUpvalue.
+
+Returns the name of the upvalue, or false if it doesn't exist (the value is popped either way).
+*/
+func (L State) SetUpvalue(funcIdx, n int) (string, bool) {
+	funcIdx = absIndex(L, funcIdx)
+
+	if !HasFeature("lua_setupvalue") {
+		L.Pop()
+		return "", false
+	}
+
+	name := C.lua_setupvalue_wrap(L.c(), C.int(funcIdx), C.int(n))
+	if name == nil {
+		L.Pop() // lua_setupvalue only pops when it assigns
+		return "", false
+	}
+
+	return C.GoString(name), true
+}
+
+/*
+Iterates over the locals of the function at the given level, yielding the name and the stack index of the value.
+
+The value is only on the stack while the loop body runs, it's popped before the next local.
+
+# Example
+
+	for name, idx := range L.Locals(1) {
+		fmt.Println(name, L.TypeName(L.Type(idx)))
+	}
+*/
+func (L State) Locals(level int) iter.Seq2[string, int] {
+	return func(yield func(string, int) bool) {
+		for n := 1; ; n++ {
+			name, ok := L.GetLocal(level, n)
+			if !ok {
+				return
+			}
+
+			cont := yield(name, L.GetTop())
+			L.Pop()
+			if !cont {
+				return
+			}
+		}
+	}
+}
+
+/*
+Iterates over the upvalues of the function at the given index, yielding the name and the stack index of the value.
+
+The value is only on the stack while the loop body runs, it's popped before the next upvalue.
+
+# Example
+
+	for name, idx := range L.Upvalues(1) {
+		fmt.Println(name, L.TypeName(L.Type(idx)))
+	}
+*/
+func (L State) Upvalues(funcIdx int) iter.Seq2[string, int] {
+	funcIdx = absIndex(L, funcIdx)
+
+	return func(yield func(string, int) bool) {
+		for n := 1; ; n++ {
+			name, ok := L.GetUpvalue(funcIdx, n)
+			if !ok {
+				return
+			}
+
+			cont := yield(name, L.GetTop())
+			L.Pop()
+			if !cont {
+				return
+			}
+		}
+	}
+}
+
+// Pushes the function running at the given level onto the stack, returns false and pushes nothing if the level
+// doesn't exist.
+func (L State) PushStackFunction(level int) bool {
+	var ar C.lua_Debug
+	if C.lua_getstack_wrap(L.c(), C.int(level), &ar) == 0 {
+		return false
+	}
+
+	cWhat := CStr("f")
+	defer cWhat.free()
+
+	return C.lua_getinfo_wrap(L.c(), cWhat.c, &ar) != 0
+}
+
+/*
+Pushes a traceback of the stack starting at level, prefixed with msg if it isn't empty.
+
+It uses luaL_traceback when lua_shared exports it and falls back to debug.traceback otherwise.
+
+# Example
+
+	L.Traceback("something went wrong", 1)
+	fmt.Println(L.GetString(-1))
+	L.Pop()
+*/
+func (L State) Traceback(msg string, level int) {
+	if HasFeature("luaL_traceback") {
+		var cMsg *C.char
+		if msg != "" {
+			s := CStr(msg)
+			defer s.free()
+			cMsg = s.c
+		}
+		C.luaL_traceback_wrap(L.c(), L.c(), cMsg, C.int(level))
+		return
+	}
+
+	L.GetGlobal("debug")
+	if L.IsTable(-1) {
+		L.GetField(-1, "traceback")
+		L.Remove(-2)
+		if L.IsFunc(-1) {
+			L.PushString(msg)
+			L.PushNumber(level + 1) // +1 for debug.traceback itself
+			if L.PCall(2, 1, 0) == nil {
+				return
+			}
+		}
+	}
+	L.Pop()
+	L.PushString(msg)
+}
@@ -0,0 +1,110 @@
+package glua_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Srlion/glua"
+	"github.com/Srlion/glua/gluatest"
+)
+
+func TestLocals(t *testing.T) {
+	L := gluatest.New(t)
+
+	var got map[string]any
+	L.PushGoFunc(func(L glua.State) int {
+		top := L.GetTop()
+
+		got = map[string]any{}
+		for name, idx := range L.Locals(1) {
+			if !strings.HasPrefix(name, "(") { // temporaries
+				got[name] = L.ToAny(idx)
+			}
+		}
+
+		if name, ok := L.GetLocal(1, 2); !ok || name != "b" || L.GetString(-1) != "two" {
+			t.Errorf("GetLocal(1, 2) = %q, %v with %q on the stack", name, ok, L.GetString(-1))
+		} else {
+			L.Pop()
+		}
+
+		L.PushString("changed")
+		if name, ok := L.SetLocal(1, 2); !ok || name != "b" {
+			t.Errorf("SetLocal(1, 2) = %q, %v", name, ok)
+		}
+
+		if _, ok := L.GetLocal(1, 100); ok {
+			t.Error("GetLocal found local 100")
+		}
+		if _, ok := L.GetLocal(100, 1); ok {
+			t.Error("GetLocal found a local at level 100")
+		}
+		L.PushString("ignored")
+		if _, ok := L.SetLocal(100, 1); ok {
+			t.Error("SetLocal assigned a local at level 100")
+		}
+
+		if L.GetTop() != top {
+			t.Errorf("stack has %d values, want %d", L.GetTop(), top)
+		}
+		return 0
+	})
+	L.SetGlobal("inspect")
+
+	L.AssertEqual(L.Eval(`
+		local a, b = 1, "two"
+		inspect()
+		return a, b
+	`), []any{1, "changed"})
+
+	L.AssertEqual(got, map[string]any{"a": 1, "b": "two"})
+}
+
+func TestUpvalues(t *testing.T) {
+	L := gluatest.New(t)
+
+	if err := L.CompileBuffer([]byte(`
+		local x, y = 10, "y"
+		return function() return x, y end
+	`), "=upvalues"); err != nil {
+		t.Fatal(err)
+	}
+	if err := L.PCall(0, 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	top := L.GetTop()
+
+	var names []string
+	for name, idx := range L.Upvalues(-1) {
+		names = append(names, name)
+		if name == "x" {
+			L.AssertValue(idx, 10)
+		}
+	}
+	L.AssertEqual(names, []any{"x", "y"})
+
+	L.PushNumber(20)
+	if name, ok := L.SetUpvalue(-2, 1); !ok || name != "x" {
+		t.Fatalf("SetUpvalue(-2, 1) = %q, %v", name, ok)
+	}
+	if _, ok := L.GetUpvalue(-1, 3); ok {
+		t.Fatal("GetUpvalue found upvalue 3")
+	}
+	L.PushNumber(30)
+	if _, ok := L.SetUpvalue(-2, 3); ok {
+		t.Fatal("SetUpvalue assigned upvalue 3")
+	}
+	if L.GetTop() != top {
+		t.Fatalf("stack has %d values, want %d", L.GetTop(), top)
+	}
+
+	L.SetGlobal("closure")
+	L.AssertEqual(L.Eval("return closure()"), []any{20, "y"})
+
+	// the handle of a Go function is an unnamed upvalue
+	L.PushGoFunc(func(L glua.State) int { return 0 })
+	if name, ok := L.GetUpvalue(-1, 1); !ok || name != "" {
+		t.Fatalf("GetUpvalue on a Go function = %q, %v", name, ok)
+	}
+	L.PopN(2)
+}
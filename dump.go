@@ -0,0 +1,85 @@
+package glua
+
+/*
+#include "c/dump.h"
+#include "c/glua.h"
+*/
+import "C"
+import (
+	"bytes"
+	"errors"
+	"runtime/cgo"
+	"unsafe"
+)
+
+//export goDumpWriter
+func goDumpWriter(p unsafe.Pointer, sz C.size_t, handle C.uintptr_t) C.int {
+	buf := cgo.Handle(handle).Value().(*bytes.Buffer)
+	buf.Write(goBytes(p, sz))
+	return 0
+}
+
+/*
+Dumps the Lua function at the given index as a binary chunk that can be loaded back with CompileBufferX and
+ChunkModeBinary (or ChunkModeAny).
+
+With strip the debug information (line numbers, local and upvalue names) is left out, which makes the chunk smaller
+but errors won't have line numbers. Stripping is done through string.dump, lua_dump can't do it.
+
+Binary chunks are not portable between LuaJIT versions or 32/64-bit builds, and loading untrusted ones can crash
+the process.
+
+# Example
+
+	L.CompileString("return 1 + 1")
+	chunk, err := L.Dump(-1, true)
+	if err != nil {
+		fmt.Println(err)
+		return 0
+	}
+
+	L.CompileBufferX(chunk, "=cached", glua.ChunkModeBinary)
+*/
+func (L State) Dump(idx int, strip bool) ([]byte, error) {
+	if L.Type(idx) != LUA_TFUNCTION {
+		return nil, errors.New("value is not a function")
+	}
+
+	if strip {
+		L.GetGlobal("string")
+		if !L.IsTable(-1) {
+			L.Pop()
+			return nil, errors.New("string library is not loaded")
+		}
+		L.GetField(-1, "dump")
+		L.Remove(-2)
+		if idx < 0 && idx > LUA_REGISTRYINDEX {
+			idx--
+		}
+		L.PushValue(idx)
+		L.PushBool(true)
+		if err := L.PCall(2, 1, 0); err != nil {
+			L.Pop()
+			return nil, err
+		}
+
+		chunk := L.GetBinaryString(-1)
+		L.Pop()
+
+		return chunk, nil
+	}
+
+	var buf bytes.Buffer
+	h := cgo.NewHandle(&buf)
+	defer h.Delete()
+
+	L.PushValue(idx)
+	status := C.dump_function(L.c(), C.uintptr_t(h))
+	L.Pop()
+
+	if status != 0 {
+		return nil, errors.New("unable to dump given function")
+	}
+
+	return buf.Bytes(), nil
+}
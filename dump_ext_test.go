@@ -0,0 +1,101 @@
+package glua_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Srlion/glua"
+	"github.com/Srlion/glua/gluatest"
+)
+
+const dumpSource = `
+local base = 40
+return function(fail)
+	if fail then error("boom") end
+	return base + 2
+end`
+
+// Compiles dumpSource, calls it for the inner function (it has an upvalue) and dumps that.
+func dumpInner(t *testing.T, L *gluatest.State, strip bool) []byte {
+	t.Helper()
+
+	if err := L.CompileBuffer([]byte(dumpSource), "@dump.lua"); err != nil {
+		t.Fatal(err)
+	}
+	if err := L.PCall(0, 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	L.PushNumber(1) // the index is adjusted for what Dump pushes above it
+	chunk, err := L.Dump(-2, strip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	L.PopN(2)
+	return chunk
+}
+
+func TestDumpRoundTrip(t *testing.T) {
+	L := gluatest.New(t)
+
+	full := dumpInner(t, L, false)
+	stripped := dumpInner(t, L, true)
+	if len(stripped) >= len(full) {
+		t.Fatalf("stripped chunk has %d bytes, the full one %d", len(stripped), len(full))
+	}
+
+	for _, tt := range []struct {
+		name  string
+		chunk []byte
+		line  bool
+	}{
+		{"full", full, true},
+		{"stripped", stripped, false},
+	} {
+		for _, mode := range []string{glua.ChunkModeBinary, glua.ChunkModeAny} {
+			if err := L.CompileBufferX(tt.chunk, "=dumped", mode); err != nil {
+				t.Fatalf("%s chunk with mode %q: %v", tt.name, mode, err)
+			}
+			L.SetGlobal("dumped")
+
+			// the upvalue isn't part of the chunk, it's nil once loaded back
+			L.AssertError("dumped()", "arithmetic on")
+
+			_, err := L.Run("dumped(true)")
+			if err == nil || !strings.Contains(err.Error(), "boom") {
+				t.Fatalf("%s chunk: got %v, want the error of the function", tt.name, err)
+			}
+			if got := strings.Contains(err.Error(), ":4:"); got != tt.line {
+				t.Fatalf("%s chunk: error %q has a line number = %t, want %t", tt.name, err, got, tt.line)
+			}
+		}
+
+		if err := L.CompileBufferX(tt.chunk, "=dumped", glua.ChunkModeText); err == nil {
+			t.Fatalf("%s chunk loaded in text mode", tt.name)
+		}
+	}
+
+	if err := L.CompileBufferX([]byte("return 1"), "=text", glua.ChunkModeBinary); err == nil {
+		t.Fatal("text chunk loaded in binary mode")
+	}
+}
+
+func TestDumpErrors(t *testing.T) {
+	L := gluatest.New(t)
+
+	L.PushNumber(1)
+	if _, err := L.Dump(-1, false); err == nil || !strings.Contains(err.Error(), "not a function") {
+		t.Fatalf("got %v for a number", err)
+	}
+	L.Pop()
+
+	L.GetGlobal("print")
+	for _, strip := range []bool{false, true} {
+		if _, err := L.Dump(-1, strip); err == nil {
+			t.Fatalf("dumping a C function succeeded with strip %t", strip)
+		}
+	}
+	if L.GetTop() != 1 {
+		t.Fatalf("stack has %d values after failed dumps, want 1", L.GetTop())
+	}
+	L.Pop()
+}
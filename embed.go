@@ -0,0 +1,172 @@
+package glua
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Lua sources embedded in the module with embed.FS, so the Lua side can't drift out of sync with the Go side.
+//
+// A bundle registered as "mymod" makes "db/query.lua" loadable with require("mymod.db.query") and
+// IncludeEmbedded("mymod/db/query.lua"), with "mymod/db/query.lua" as the chunk name in error messages.
+// An init.lua is the module of its directory, "db/init.lua" is require("mymod.db").
+
+type embeddedBundle struct {
+	prefix string // "mymod.sub"
+	dir    string // "mymod/sub"
+	fsys   fs.FS
+}
+
+var (
+	embeddedMu      sync.Mutex
+	embeddedBundles []*embeddedBundle
+)
+
+/*
+Registers the Lua files under root in fsys as the modules of prefix, they are added to package.preload every time
+the module is opened.
+
+It's meant to be called from init, it panics if root doesn't exist.
+
+# Example
+
+	//go:embed lua
+	var luaFiles embed.FS
+
+	func init() {
+		glua.EmbedLua("mymod", luaFiles, "lua")
+	}
+
+	-- lua/util.lua is now
+	local util = require("mymod.util")
+*/
+func EmbedLua(prefix string, fsys fs.FS, root string) {
+	sub, err := fs.Sub(fsys, root)
+	if err != nil {
+		panic("glua: EmbedLua(" + prefix + "): " + err.Error())
+	}
+	if _, err := fs.Stat(sub, "."); err != nil {
+		panic("glua: EmbedLua(" + prefix + "): " + err.Error())
+	}
+
+	b := &embeddedBundle{
+		prefix: prefix,
+		dir:    strings.ReplaceAll(prefix, ".", "/"),
+		fsys:   sub,
+	}
+
+	embeddedMu.Lock()
+	embeddedBundles = append(embeddedBundles, b)
+	embeddedMu.Unlock()
+
+	OnOpen("embed:"+prefix, b.register)
+}
+
+// Adds a loader for every Lua file of the bundle to package.preload.
+func (b *embeddedBundle) register(L State) error {
+	top := L.GetTop()
+	defer L.SetTop(top)
+
+	L.GetGlobal("package")
+	if !L.IsTable(-1) {
+		return errors.New("the package library is not loaded")
+	}
+	L.GetField(-1, "preload")
+	if !L.IsTable(-1) {
+		return errors.New("package.preload is missing")
+	}
+
+	return fs.WalkDir(b.fsys, ".", func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path.Ext(file) != ".lua" {
+			return nil
+		}
+
+		L.PushGoFunc(func(L State) int {
+			L.SetTop(1) // the module name require passes
+			if err := b.load(L, file); err != nil {
+				panic(err.Error())
+			}
+			L.Insert(1)
+			if err := L.PCall(1, 1, 0); err != nil {
+				panic(err.Error())
+			}
+			return 1
+		})
+		L.SetField(-2, b.moduleName(file))
+
+		return nil
+	})
+}
+
+// "db/query.lua" -> "mymod.db.query", "db/init.lua" -> "mymod.db"
+func (b *embeddedBundle) moduleName(file string) string {
+	name := strings.TrimSuffix(file, ".lua")
+	if name == "init" {
+		return b.prefix
+	}
+	name = strings.TrimSuffix(name, "/init")
+	return b.prefix + "." + strings.ReplaceAll(name, "/", ".")
+}
+
+// Compiles a file of the bundle and pushes it as a function.
+func (b *embeddedBundle) load(L State, file string) error {
+	code, err := fs.ReadFile(b.fsys, file)
+	if err != nil {
+		return err
+	}
+	// bundles are part of the module, so they may ship precompiled chunks made with Dump
+	return L.CompileBufferX(code, "@"+b.dir+"/"+file, ChunkModeAny)
+}
+
+// Finds the bundle owning the path, the longest matching prefix wins so "mymod/sub" can live next to "mymod".
+func findEmbeddedBundle(file string) (*embeddedBundle, string, bool) {
+	embeddedMu.Lock()
+	defer embeddedMu.Unlock()
+
+	var best *embeddedBundle
+	for _, b := range embeddedBundles {
+		if strings.HasPrefix(file, b.dir+"/") && (best == nil || len(b.dir) > len(best.dir)) {
+			best = b
+		}
+	}
+	if best == nil {
+		return nil, "", false
+	}
+	return best, strings.TrimPrefix(file, best.dir+"/"), true
+}
+
+/*
+Compiles an embedded Lua file and pushes it as a function, like CompileBuffer.
+
+The path starts with the bundle prefix, eg. "mymod/db/query.lua".
+*/
+func (L State) CompileEmbedded(file string) error {
+	b, rel, ok := findEmbeddedBundle(path.Clean(file))
+	if !ok {
+		return fmt.Errorf("no embedded Lua bundle contains '%s'", file)
+	}
+	return b.load(L, rel)
+}
+
+/*
+Runs an embedded Lua file, like include does for files on disk.
+
+# Example
+
+	if err := L.IncludeEmbedded("mymod/autorun.lua"); err != nil {
+		L.ErrorNoHalt(err.Error())
+	}
+*/
+func (L State) IncludeEmbedded(file string) error {
+	if err := L.CompileEmbedded(file); err != nil {
+		return err
+	}
+	return L.PCall(0, 0, 0)
+}
@@ -0,0 +1,70 @@
+package glua_test
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/Srlion/glua"
+	"github.com/Srlion/glua/gluatest"
+)
+
+func init() {
+	glua.EmbedLua("embedtest", fstest.MapFS{
+		"lua/init.lua":     {Data: []byte(`return {name = "root"}`)},
+		"lua/db/init.lua":  {Data: []byte(`return {name = "db"}`)},
+		"lua/db/query.lua": {Data: []byte(`return {name = ..., source = debug.getinfo(1, "S").source}`)},
+		"lua/fail.lua":     {Data: []byte(`error("failed here")`)},
+		"lua/run.lua":      {Data: []byte(`embed_ran = (embed_ran or 0) + 1`)},
+		"lua/readme.txt":   {Data: []byte(`not lua`)},
+	}, "lua")
+	glua.EmbedLua("embedtest.sub", fstest.MapFS{
+		"a.lua": {Data: []byte(`return "sub"`)},
+	}, ".")
+}
+
+func TestEmbeddedRequire(t *testing.T) {
+	L := gluatest.New(t)
+
+	L.AssertGlobal(`require("embedtest").name`, "root")
+	L.AssertGlobal(`require("embedtest.db").name`, "db")
+	// require passes the module name, the chunk is named after the file
+	L.AssertGlobal(`require("embedtest.db.query")`, map[string]any{
+		"name":   "embedtest.db.query",
+		"source": "@embedtest/db/query.lua",
+	})
+	L.AssertGlobal(`require("embedtest.sub.a")`, "sub")
+	L.AssertGlobal(`package.preload["embedtest.readme"]`, nil)
+	L.AssertError(`require("embedtest.fail")`, "embedtest/fail.lua:1: failed here")
+}
+
+func TestIncludeEmbedded(t *testing.T) {
+	L := gluatest.New(t)
+
+	for i := 0; i < 2; i++ {
+		if err := L.IncludeEmbedded("embedtest/run.lua"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	L.AssertGlobal("embed_ran", 2)
+
+	// the longest prefix owns the path
+	if err := L.CompileEmbedded("embedtest/sub/./a.lua"); err != nil {
+		t.Fatal(err)
+	}
+	if err := L.PCall(0, 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	L.AssertValue(-1, "sub")
+	L.Pop()
+
+	if err := L.IncludeEmbedded("embedtest/fail.lua"); err == nil || !strings.Contains(err.Error(), "embedtest/fail.lua:1: failed here") {
+		t.Fatalf("got %v, want the error with the embedded chunk name", err)
+	}
+	if err := L.IncludeEmbedded("nope/init.lua"); err == nil || !strings.Contains(err.Error(), "no embedded Lua bundle contains 'nope/init.lua'") {
+		t.Fatalf("got %v for a path outside every bundle", err)
+	}
+	if err := L.IncludeEmbedded("embedtest/missing.lua"); err == nil {
+		t.Fatal("including a missing file succeeded")
+	}
+}
@@ -0,0 +1,75 @@
+package glua
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Go can't dlclose, so globals survive a gmod13_close/gmod13_open cycle but the registries are recreated.
+// A handle from the previous load (eg. a Go function stored in a Lua table that outlived a map change) could
+// resolve to something else in the new registry, so every handle carries the epoch it was created in and
+// handles from other epochs are rejected.
+
+const uintptrBits = 32 << (^uintptr(0) >> 63)
+
+// Tagged handles are pushed as light userdata, which x64 LuaJIT rejects ("bad light userdata pointer") if any bit
+// above 46 is set. On 64-bit the epoch goes in bits 32-46 and the handle gets the low 32 bits, on 32-bit the epoch
+// is the top 8 bits.
+const is64Bit = uintptrBits / 64
+
+const epochShift = 24 + is64Bit*8 // 24 on 32-bit, 32 on 64-bit
+const epochBits = 8 + is64Bit*7   // 8 on 32-bit, 15 on 64-bit
+const epochMask = 1<<epochBits - 1
+const handleMask = 1<<epochShift - 1
+
+// Highest bit a tagged handle can have set, light userdata must stay below 1<<47 on x64
+const maxTaggedBit = epochShift + epochBits - 1
+
+var moduleEpoch atomic.Uint32
+
+// Returns the epoch of the current module load, it starts at 1 and is bumped every time the module is opened.
+//
+// The epoch wraps around after 255 opens on 32-bit and 32767 opens on 64-bit.
+func CurrentEpoch() uint32 {
+	return moduleEpoch.Load()
+}
+
+// Starts a new epoch, making every handle created before it stale.
+//
+// It's called when the module is opened, hosts and test harnesses that create states themselves should call it too.
+func AdvanceEpoch() uint32 {
+	for {
+		old := moduleEpoch.Load()
+		next := (old + 1) & epochMask
+		if next == 0 {
+			next = 1 // 0 is never a valid epoch, so a zeroed handle is always stale
+		}
+		if moduleEpoch.CompareAndSwap(old, next) {
+			return next
+		}
+	}
+}
+
+func withEpoch(handle uintptr) uintptr {
+	if handle > handleMask {
+		panic(fmt.Sprintf("glua: too many live handles (%d), the limit is %d", handle, uintptr(handleMask)))
+	}
+	return uintptr(CurrentEpoch())<<epochShift | handle
+}
+
+func splitEpoch(handle uintptr) (uintptr, uint32) {
+	return handle &^ (epochMask << epochShift), uint32(handle >> epochShift)
+}
+
+func staleEpochError(what string, epoch uint32) error {
+	return fmt.Errorf("attempt to use %s from a previous module load (epoch %d, current %d)", what, epoch, CurrentEpoch())
+}
+
+// Strips the epoch from a handle, returns an error if it's from another epoch.
+func checkEpoch(handle uintptr, what string) (uintptr, error) {
+	raw, epoch := splitEpoch(handle)
+	if epoch != CurrentEpoch() {
+		return 0, staleEpochError(what, epoch)
+	}
+	return raw, nil
+}
@@ -0,0 +1,61 @@
+package glua
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTaggedHandlesFitInLightUserdata(t *testing.T) {
+	if uintptrBits != 64 {
+		t.Skip("only 64-bit LuaJIT limits light userdata pointers")
+	}
+
+	saved := moduleEpoch.Load()
+	defer moduleEpoch.Store(saved)
+
+	moduleEpoch.Store(epochMask)
+	tagged := withEpoch(handleMask)
+	if tagged>>47 != 0 {
+		t.Fatalf("tagged handle %#x has bits above 46 set", tagged)
+	}
+	if maxTaggedBit > 46 {
+		t.Fatalf("tagged handles use bit %d", maxTaggedBit)
+	}
+}
+
+func TestEpochRoundTrip(t *testing.T) {
+	saved := moduleEpoch.Load()
+	defer moduleEpoch.Store(saved)
+
+	moduleEpoch.Store(7)
+	tagged := withEpoch(1234)
+
+	raw, err := checkEpoch(tagged, "a test handle")
+	if err != nil || raw != 1234 {
+		t.Fatalf("checkEpoch = %d, %v; want 1234, nil", raw, err)
+	}
+
+	AdvanceEpoch()
+	if _, err := checkEpoch(tagged, "a test handle"); err == nil || !strings.Contains(err.Error(), "previous module load") {
+		t.Fatalf("stale handle wasn't rejected: %v", err)
+	}
+}
+
+func TestAdvanceEpochSkipsZero(t *testing.T) {
+	saved := moduleEpoch.Load()
+	defer moduleEpoch.Store(saved)
+
+	moduleEpoch.Store(epochMask)
+	if got := AdvanceEpoch(); got != 1 {
+		t.Fatalf("AdvanceEpoch after the last epoch = %d, want 1", got)
+	}
+}
+
+func TestWithEpochRejectsOversizedHandles(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("withEpoch didn't panic for a handle above handleMask")
+		}
+	}()
+	withEpoch(handleMask + 1)
+}
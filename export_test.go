@@ -0,0 +1,11 @@
+package glua
+
+// Internals the external tests assert on.
+
+func ThinkDriverName() string {
+	return thinkDriverName
+}
+
+func ActiveThinkDriver() ThinkDriver {
+	return activeThinkDriver
+}
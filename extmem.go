@@ -0,0 +1,144 @@
+package glua
+
+/*
+#include "c/glua.h"
+*/
+import "C"
+import (
+	"runtime/cgo"
+	"sync/atomic"
+	"unsafe"
+)
+
+// A userdata is a pointer sized block to Lua, so a userdata holding a big Go buffer looks free and the collector
+// takes its time with it. Userdata can declare the memory they hold outside of Lua, glua keeps the total and runs
+// collector steps proportional to it as it grows, like Lua would if the memory was its own.
+
+const DefaultExternalMemoryStep = 4 * 1024 * 1024
+
+var (
+	externalMemory     atomic.Int64
+	externalDebt       atomic.Int64
+	externalMemoryStep atomic.Int64
+)
+
+func init() {
+	externalMemoryStep.Store(DefaultExternalMemoryStep)
+
+	ResetOnOpen(func() {
+		externalMemory.Store(0)
+		externalDebt.Store(0)
+	})
+}
+
+// Sets how much external memory has to be declared before glua runs a collector step, defaults to
+// DefaultExternalMemoryStep. Smaller values collect sooner at the cost of more steps.
+func SetExternalMemoryStep(bytes int64) {
+	if bytes <= 0 {
+		bytes = DefaultExternalMemoryStep
+	}
+	externalMemoryStep.Store(bytes)
+}
+
+// Returns the external memory declared by userdata that were not freed yet.
+func ExternalMemory() int64 {
+	return externalMemory.Load()
+}
+
+/*
+Same as NewUserData, but declares the memory the value holds outside of Lua (eg. the size of a Go buffer), so
+the collector treats the userdata as big as it really is.
+
+Call FreeUserData in __gc, it releases both the handle and the declared size.
+
+# Example
+
+	buf := make([]byte, 50*1024*1024)
+	L.NewUserDataSized(buf, &bufferMeta, int64(len(buf)))
+*/
+func (L State) NewUserDataSized(value any, metatable *string, size int64) cgo.Handle {
+	h := L.NewUserData(value, metatable)
+	L.SetUserDataSize(-1, size)
+	return h
+}
+
+/*
+Updates the external memory declared by the userdata at the given index, eg. after its buffer grew. It raises an
+error for userdata from a previous module load.
+*/
+func (L State) SetUserDataSize(idx int, size int64) {
+	block := L.toGoUserData(idx)
+	if block.epoch != CurrentEpoch() {
+		// its size was dropped with the old total, and FreeUserData won't subtract a size recorded now
+		panic(staleEpochError("a userdata", block.epoch).Error())
+	}
+	if size < 0 {
+		size = 0
+	}
+
+	delta := size - block.size
+	block.size = size
+
+	L.addExternalMemory(delta)
+}
+
+/*
+Deletes the handle of a userdata created by NewUserData and releases its declared size, it's meant to be called
+from __gc. Calling it again on the same userdata does nothing.
+
+# Example
+
+	L.PushGoFunc(func(L glua.State) int {
+		L.FreeUserData(1)
+		return 0
+	})
+	L.SetField(-2, "__gc")
+*/
+func (L State) FreeUserData(idx int) {
+	block := L.toGoUserData(idx)
+
+	if block.handle != 0 {
+		block.handle.Delete()
+		block.handle = 0
+	}
+
+	// sizes from a previous module load were already dropped when the total was reset
+	if block.size != 0 && block.epoch == CurrentEpoch() {
+		externalMemory.Add(-block.size)
+	}
+	block.size = 0
+}
+
+// Returns the block of the userdata at the given index, it raises an argument error if it wasn't created by
+// NewUserData.
+func (L State) toGoUserData(idx int) *goUserData {
+	idx = absIndex(L, idx)
+	if L.Type(idx) != LUA_TUSERDATA {
+		L.TypeError(idx, "userdata")
+	}
+
+	ud := C.lua_touserdata_wrap(L.c(), C.int(idx))
+	if ud == nil || L.GetLength(idx) != int(unsafe.Sizeof(goUserData{})) || (*goUserData)(ud).magic != goUserDataMagic {
+		L.ArgError(idx, "userdata not created by NewUserData")
+	}
+
+	return (*goUserData)(ud)
+}
+
+// Tracks a change of external memory and runs a collector step once enough was added since the last one.
+func (L State) addExternalMemory(delta int64) {
+	externalMemory.Add(delta)
+	if delta <= 0 {
+		return
+	}
+
+	debt := externalDebt.Add(delta)
+	if debt < externalMemoryStep.Load() {
+		return
+	}
+
+	if externalDebt.CompareAndSwap(debt, 0) {
+		// a step of n KB makes the collector act as if n KB were allocated
+		L.Step(int(debt / 1024))
+	}
+}
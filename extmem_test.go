@@ -0,0 +1,59 @@
+package glua_test
+
+import (
+	"testing"
+
+	"github.com/Srlion/glua"
+	"github.com/Srlion/glua/gluatest"
+)
+
+func pushSetSize(L *gluatest.State) {
+	L.PushGoFunc(func(L glua.State) int {
+		L.SetUserDataSize(1, int64(L.CheckNumber(2)))
+		return 0
+	})
+	L.SetGlobal("setsize")
+}
+
+func TestSetUserDataSizeRejectsForeignUserdata(t *testing.T) {
+	L := gluatest.New(t)
+	pushSetSize(L)
+
+	L.AssertError("setsize(newproxy(), 10)", "userdata not created by NewUserData")
+	L.AssertError("setsize({}, 10)", "userdata expected")
+
+	if got := glua.ExternalMemory(); got != 0 {
+		t.Fatalf("ExternalMemory = %d, want 0", got)
+	}
+}
+
+func TestStaleUserDataSize(t *testing.T) {
+	L := gluatest.New(t)
+	pushSetSize(L)
+
+	L.NewUserDataSized("buffer", nil, 100)
+	L.SetGlobal("buf")
+	if got := glua.ExternalMemory(); got != 100 {
+		t.Fatalf("ExternalMemory = %d, want 100", got)
+	}
+
+	L.Eval("setsize(buf, 200)")
+	if got := glua.ExternalMemory(); got != 200 {
+		t.Fatalf("ExternalMemory = %d, want 200", got)
+	}
+
+	// a reload resets the total, the old userdata can't add to the new one
+	glua.AdvanceEpoch()
+	L.AssertError("setsize(buf, 300)", "previous module load")
+
+	L.PushGoFunc(func(L glua.State) int {
+		L.FreeUserData(1)
+		return 0
+	})
+	L.SetGlobal("free")
+	before := glua.ExternalMemory()
+	L.Eval("free(buf)")
+	if got := glua.ExternalMemory(); got != before {
+		t.Fatalf("freeing a stale userdata changed ExternalMemory from %d to %d", before, got)
+	}
+}
@@ -0,0 +1,216 @@
+package glua
+
+/*
+#include "c/glua.h"
+*/
+import "C"
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+const (
+	LUA_GCSTOP       = 0
+	LUA_GCRESTART    = 1
+	LUA_GCCOLLECT    = 2
+	LUA_GCCOUNT      = 3
+	LUA_GCCOUNTB     = 4
+	LUA_GCSTEP       = 5
+	LUA_GCSETPAUSE   = 6
+	LUA_GCSETSTEPMUL = 7
+)
+
+/*
+Controls the garbage collector, see lua_gc for what each option does with data and returns.
+
+# Example
+
+	L.GC(glua.LUA_GCCOLLECT, 0)
+*/
+func (L State) GC(what, data int) int {
+	return int(C.lua_gc_wrap(L.c(), C.int(what), C.int(data)))
+}
+
+// Returns the memory in use by Lua in bytes.
+func (L State) MemoryBytes() int {
+	return L.GC(LUA_GCCOUNT, 0)*1024 + L.GC(LUA_GCCOUNTB, 0)
+}
+
+// Returns the memory in use by Lua in kilobytes, like collectgarbage("count").
+func (L State) MemoryKB() float64 {
+	return float64(L.MemoryBytes()) / 1024
+}
+
+// Runs a full garbage collection cycle.
+func (L State) CollectGarbage() {
+	L.GC(LUA_GCCOLLECT, 0)
+}
+
+// Runs an incremental step of the collector, size controls how big the step is (in KB, 0 for a basic step).
+//
+// Returns true if the step finished a collection cycle.
+func (L State) Step(size int) bool {
+	return L.GC(LUA_GCSTEP, size) != 0
+}
+
+// Stops the garbage collector until RestartGC is called.
+func (L State) StopGC() {
+	L.GC(LUA_GCSTOP, 0)
+}
+
+func (L State) RestartGC() {
+	L.GC(LUA_GCRESTART, 0)
+}
+
+// Sets how long the collector waits before starting a new cycle (in percent, 200 waits for the memory to double),
+// returns the previous value.
+func (L State) SetGCPause(pause int) int {
+	return L.GC(LUA_GCSETPAUSE, pause)
+}
+
+// Sets the speed of the collector relative to allocation (in percent), returns the previous value.
+func (L State) SetGCStepMul(mul int) int {
+	return L.GC(LUA_GCSETSTEPMUL, mul)
+}
+
+// A sample of both heaps taken at the same frame.
+type MemorySample struct {
+	Time     time.Time
+	LuaBytes int
+	// From runtime.MemStats
+	GoHeapAlloc uint64
+	GoHeapInuse uint64
+	GoSys       uint64
+	GoNumGC     uint32
+}
+
+type MemorySamplerOptions struct {
+	// Time between samples, defaults to 10 seconds
+	Interval time.Duration
+	// Number of samples kept, the oldest ones are dropped, defaults to 360 (an hour at the default interval)
+	Capacity int
+	// Called on the main thread after every sample
+	OnSample func(MemorySample)
+}
+
+// Samples the Lua and Go heaps periodically, so leaks can be correlated between the two.
+type MemorySampler struct {
+	opts MemorySamplerOptions
+
+	mu      sync.Mutex
+	samples []MemorySample
+	next    int
+	full    bool
+	stopped bool
+}
+
+/*
+Starts sampling the Lua heap and runtime.MemStats every interval, it runs on the think queue.
+
+runtime.ReadMemStats stops the world for a short time, so keep the interval in seconds. Like LuaThink, it
+only works while the module is open, so start it from gmod13_open or an OnOpen hook.
+
+# Example
+
+	sampler := glua.StartMemorySampler(glua.MemorySamplerOptions{Interval: time.Minute})
+
+	// later, eg. from a console command
+	for _, s := range sampler.Samples() {
+		fmt.Println(s.Time, s.LuaBytes, s.GoHeapAlloc)
+	}
+*/
+func StartMemorySampler(opts MemorySamplerOptions) *MemorySampler {
+	if opts.Interval <= 0 {
+		opts.Interval = 10 * time.Second
+	}
+	if opts.Capacity <= 0 {
+		opts.Capacity = 360
+	}
+
+	s := &MemorySampler{
+		opts:    opts,
+		samples: make([]MemorySample, opts.Capacity),
+	}
+
+	var last time.Time
+	LuaThink(func(L State) int {
+		s.mu.Lock()
+		stopped := s.stopped
+		s.mu.Unlock()
+		if stopped {
+			return 1
+		}
+
+		now := time.Now()
+		if !last.IsZero() && now.Sub(last) < opts.Interval {
+			return 0
+		}
+		last = now
+
+		sample := s.sample(L, now)
+		if opts.OnSample != nil {
+			opts.OnSample(sample)
+		}
+
+		return 0
+	})
+
+	return s
+}
+
+func (s *MemorySampler) sample(L State, now time.Time) MemorySample {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	sample := MemorySample{
+		Time:        now,
+		LuaBytes:    L.MemoryBytes(),
+		GoHeapAlloc: ms.HeapAlloc,
+		GoHeapInuse: ms.HeapInuse,
+		GoSys:       ms.Sys,
+		GoNumGC:     ms.NumGC,
+	}
+
+	s.mu.Lock()
+	s.samples[s.next] = sample
+	s.next = (s.next + 1) % len(s.samples)
+	if s.next == 0 {
+		s.full = true
+	}
+	s.mu.Unlock()
+
+	return sample
+}
+
+// Returns the recorded samples, oldest first. It's safe to call from any goroutine.
+func (s *MemorySampler) Samples() []MemorySample {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.full {
+		return append([]MemorySample(nil), s.samples[:s.next]...)
+	}
+
+	out := make([]MemorySample, 0, len(s.samples))
+	out = append(out, s.samples[s.next:]...)
+	return append(out, s.samples[:s.next]...)
+}
+
+// Returns the most recent sample, false if none was taken yet.
+func (s *MemorySampler) Latest() (MemorySample, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.full && s.next == 0 {
+		return MemorySample{}, false
+	}
+	return s.samples[(s.next-1+len(s.samples))%len(s.samples)], true
+}
+
+// Stops sampling, the recorded samples are kept.
+func (s *MemorySampler) Stop() {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+}
@@ -0,0 +1,63 @@
+package glua_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Srlion/glua"
+	"github.com/Srlion/glua/gluatest"
+)
+
+func TestMemorySamplerWrapsAround(t *testing.T) {
+	L := gluatest.New(t)
+
+	var taken []glua.MemorySample
+	sampler := glua.StartMemorySampler(glua.MemorySamplerOptions{
+		Interval: time.Nanosecond,
+		Capacity: 3,
+		OnSample: func(s glua.MemorySample) { taken = append(taken, s) },
+	})
+	defer sampler.Stop()
+
+	if _, ok := sampler.Latest(); ok {
+		t.Fatal("Latest() returned a sample before any was taken")
+	}
+
+	// samples taken within the same nanosecond are skipped, so step until enough were taken
+	sampleUntil := func(n int) {
+		t.Helper()
+		for i := 0; len(taken) < n; i++ {
+			if i == 1000 {
+				t.Fatalf("only %d samples after %d frames", len(taken), i)
+			}
+			L.Step(1)
+		}
+	}
+
+	sampleUntil(2)
+	if got := sampler.Samples(); !slices.Equal(got, taken) {
+		t.Fatalf("Samples() = %v, want %v", got, taken)
+	}
+
+	// 5 samples in a ring of 3: the first two are dropped and the rest stay oldest first
+	sampleUntil(5)
+	if got := sampler.Samples(); !slices.Equal(got, taken[2:]) {
+		t.Fatalf("Samples() = %v, want %v", got, taken[2:])
+	}
+	if latest, ok := sampler.Latest(); !ok || latest != taken[4] {
+		t.Fatalf("Latest() = %v, %v, want %v", latest, ok, taken[4])
+	}
+	if taken[4].LuaBytes <= 0 {
+		t.Fatalf("LuaBytes = %d", taken[4].LuaBytes)
+	}
+
+	sampler.Stop()
+	L.Step(10)
+	if len(taken) != 5 {
+		t.Fatalf("%d samples taken after Stop, want 5", len(taken))
+	}
+	if got := sampler.Samples(); !slices.Equal(got, taken[2:]) {
+		t.Fatalf("Samples() after Stop = %v, want %v", got, taken[2:])
+	}
+}
@@ -20,6 +20,7 @@ func InitGoFuncRegistry(L State) {
 	FuncRegistry = safereg.New()
 }
 
+// Returns the handle with the current epoch embedded in it
 func registerGoFunc(fn GoFunc, oneTimeUse bool) uintptr {
 	var handle uintptr
 	if oneTimeUse {
@@ -30,7 +31,13 @@ func registerGoFunc(fn GoFunc, oneTimeUse bool) uintptr {
 	} else {
 		handle = FuncRegistry.Store(fn)
 	}
-	return handle
+	return withEpoch(handle)
+}
+
+func releaseGoFunc(handle uintptr) {
+	if raw, err := checkEpoch(handle, "a Go function"); err == nil {
+		FuncRegistry.Release(raw)
+	}
 }
 
 func callGoFunc(L State, fn GoFunc) (res int, err error) {
@@ -53,10 +60,16 @@ func callGoFunc(L State, fn GoFunc) (res int, err error) {
 func goLuaCallback(L State, cRes *C.int, cErr **C.char) {
 	var res int
 	var err error
+	var fn any
+	var exists bool
+
+	// Get the function handle from the upvalue, handles from a previous module load are rejected
+	funcHandle, err := checkEpoch(L.GetLightUserData(lua_upvalueindex(1)), "a Go function")
+	if err != nil {
+		goto handleRet
+	}
 
-	// Get the function handle from the upvalue
-	funcHandle := L.GetLightUserData(lua_upvalueindex(1))
-	fn, exists := FuncRegistry.Get(funcHandle)
+	fn, exists = FuncRegistry.Get(funcHandle)
 	if !exists {
 		err = errors.New("attempt to call a nil value")
 		goto handleRet
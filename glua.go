@@ -5,30 +5,167 @@ import "C"
 import (
 	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
 	"runtime/cgo"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"unsafe"
 )
 
+// Environment variable that overrides where lua_shared is loaded from, SetLuaSharedPath takes priority over it.
+const LuaSharedPathEnv = "GLUA_LUA_SHARED"
+
+var luaSharedPath string
+
+/*
+Sets where LoadLuaShared loads lua_shared from, it's tried before the GLUA_LUA_SHARED environment variable and the
+default game paths.
+
+Useful for custom server layouts or to run with a stand-in LuaJIT build outside of Garry's Mod.
+
+# Example
+
+	func init() {
+		glua.SetLuaSharedPath("/opt/gmod/bin/linux64/lua_shared.so")
+	}
+*/
+func SetLuaSharedPath(path string) {
+	luaSharedPath = path
+}
+
+// The paths LoadLuaShared tries, in order.
+func luaSharedCandidates() []string {
+	var paths []string
+	if luaSharedPath != "" {
+		paths = append(paths, luaSharedPath)
+	}
+	if env := os.Getenv(LuaSharedPathEnv); env != "" && env != luaSharedPath {
+		paths = append(paths, env)
+	}
+	for i := C.size_t(0); ; i++ {
+		path := C.lua_shared_default_path(i)
+		if path == nil {
+			break
+		}
+		paths = append(paths, C.GoString(path))
+	}
+	return paths
+}
+
+/*
+Loads lua_shared and the functions glua uses from it.
+
+Every candidate path (SetLuaSharedPath, GLUA_LUA_SHARED, then the default game paths) is first tried as an already
+loaded library, so the copy the game mapped is reused, and only then loaded. If everything fails the error lists
+every path tried with the loader's error.
+*/
 func LoadLuaShared() *string {
-	err := C.load_lua_shared()
-	if err != nil {
-		errStr := C.GoString(err)
-		return &errStr
+	return loadLuaSharedFrom(luaSharedCandidates())
+}
+
+// Same as LoadLuaShared, but only tries the given path.
+func LoadLuaSharedFrom(path string) *string {
+	return loadLuaSharedFrom([]string{path})
+}
+
+func loadLuaSharedFrom(paths []string) *string {
+	var tried []string
+
+	for _, reuse := range []bool{true, false} {
+		for _, path := range paths {
+			cPath := CStr(path)
+
+			cReuse := C.int(0)
+			if reuse {
+				cReuse = 1
+			}
+
+			var cErr *C.char
+			handle := C.open_lua_shared(cPath.c, cReuse, &cErr)
+			if handle != nil {
+				err := C.use_lua_shared(handle, cPath.c)
+				cPath.free()
+				cacheFeatures()
+				if err != nil {
+					// use_lua_shared already closed the handle
+					errStr := C.GoString(err)
+					C.free(unsafe.Pointer(err))
+					return &errStr
+				}
+				return nil
+			}
+			cPath.free()
+
+			mode := "load"
+			if reuse {
+				mode = "reuse"
+			}
+			tried = append(tried, fmt.Sprintf("  %s (%s): %s", path, mode, C.GoString(cErr)))
+			C.free(unsafe.Pointer(cErr))
+		}
 	}
 
-	return nil
+	errStr := "failed to load lua_shared, tried:\n" + strings.Join(tried, "\n")
+	return &errStr
 }
 
 func UnloadLuaShared() {
 	C.unload_lua_shared()
+	cacheFeatures()
 }
 
 func GetLuaSharedPath() string {
 	return C.GoString(C.get_lua_shared_path())
 }
 
+/*
+Reports whether lua_shared exports the given function, eg. "lua_sethook".
+
+Optional functions (lua_getlocal, lua_getupvalue, lua_sethook, luaL_traceback, luaJIT_setmode) don't fail loading
+when they are missing, because not every gmod branch exports them. APIs built on them check it and degrade.
+
+# Example
+
+	if !glua.HasFeature("lua_sethook") {
+		fmt.Println("no debugger on this branch")
+	}
+*/
+func HasFeature(name string) bool {
+	loaded := features.Load()
+	return loaded != nil && (*loaded)[name]
+}
+
+// Whether each function glua loads was found, it's resolved once per load since HasFeature is called in hot loops
+// (eg. for every local the debugger reads).
+var features atomic.Pointer[map[string]bool]
+
+func cacheFeatures() {
+	loaded := map[string]bool{}
+	for i := C.size_t(0); ; i++ {
+		var ok C.int
+		name := C.lua_function_at(i, &ok)
+		if name == nil {
+			break
+		}
+		loaded[C.GoString(name)] = ok != 0
+	}
+	features.Store(&loaded)
+}
+
+// Returns the optional functions lua_shared doesn't export, see HasFeature.
+func MissingFeatures() []string {
+	var missing []string
+	for i := C.size_t(0); ; i++ {
+		name := C.missing_lua_function(i)
+		if name == nil {
+			return missing
+		}
+		missing = append(missing, C.GoString(name))
+	}
+}
+
 // Creates a new Lua state.
 //
 // # Example
@@ -38,6 +175,15 @@ func NewState() State {
 	return State(C.luaL_newstate_wrap())
 }
 
+/*
+Destroys all objects in the given Lua state and frees all dynamic memory used by it.
+
+Only use it on states you created with NewState, never on the state given by gmod.
+*/
+func (L State) Close() {
+	C.lua_close_wrap(L.c())
+}
+
 // Creates a new coroutine
 //
 // # Example
@@ -371,14 +517,15 @@ func (L State) GetFunction(idx int) (func(State) int, error) {
 }
 
 /*
-Returns the userdata at the given index.
-
-If the value at the given index is not a userdata, it returns nil.
+Returns the handle of the userdata at the given index.
 
-If the value is a light userdata, it returns the pointer.
+It raises an error if the value isn't a userdata created by NewUserData (light userdata and userdata from other
+modules are rejected), if its metatable isn't the given one or if it's from a previous module load.
 */
 func (L State) GetUserData(idx int, metatable *string) cgo.Handle {
-	if !L.IsUserData(idx) {
+	idx = absIndex(L, idx)
+
+	if L.Type(idx) != LUA_TUSERDATA {
 		var metaMessage string
 		if metatable != nil {
 			metaMessage = " of type: " + *metatable
@@ -387,7 +534,9 @@ func (L State) GetUserData(idx int, metatable *string) cgo.Handle {
 	}
 
 	if metatable != nil {
-		L.GetMetatable(idx)
+		if L.GetMetatable(idx) == 0 {
+			panic("expected a userdata of type: " + *metatable)
+		}
 		L.GetMetatableByName(*metatable)
 
 		res := L.AreRawEqual(-1, -2)
@@ -398,14 +547,12 @@ func (L State) GetUserData(idx int, metatable *string) cgo.Handle {
 		}
 	}
 
-	ud := C.lua_touserdata_wrap(L.c(), C.int(idx))
-	if ud == nil {
-		panic("invalid userdata pointer")
+	block := L.toGoUserData(idx)
+	if block.epoch != CurrentEpoch() {
+		panic(staleEpochError("a userdata", block.epoch).Error())
 	}
 
-	handle := *(*cgo.Handle)(ud)
-
-	return handle
+	return block.handle
 }
 
 func (L State) GetLightUserData(idx int) uintptr {
@@ -581,6 +728,28 @@ func (L State) RawGetI(idx int, n int) {
 	C.lua_rawgeti_wrap(L.c(), C.int(idx), C.int(n))
 }
 
+/*
+Pops a key from the stack, and pushes a key-value pair from the table at the given index (the "next" pair after the given key).
+
+If there are no more elements in the table, then it returns false (and pushes nothing).
+
+While traversing a table, do not call GetString directly on a key, unless you know that the key is actually a string.
+
+# Example
+
+	// table is in the stack at index t
+	L.PushNil() // first key
+	for L.Next(t) {
+		// uses 'key' (at index -2) and 'value' (at index -1)
+		fmt.Println(L.TypeName(L.Type(-2)), L.TypeName(L.Type(-1)))
+		// removes 'value'; keeps 'key' for next iteration
+		L.Pop()
+	}
+*/
+func (L State) Next(idx int) bool {
+	return C.lua_next_wrap(L.c(), C.int(idx)) != 0
+}
+
 func (L State) CreateTable(narr, nrec int) {
 	C.lua_createtable_wrap(L.c(), C.int(narr), C.int(nrec))
 }
@@ -594,7 +763,7 @@ Creates a new userdata and pushes it onto the stack.
 
 It returns a cgo.Handle that can be used to retrieve the value.
 
-You need to call handle.Delete() when __gc is called.
+You need to call handle.Delete() (or FreeUserData) when __gc is called.
 
 # Example
 
@@ -607,7 +776,7 @@ You need to call handle.Delete() when __gc is called.
 	h := L.NewUserData(myStruct, nil)
 */
 func (L State) NewUserData(value any, metatable *string) cgo.Handle {
-	const goUserDataSize = C.size_t(unsafe.Sizeof(uintptr(0)))
+	const goUserDataSize = C.size_t(unsafe.Sizeof(goUserData{}))
 
 	h := cgo.NewHandle(value)
 
@@ -621,11 +790,24 @@ func (L State) NewUserData(value any, metatable *string) cgo.Handle {
 		L.SetMetatable(-2)
 	}
 
-	*(*cgo.Handle)(ptr) = h
+	*(*goUserData)(ptr) = goUserData{handle: h, epoch: CurrentEpoch(), magic: goUserDataMagic}
 
 	return h
 }
 
+// Marks userdata created by NewUserData, so code reading the block can tell them apart from other userdata
+const goUserDataMagic = 0x61756c67 // "glua"
+
+// The memory block of userdata created by NewUserData, the epoch makes userdata from a previous module load
+// fail loudly instead of resolving a handle that may have been deleted.
+type goUserData struct {
+	handle cgo.Handle
+	epoch  uint32
+	magic  uint32
+	// External memory the value holds, see NewUserDataSized
+	size int64
+}
+
 /*
 Pushes onto the stack the metatable of the value at the given index.
 
@@ -1021,9 +1203,92 @@ func (L State) Unref(ref int) {
 	L.DeleteRef(ref)
 }
 
-// TODO luaL_findtable
-// TODO lua_getstack
-// TODO lua_getinfo
+// A registry reference that remembers the module load it was created in, so a reference kept in a Go global
+// across a reopen isn't resolved against the new registry.
+type Ref struct {
+	ref   int
+	epoch uint32
+}
+
+/*
+Same as CreateRef, but returns a Ref that is tied to the current module load.
+
+# Example
+
+	L.PushString("Hello, world!")
+	ref := L.NewRef()
+
+	L.PushRef(ref)
+	fmt.Println(L.GetString(-1))
+
+	L.FreeRef(ref)
+*/
+func (L State) NewRef() Ref {
+	return Ref{ref: L.CreateRef(), epoch: CurrentEpoch()}
+}
+
+// Returns true if the reference isn't nil and was created in the current module load.
+func (r Ref) IsValid() bool {
+	return r.ref != LUA_REFNIL && r.ref != LUA_NOREF && r.epoch != 0 && r.epoch == CurrentEpoch()
+}
+
+/*
+Pushes the value of the reference onto the stack, nil for the zero Ref or a reference to nil.
+
+It panics if the reference is from a previous module load.
+*/
+func (L State) PushRef(r Ref) {
+	if r.epoch == 0 || r.ref == LUA_REFNIL || r.ref == LUA_NOREF {
+		L.PushNil()
+		return
+	}
+
+	if r.epoch != CurrentEpoch() {
+		panic(staleEpochError("a reference", r.epoch).Error())
+	}
+
+	L.RawGetI(LUA_REGISTRYINDEX, r.ref)
+}
+
+/*
+Deletes the reference from the registry.
+
+References from a previous module load are ignored, they belong to a registry that doesn't exist anymore and
+freeing them would free a reference of the new one.
+*/
+func (L State) FreeRef(r Ref) {
+	if r.IsValid() {
+		L.DeleteRef(r.ref)
+	}
+}
+
+/*
+Walks the dotted name fname (eg. "mymod.db") starting at the table at the given index and pushes the last table,
+missing tables are created with sizeHint record slots.
+
+Returns an error and pushes nothing if a part of the name exists and isn't a table.
+
+# Example
+
+	if err := L.FindTable(glua.LUA_GLOBALSINDEX, "mymod.db", 0); err != nil {
+		fmt.Println(err)
+		return 0
+	}
+
+	L.PushGoFunc(query)
+	L.SetField(-2, "query") // mymod.db.query = query
+*/
+func (L State) FindTable(idx int, fname string, sizeHint int) error {
+	cName := CStr(fname)
+	defer cName.free()
+
+	conflict := C.luaL_findtable_wrap(L.c(), C.int(idx), cName.c, C.int(sizeHint))
+	if conflict != nil {
+		return fmt.Errorf("name conflict for '%s' at '%s'", fname, C.GoString(conflict))
+	}
+
+	return nil
+}
 
 /*
 Compiles a buffer into Lua code and pushes a function onto the stack that, when called, executes it.
@@ -1056,21 +1321,24 @@ func (L State) CompileBuffer(code []byte, name string) error {
 	return nil
 }
 
-/*
-Same as CompileBuffer, but with an additional mode parameter.
-
-mode can be
-
-  - "b" Treat the script as a binary chunk.
-
-  - "t" Treat the script as a text chunk.
+// Modes of CompileBufferX and Load, what kind of chunks they accept.
+const (
+	// Only text chunks, use it for code from untrusted sources, loading a malformed binary chunk can crash the process
+	ChunkModeText = "t"
+	// Only binary chunks (see Dump)
+	ChunkModeBinary = "b"
+	// Both text and binary chunks, what CompileBuffer accepts
+	ChunkModeAny = "bt"
+)
 
-  - "bt" (default) Accepts both text and binary chunks.
+/*
+Same as CompileBuffer, but with an additional mode parameter that controls whether binary chunks are accepted, one of
+ChunkModeText ("t"), ChunkModeBinary ("b") or ChunkModeAny ("bt").
 
 # Example
 
 	buf := []byte("print('Hello, world!')")
-	err := L.LoadBufferX(buf, "example.lua", "t")
+	err := L.CompileBufferX(buf, "example.lua", glua.ChunkModeText)
 	if err != nil {
 		fmt.Println(err)
 	}
@@ -1401,13 +1669,32 @@ func (L State) DumpStack() {
 	println("===")
 }
 
-// func (L State) TypeError(arg int, tname string) string {
-// 	C.luaL_typerror_wrap(L.c(), C.int(arg), C.CString(tname))
-// }
+/*
+Raises a "bad argument #arg to 'fname' (msg)" error, like luaL_argerror.
+
+# Example
 
-// func (L State) ErrArgMsg(arg int, extraMsg string) {
-// 	fname := "?"
-// 	var namewhat string
-//
-// 	if
-// }
+	if n < 0 {
+		L.ArgError(1, "expected a positive number")
+	}
+*/
+func (L State) ArgError(arg int, msg string) {
+	cMsg := CStr(msg)
+	defer cMsg.free()
+
+	cErr := C.lua_err_argmsg(L.c(), C.int(arg), cMsg.c)
+	err := C.GoString(cErr)
+	C.free(unsafe.Pointer(cErr))
+	panic(err)
+}
+
+// Raises a "bad argument #arg to 'fname' (tname expected, got type)" error, like luaL_typerror.
+func (L State) TypeError(arg int, tname string) {
+	cName := CStr(tname)
+	defer cName.free()
+
+	cErr := C.lua_type_error(L.c(), C.int(arg), cName.c)
+	err := C.GoString(cErr)
+	C.free(unsafe.Pointer(cErr))
+	panic(err)
+}
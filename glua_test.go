@@ -0,0 +1,29 @@
+package glua
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestLoadLuaSharedRejectsOtherLibraries(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("needs libc.so.6")
+	}
+	if GetLuaSharedPath() != "" {
+		t.Skip("lua_shared is already loaded")
+	}
+
+	err := LoadLuaSharedFrom("libc.so.6")
+	if err == nil || !strings.Contains(*err, "Failed to load function") {
+		t.Fatalf("LoadLuaSharedFrom(libc) = %v, want a missing function error", err)
+	}
+
+	// nothing is left pointing into the closed library
+	if path := GetLuaSharedPath(); path != "" {
+		t.Fatalf("GetLuaSharedPath() = %q after the failed load", path)
+	}
+	if HasFeature("lua_gettop") || HasFeature("lua_getlocal") {
+		t.Fatal("HasFeature reports functions of the failed load")
+	}
+}
@@ -0,0 +1,340 @@
+// Package gluatest runs Go bindings against a real Lua state in `go test`.
+//
+// It loads a stand-in lua_shared (any LuaJIT 2.1 build exporting the same symbols glua looks up) from the path set
+// with SetLuaSharedPath or the GLUA_TEST_LUA_SHARED (or GLUA_LUA_SHARED) environment variable, tests are skipped if
+// none is set.
+//
+// The gmod globals modules usually need (timer, hook, ErrorNoHalt, print...) are emulated with gmodenv.
+//
+// glua keeps its registries in globals, so tests using gluatest must not run in parallel.
+//
+//	func TestAdd(t *testing.T) {
+//		L := gluatest.New(t)
+//		L.PushGoFunc(add)
+//		L.SetGlobal("add")
+//
+//		L.AssertEqual(L.MustCall("add", 1, 2), []any{3})
+//	}
+package gluatest
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/Srlion/glua"
+	"github.com/Srlion/glua/gmodenv"
+)
+
+const LuaSharedEnv = "GLUA_TEST_LUA_SHARED"
+
+// Maximum number of frames Flush runs before giving up, tasks that keep queueing tasks would never finish
+const maxFlushFrames = 10000
+
+var (
+	luaSharedPath string
+	loadOnce      sync.Once
+	loadErr       error
+)
+
+// Sets the path of the stand-in lua_shared library, takes priority over GLUA_TEST_LUA_SHARED and GLUA_LUA_SHARED.
+//
+// Must be called before the first New, eg. in TestMain.
+func SetLuaSharedPath(path string) {
+	luaSharedPath = path
+}
+
+func loadLuaShared() error {
+	loadOnce.Do(func() {
+		path := luaSharedPath
+		if path == "" {
+			path = os.Getenv(LuaSharedEnv)
+		}
+		if path == "" {
+			path = os.Getenv(glua.LuaSharedPathEnv)
+		}
+		if path == "" {
+			loadErr = errSkip
+			return
+		}
+
+		glua.SetLuaSharedPath(path)
+		if err := glua.LoadLuaShared(); err != nil {
+			loadErr = errors.New(*err)
+		}
+	})
+	return loadErr
+}
+
+var errSkip = errors.New("no lua_shared path, use gluatest.SetLuaSharedPath or set " + LuaSharedEnv)
+
+// State is a fresh Lua state bound to a test, errors from helpers fail the test.
+type State struct {
+	glua.State
+	// The emulated gmod globals, use it to assert on printed output or run timers and hooks with Env.Frame
+	Env *gmodenv.Env
+	t   testing.TB
+}
+
+/*
+Creates a fresh Lua state with the standard libraries opened, then opens the module in it with glua.OpenModule
+(the same sequence gmod13_open runs, including the ResetOnOpen functions and OnOpen hooks).
+
+When the test finishes the module is closed with glua.CloseModule and the state is closed.
+
+Errors reported through ErrorNoHalt (eg. a panicking LuaThink function) fail the test, everything printed is captured
+in Env.
+*/
+func New(t testing.TB) *State {
+	t.Helper()
+	return NewEnv(t, gmodenv.Options{})
+}
+
+/*
+Same as New, with the options of the emulated environment (eg. LuaDir for include).
+
+If opts.OnError is set it receives the errors instead of failing the test, for tests expecting errors.
+*/
+func NewEnv(t testing.TB, opts gmodenv.Options) *State {
+	t.Helper()
+
+	if err := loadLuaShared(); err != nil {
+		if err == errSkip {
+			t.Skip(err)
+		}
+		t.Fatalf("gluatest: %v", err)
+	}
+
+	// the state belongs to the thread that created it, calls from other goroutines go through the think queue
+	runtime.LockOSThread()
+
+	L := glua.NewState()
+	L.OpenLibs()
+
+	// gmodenv's globals are Go functions of this module load, and the think queue is driven by its timer library
+	glua.PrepareModule(L)
+
+	s := &State{State: L, t: t}
+	if opts.OnError == nil {
+		opts.OnError = func(msg string) {
+			t.Errorf("lua error: %s", msg)
+		}
+	}
+	s.Env = gmodenv.Install(L, opts)
+
+	if err := glua.OpenModule(L); err != nil {
+		L.Close()
+		runtime.UnlockOSThread()
+		t.Fatalf("gluatest: opening the module: %v", err)
+	}
+
+	t.Cleanup(func() {
+		if err := glua.CloseModule(L); err != nil {
+			t.Errorf("gluatest: closing the module: %v", err)
+		}
+		L.Close()
+		runtime.UnlockOSThread()
+	})
+
+	return s
+}
+
+/*
+Closes the module and opens it again in the same state, like a map change does in gmod. Timers and hooks added by
+Lua code are kept, the emulated globals are installed again for the new module load.
+*/
+func (s *State) Reopen() {
+	s.t.Helper()
+
+	if err := glua.CloseModule(s.State); err != nil {
+		s.t.Fatalf("gluatest: closing the module: %v", err)
+	}
+
+	glua.PrepareModule(s.State)
+	s.Env.Reinstall()
+
+	if err := glua.OpenModule(s.State); err != nil {
+		s.t.Fatalf("gluatest: opening the module: %v", err)
+	}
+}
+
+/*
+Runs frames of the emulated environment, each frame runs due timers (the think queue is one of them, so every
+LuaThink function and up to 3 WaitLuaThink tasks run) and the Think hooks.
+*/
+func (s *State) Step(frames int) {
+	s.Env.Frames(frames)
+}
+
+/*
+Runs frames until every task queued with WaitLuaThink ran.
+
+Tasks queued from goroutines that are still running are not waited for, use glua.WaitGoTasks first.
+*/
+func (s *State) Flush() {
+	s.t.Helper()
+
+	for i := 0; glua.ThinkQueueLen() > 0; i++ {
+		if i >= maxFlushFrames {
+			s.t.Fatalf("gluatest: think queue still has %d tasks after %d frames", glua.ThinkQueueLen(), maxFlushFrames)
+		}
+		s.Env.Frame()
+	}
+}
+
+// Runs code like the Lua REPL does (first as an expression, then as a statement) and returns its results.
+func (s *State) Run(code string) ([]any, error) {
+	top := s.GetTop()
+	defer s.SetTop(top)
+
+	s.pushTraceback()
+
+	if err := s.CompileString("return " + code); err != nil {
+		s.Pop()
+		if err := s.CompileString(code); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.pcall(0, top+1)
+}
+
+// Same as Run, but fails the test on errors.
+func (s *State) Eval(code string) []any {
+	s.t.Helper()
+
+	results, err := s.Run(code)
+	if err != nil {
+		s.t.Fatalf("gluatest: eval %q: %v", code, err)
+	}
+	return results
+}
+
+/*
+Calls the function at the given path (eg. "mymod.db.query") with the arguments pushed with PushAny, and returns its
+results converted with ToAny. It fails the test on errors.
+*/
+func (s *State) MustCall(path string, args ...any) []any {
+	s.t.Helper()
+
+	top := s.GetTop()
+	defer s.SetTop(top)
+
+	s.pushTraceback()
+
+	if !s.pushPath(path) {
+		s.t.Fatalf("gluatest: %s is not a function", path)
+	}
+
+	for _, arg := range args {
+		if err := s.PushAny(arg); err != nil {
+			s.t.Fatalf("gluatest: calling %s: %v", path, err)
+		}
+	}
+
+	results, err := s.pcall(len(args), top+1)
+	if err != nil {
+		s.t.Fatalf("gluatest: calling %s: %v", path, err)
+	}
+	return results
+}
+
+func (s *State) pushTraceback() {
+	s.GetGlobal("debug")
+	s.GetField(-1, "traceback")
+	s.Remove(-2)
+}
+
+func (s *State) pushPath(path string) bool {
+	s.PushValue(glua.LUA_GLOBALSINDEX)
+	for _, part := range strings.Split(path, ".") {
+		if !s.IsTable(-1) {
+			s.Pop()
+			return false
+		}
+		s.GetField(-1, part)
+		s.Remove(-2)
+	}
+
+	if !s.IsFunc(-1) {
+		s.Pop()
+		return false
+	}
+	return true
+}
+
+func (s *State) pcall(nargs, errFunc int) ([]any, error) {
+	if err := s.PCall(nargs, glua.LUA_MULTRET, errFunc); err != nil {
+		return nil, err
+	}
+
+	results := make([]any, 0, s.GetTop()-errFunc)
+	for i := errFunc + 1; i <= s.GetTop(); i++ {
+		results = append(results, s.ToAny(i))
+	}
+	return results, nil
+}
+
+/*
+Fails the test if got and want are not equal, shows a diff otherwise. Both are converted the way a value goes
+through Lua (PushAny then ToAny), so expected values can be written naturally: []any{3, "a"} is equal to the
+results of return 3, "a". Functions, userdata and threads are only compared by type.
+*/
+func (s *State) AssertEqual(got, want any) {
+	s.t.Helper()
+
+	if diff := Diff(s.roundTrip(got), s.roundTrip(want)); diff != "" {
+		s.t.Errorf("lua values are not equal (-got +want):\n%s", diff)
+	}
+}
+
+func (s *State) roundTrip(v any) any {
+	s.t.Helper()
+
+	top := s.GetTop()
+	defer s.SetTop(top)
+
+	if err := s.PushAny(v); err != nil {
+		s.t.Fatalf("gluatest: %v", err)
+	}
+	return s.ToAny(-1)
+}
+
+// Asserts that the value at the given stack index is equal to want.
+func (s *State) AssertValue(idx int, want any) {
+	s.t.Helper()
+	s.AssertEqual(s.ToAny(idx), want)
+}
+
+// Asserts that the global (or a path like "mymod.version") is equal to want.
+func (s *State) AssertGlobal(path string, want any) {
+	s.t.Helper()
+
+	results, err := s.Run(path)
+	if err != nil {
+		s.t.Fatalf("gluatest: reading %s: %v", path, err)
+	}
+
+	var got any
+	if len(results) > 0 {
+		got = results[0]
+	}
+	s.AssertEqual(got, want)
+}
+
+// Fails the test if code doesn't error, or if the error doesn't contain substr.
+func (s *State) AssertError(code string, substr string) {
+	s.t.Helper()
+
+	_, err := s.Run(code)
+	if err == nil {
+		s.t.Errorf("expected %q to error", code)
+		return
+	}
+	if !strings.Contains(err.Error(), substr) {
+		s.t.Errorf("expected error containing %q, got: %v", substr, err)
+	}
+}
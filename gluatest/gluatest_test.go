@@ -0,0 +1,113 @@
+package gluatest_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Srlion/glua"
+	"github.com/Srlion/glua/gluatest"
+)
+
+var (
+	opened int
+	closed int
+)
+
+func init() {
+	glua.ResetOnOpen(func() {
+		opened, closed = 0, 0
+	})
+	glua.OnOpen("gluatest.counter", func(L glua.State) error {
+		opened++
+		return nil
+	})
+	glua.OnClose("gluatest.counter", func(L glua.State) error {
+		closed++
+		return nil
+	})
+
+	glua.Library("gluatest_lib", map[string]any{
+		"answer": 42,
+		"add":    func(a, b int) int { return a + b },
+	})
+}
+
+func TestNewOpensModule(t *testing.T) {
+	ran := false
+	t.Run("open", func(t *testing.T) {
+		L := gluatest.New(t)
+		ran = true
+
+		if opened != 1 || closed != 0 {
+			t.Fatalf("opened %d times, closed %d times", opened, closed)
+		}
+		L.AssertGlobal("gluatest_lib.answer", 42)
+		L.AssertEqual(L.MustCall("gluatest_lib.add", 1, 2), []any{3})
+	})
+
+	if ran && closed != 1 {
+		t.Fatalf("the module was closed %d times after the test, want 1", closed)
+	}
+}
+
+func TestFlushRunsQueuedTasks(t *testing.T) {
+	L := gluatest.New(t)
+
+	glua.Go(func() {
+		glua.WaitLuaThink(func(L glua.State) int {
+			L.PushString("done")
+			L.SetGlobal("task_result")
+			return 0
+		})
+	})
+	glua.WaitGoTasks()
+
+	L.Flush()
+	L.AssertGlobal("task_result", "done")
+}
+
+func TestRunAndAssertions(t *testing.T) {
+	L := gluatest.New(t)
+
+	L.AssertEqual(L.Eval("1 + 1"), []any{2})
+	L.AssertEqual(L.Eval("return {1, 2, {x = true}}"), []any{[]any{1, 2, map[string]any{"x": true}}})
+	L.AssertEqual(L.Eval("return {}"), []any{map[string]any{}})
+	L.AssertError("error('boom')", "boom")
+
+	if _, err := L.Run("local x ="); err == nil {
+		t.Fatal("Run didn't report the syntax error")
+	}
+}
+
+func TestFormat(t *testing.T) {
+	got := gluatest.Format(map[any]any{
+		"b":        true,
+		float64(2): "two",
+		"a":        []any{float64(1), nil},
+	})
+	want := strings.Join([]string{
+		"{",
+		`	[2] = "two",`,
+		`	["a"] = {`,
+		"		1,",
+		"		nil,",
+		"	},",
+		`	["b"] = true,`,
+		"}",
+	}, "\n")
+
+	if got != want {
+		t.Fatalf("Format =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	if diff := gluatest.Diff([]any{float64(1), "a"}, []any{float64(1), "a"}); diff != "" {
+		t.Fatalf("equal values have a diff:\n%s", diff)
+	}
+
+	diff := gluatest.Diff([]any{float64(1), "a"}, []any{float64(1), "b"})
+	if !strings.Contains(diff, `- 	"a",`) || !strings.Contains(diff, `+ 	"b",`) {
+		t.Fatalf("unexpected diff:\n%s", diff)
+	}
+}
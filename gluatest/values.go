@@ -0,0 +1,138 @@
+package gluatest
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/Srlion/glua"
+)
+
+// Returns a line diff of the formatted values (-got +want), or "" if they format the same.
+func Diff(got, want any) string {
+	g, w := Format(got), Format(want)
+	if g == w {
+		return ""
+	}
+
+	return diffLines(strings.Split(g, "\n"), strings.Split(w, "\n"))
+}
+
+// Formats a value returned by glua's ToAny like a Lua literal, with sorted keys so the output is stable. Values
+// referenced through a *glua.LuaObject (functions, userdata...) are formatted as their type name.
+func Format(v any) string {
+	var b strings.Builder
+	format(&b, v, "")
+	return b.String()
+}
+
+func format(b *strings.Builder, v any, indent string) {
+	switch v := v.(type) {
+	case nil:
+		b.WriteString("nil")
+	case bool:
+		b.WriteString(strconv.FormatBool(v))
+	case float64:
+		b.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+	case string:
+		b.WriteString(strconv.Quote(v))
+	case []any:
+		b.WriteString("{\n")
+		for _, item := range v {
+			b.WriteString(indent + "\t")
+			format(b, item, indent+"\t")
+			b.WriteString(",\n")
+		}
+		b.WriteString(indent + "}")
+	case *glua.LuaObject:
+		b.WriteString("<" + v.TypeName() + ">")
+	case map[any]any:
+		if len(v) == 0 {
+			b.WriteString("{}")
+			return
+		}
+		b.WriteString("{\n")
+		for _, key := range sortedKeys(v) {
+			b.WriteString(indent + "\t[")
+			format(b, key, indent+"\t")
+			b.WriteString("] = ")
+			format(b, v[key], indent+"\t")
+			b.WriteString(",\n")
+		}
+		b.WriteString(indent + "}")
+	default:
+		fmt.Fprint(b, v)
+	}
+}
+
+// Numbers first, then strings, then everything else by their formatted value
+func sortedKeys(m map[any]any) []any {
+	keys := make([]any, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	rank := func(k any) int {
+		switch k.(type) {
+		case float64:
+			return 0
+		case string:
+			return 1
+		default:
+			return 2
+		}
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		ri, rj := rank(keys[i]), rank(keys[j])
+		if ri != rj {
+			return ri < rj
+		}
+		switch ki := keys[i].(type) {
+		case float64:
+			return ki < keys[j].(float64)
+		case string:
+			return ki < keys[j].(string)
+		default:
+			return fmt.Sprint(keys[i]) < fmt.Sprint(keys[j])
+		}
+	})
+
+	return keys
+}
+
+// Longest common subsequence diff, values in tests are small enough for the quadratic table
+func diffLines(a, b []string) string {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out strings.Builder
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			out.WriteString("  " + a[i] + "\n")
+			i++
+			j++
+		case j < len(b) && (i == len(a) || lcs[i][j+1] >= lcs[i+1][j]):
+			out.WriteString("+ " + b[j] + "\n")
+			j++
+		default:
+			out.WriteString("- " + a[i] + "\n")
+			i++
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,565 @@
+// Package gmodenv emulates the parts of the Garry's Mod global environment that modules usually touch, so they can
+// run in plain LuaJIT (gluatest). cmd/gluahost has a Lua port of it, its loader doesn't run Go.
+//
+// It provides timer, hook, ErrorNoHalt(WithStack), Msg/MsgN/MsgC/print, SERVER/CLIENT, CurTime/FrameTime and
+// include/AddCSLuaFile backed by a directory. Everything printed and every error is captured for assertions.
+//
+// Time only moves when Frame is called, so timers and Think hooks are deterministic.
+package gmodenv
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Srlion/glua"
+)
+
+const DefaultFrameTime = 1.0 / 66
+
+type Options struct {
+	// Directory include and AddCSLuaFile resolve paths against, like garrysmod/lua
+	LuaDir string
+	// Sets CLIENT instead of SERVER
+	Client bool
+	// Seconds every Frame advances CurTime by, defaults to DefaultFrameTime
+	FrameTime float64
+	// Captured output is also written here if set, eg. os.Stdout
+	Echo io.Writer
+	// Called for every error reported through ErrorNoHalt, ErrorNoHaltWithStack or failing timers/hooks
+	OnError func(msg string)
+}
+
+type Env struct {
+	L    glua.State
+	opts Options
+
+	mu     sync.Mutex
+	output strings.Builder
+	errors []string
+
+	time      float64
+	timers    []*envTimer // in creation order, so frames are deterministic
+	hooks     map[string][]*envHook
+	csLuaFile []string
+}
+
+type envTimer struct {
+	name  string // "" for timer.Simple
+	delay float64
+	reps  int // 0 = forever
+	calls int
+	next  float64
+	fn    int // ref
+
+	running bool // the ref is released after the call if it gets removed while running
+	removed bool
+}
+
+type envHook struct {
+	name    string
+	fn      int // ref
+	removed bool
+}
+
+/*
+Installs the emulated globals into L, overwriting existing ones.
+
+glua's registries have to be initialized before, as the globals are Go functions: call glua.PrepareModule first
+and glua.OpenModule after, so the think queue driver finds the timer and hook libraries.
+
+# Example
+
+	glua.PrepareModule(L)
+	env := gmodenv.Install(L, gmodenv.Options{LuaDir: "testdata/lua", Echo: os.Stdout})
+	glua.OpenModule(L)
+	env.Frame() // runs timers (and so the think queue) and Think hooks
+*/
+func Install(L glua.State, opts Options) *Env {
+	if opts.FrameTime <= 0 {
+		opts.FrameTime = DefaultFrameTime
+	}
+
+	e := &Env{
+		L:     L,
+		opts:  opts,
+		hooks: map[string][]*envHook{},
+	}
+	e.install()
+
+	return e
+}
+
+/*
+Installs the globals again, keeping the timers, hooks and output. The globals are Go functions of the module load
+they were pushed in, so a host reopening the module in the same state calls it between glua.PrepareModule and
+glua.OpenModule.
+*/
+func (e *Env) Reinstall() {
+	e.install()
+}
+
+func (e *Env) install() {
+	L := e.L
+
+	L.PushBool(!e.opts.Client)
+	L.SetGlobal("SERVER")
+	L.PushBool(e.opts.Client)
+	L.SetGlobal("CLIENT")
+
+	e.installTimer()
+	e.installHook()
+	e.installOutput()
+	e.installFiles()
+
+	e.setGlobal("CurTime", func(L glua.State) int {
+		L.PushNumber(e.time)
+		return 1
+	})
+	e.setGlobal("RealTime", func(L glua.State) int {
+		L.PushNumber(e.time)
+		return 1
+	})
+	e.setGlobal("FrameTime", func(L glua.State) int {
+		L.PushNumber(e.opts.FrameTime)
+		return 1
+	})
+}
+
+func (e *Env) setGlobal(name string, fn glua.GoFunc) {
+	e.L.PushGoFunc(fn)
+	e.L.SetGlobal(name)
+}
+
+func (e *Env) setField(name string, fn glua.GoFunc) {
+	e.L.PushGoFunc(fn)
+	e.L.SetField(-2, name)
+}
+
+// Advances time by one frame, runs due timers and then the Think and Tick hooks.
+func (e *Env) Frame() {
+	L := e.L
+	top := L.GetTop()
+	defer L.SetTop(top)
+
+	e.time += e.opts.FrameTime
+
+	for _, t := range slices.Clone(e.timers) {
+		if t.removed || t.next > e.time {
+			continue
+		}
+
+		t.calls++
+		finished := t.reps > 0 && t.calls >= t.reps
+		t.next += max(t.delay, 0)
+		if t.next < e.time { // zero delay timers run every frame
+			t.next = e.time
+		}
+
+		t.running = true
+		L.FromRef(t.fn)
+		if L.PCall(0, 0, 0) != nil {
+			e.reportError(luaError(L))
+		}
+		t.running = false
+
+		if t.removed {
+			L.DeleteRef(t.fn)
+		} else if finished {
+			e.removeTimer(t)
+		}
+	}
+
+	e.runHook("Think", 0)
+	L.SetTop(top)
+	e.runHook("Tick", 0)
+}
+
+// Runs n frames.
+func (e *Env) Frames(n int) {
+	for i := 0; i < n; i++ {
+		e.Frame()
+	}
+}
+
+// Returns everything printed since the last ResetOutput.
+func (e *Env) Output() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.output.String()
+}
+
+func (e *Env) ResetOutput() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.output.Reset()
+}
+
+// Returns every error reported so far.
+func (e *Env) Errors() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return slices.Clone(e.errors)
+}
+
+// Returns the current emulated time in seconds.
+func (e *Env) CurTime() float64 {
+	return e.time
+}
+
+// Returns the files passed to AddCSLuaFile, relative to LuaDir.
+func (e *Env) CSLuaFiles() []string {
+	return slices.Clone(e.csLuaFile)
+}
+
+// Releases the references held for timers and hooks.
+func (e *Env) Close() {
+	for _, t := range e.timers {
+		e.L.DeleteRef(t.fn)
+	}
+	e.timers = nil
+
+	for _, hooks := range e.hooks {
+		for _, h := range hooks {
+			e.L.DeleteRef(h.fn)
+		}
+	}
+	e.hooks = map[string][]*envHook{}
+}
+
+func (e *Env) write(s string) {
+	e.mu.Lock()
+	e.output.WriteString(s)
+	e.mu.Unlock()
+
+	if e.opts.Echo != nil {
+		io.WriteString(e.opts.Echo, s)
+	}
+}
+
+func (e *Env) reportError(msg string) {
+	e.mu.Lock()
+	e.errors = append(e.errors, msg)
+	e.mu.Unlock()
+
+	e.write("[ERROR] " + msg + "\n")
+
+	if e.opts.OnError != nil {
+		e.opts.OnError(msg)
+	}
+}
+
+// Converts the arguments between from and the top with tostring, skipping tables when skipTables is set (MsgC colors).
+func tostrings(L glua.State, from int, skipTables bool) []string {
+	top := L.GetTop()
+	parts := make([]string, 0, top-from+1)
+	for i := from; i <= top; i++ {
+		if skipTables && L.IsTable(i) {
+			continue
+		}
+		L.GetGlobal("tostring")
+		L.PushValue(i)
+		if err := L.PCall(1, 1, 0); err != nil {
+			parts = append(parts, "<"+err.Error()+">")
+		} else {
+			parts = append(parts, L.GetString(-1))
+		}
+		L.Pop()
+	}
+	return parts
+}
+
+// Returns the error value left on the stack by PCall or CompileBuffer as a string. Their Go errors prefix it with the
+// kind of error, gmod reports the message as is.
+func luaError(L glua.State) string {
+	return tostrings(L, L.GetTop(), false)[0]
+}
+
+func (e *Env) installOutput() {
+	e.setGlobal("print", func(L glua.State) int {
+		e.write(strings.Join(tostrings(L, 1, false), "\t") + "\n")
+		return 0
+	})
+	e.setGlobal("Msg", func(L glua.State) int {
+		e.write(strings.Join(tostrings(L, 1, false), ""))
+		return 0
+	})
+	e.setGlobal("MsgN", func(L glua.State) int {
+		e.write(strings.Join(tostrings(L, 1, false), "") + "\n")
+		return 0
+	})
+	e.setGlobal("MsgC", func(L glua.State) int {
+		e.write(strings.Join(tostrings(L, 1, true), ""))
+		return 0
+	})
+	e.setGlobal("ErrorNoHalt", func(L glua.State) int {
+		e.reportError(strings.Join(tostrings(L, 1, false), ""))
+		return 0
+	})
+	e.setGlobal("ErrorNoHaltWithStack", func(L glua.State) int {
+		msg := strings.Join(tostrings(L, 1, false), "")
+
+		L.GetGlobal("debug")
+		L.GetField(-1, "traceback")
+		L.PushString(msg)
+		L.PushNumber(2)
+		if L.PCall(2, 1, 0) == nil {
+			msg = L.GetString(-1)
+		}
+
+		e.reportError(msg)
+		return 0
+	})
+}
+
+func (e *Env) findTimer(name string) *envTimer {
+	for _, t := range e.timers {
+		if t.name != "" && t.name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+func (e *Env) removeTimer(t *envTimer) {
+	e.timers = slices.DeleteFunc(e.timers, func(other *envTimer) bool { return other == t })
+	t.removed = true
+	if !t.running {
+		e.L.DeleteRef(t.fn)
+	}
+}
+
+func (e *Env) installTimer() {
+	L := e.L
+	L.NewTable()
+
+	e.setField("Create", func(L glua.State) int {
+		name := L.CheckString(1)
+		delay := float64(L.CheckNumber(2))
+		reps := int(L.CheckNumber(3))
+		L.CheckFunc(4)
+
+		if old := e.findTimer(name); old != nil {
+			e.removeTimer(old)
+		}
+
+		L.PushValue(4)
+		e.timers = append(e.timers, &envTimer{name: name, delay: delay, reps: reps, next: e.time + delay, fn: L.CreateRef()})
+		return 0
+	})
+	e.setField("Simple", func(L glua.State) int {
+		delay := float64(L.CheckNumber(1))
+		L.CheckFunc(2)
+
+		L.PushValue(2)
+		e.timers = append(e.timers, &envTimer{delay: delay, reps: 1, next: e.time + delay, fn: L.CreateRef()})
+		return 0
+	})
+	e.setField("Remove", func(L glua.State) int {
+		if t := e.findTimer(L.CheckString(1)); t != nil {
+			e.removeTimer(t)
+		}
+		return 0
+	})
+	e.setField("Exists", func(L glua.State) int {
+		L.PushBool(e.findTimer(L.CheckString(1)) != nil)
+		return 1
+	})
+	e.setField("Adjust", func(L glua.State) int {
+		t := e.findTimer(L.CheckString(1))
+		if t == nil {
+			L.PushBool(false)
+			return 1
+		}
+
+		t.delay = float64(L.CheckNumber(2))
+		t.next = e.time + t.delay
+		if !L.IsNoneOrNil(3) {
+			t.reps = int(L.CheckNumber(3))
+			t.calls = 0
+		}
+		if !L.IsNoneOrNil(4) {
+			L.CheckFunc(4)
+			L.DeleteRef(t.fn)
+			L.PushValue(4)
+			t.fn = L.CreateRef()
+		}
+
+		L.PushBool(true)
+		return 1
+	})
+	e.setField("TimeLeft", func(L glua.State) int {
+		t := e.findTimer(L.CheckString(1))
+		if t == nil {
+			return 0
+		}
+		L.PushNumber(t.next - e.time)
+		return 1
+	})
+
+	L.SetGlobal("timer")
+}
+
+func (e *Env) installHook() {
+	L := e.L
+	L.NewTable()
+
+	e.setField("Add", func(L glua.State) int {
+		event := L.CheckString(1)
+		name := L.CheckString(2)
+		L.CheckFunc(3)
+
+		e.removeHook(event, name)
+
+		L.PushValue(3)
+		e.hooks[event] = append(e.hooks[event], &envHook{name: name, fn: L.CreateRef()})
+		return 0
+	})
+	e.setField("Remove", func(L glua.State) int {
+		e.removeHook(L.CheckString(1), L.CheckString(2))
+		return 0
+	})
+	e.setField("Run", func(L glua.State) int {
+		event := L.CheckString(1)
+		return e.runHook(event, L.GetTop()-1)
+	})
+	e.setField("Call", func(L glua.State) int {
+		event := L.CheckString(1)
+		L.Remove(2) // gamemode table, there is no gamemode
+		return e.runHook(event, L.GetTop()-1)
+	})
+	e.setField("GetTable", func(L glua.State) int {
+		L.NewTable()
+		for event, hooks := range e.hooks {
+			L.NewTable()
+			for _, h := range hooks {
+				L.FromRef(h.fn)
+				L.SetField(-2, h.name)
+			}
+			L.SetField(-2, event)
+		}
+		return 1
+	})
+
+	L.SetGlobal("hook")
+}
+
+func (e *Env) removeHook(event, name string) {
+	e.hooks[event] = slices.DeleteFunc(e.hooks[event], func(h *envHook) bool {
+		if h.name == name {
+			e.L.DeleteRef(h.fn)
+			h.removed = true
+			return true
+		}
+		return false
+	})
+}
+
+// Calls every hook of event with the nargs values on top of the stack, stopping at the first one that returns a
+// non nil value. Returns the number of results left on the stack.
+func (e *Env) runHook(event string, nargs int) int {
+	L := e.L
+	argsStart := L.GetTop() - nargs + 1
+
+	for _, h := range slices.Clone(e.hooks[event]) {
+		if h.removed { // removed by a hook that ran before it
+			continue
+		}
+
+		base := L.GetTop()
+
+		L.FromRef(h.fn)
+		for i := 0; i < nargs; i++ {
+			L.PushValue(argsStart + i)
+		}
+
+		if L.PCall(nargs, glua.LUA_MULTRET, 0) != nil {
+			e.reportError(luaError(L))
+			L.SetTop(base)
+			continue
+		}
+
+		if L.GetTop() > base && !L.IsNil(base+1) {
+			return L.GetTop() - base
+		}
+		L.SetTop(base)
+	}
+
+	return 0
+}
+
+// Resolves an include path the way gmod does: relative to the calling file first, then relative to LuaDir.
+func (e *Env) resolveLuaFile(L glua.State, file string) (string, error) {
+	if e.opts.LuaDir == "" {
+		return "", errors.New("no lua directory set")
+	}
+
+	file = path.Clean(filepath.ToSlash(file))
+
+	candidates := []string{}
+	if caller := strings.TrimPrefix(L.GetCallingFileName(), "lua/"); caller != "" {
+		candidates = append(candidates, path.Join(path.Dir(caller), file))
+	}
+	candidates = append(candidates, file)
+
+	for _, rel := range candidates {
+		if strings.HasPrefix(rel, "../") {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(e.opts.LuaDir, filepath.FromSlash(rel))); err == nil {
+			return rel, nil
+		}
+	}
+
+	return "", fmt.Errorf("couldn't include file '%s' - File not found", file)
+}
+
+func (e *Env) installFiles() {
+	e.setGlobal("include", func(L glua.State) int {
+		rel, err := e.resolveLuaFile(L, L.CheckString(1))
+		if err != nil {
+			e.reportError(err.Error())
+			return 0
+		}
+
+		code, err := os.ReadFile(filepath.Join(e.opts.LuaDir, filepath.FromSlash(rel)))
+		if err != nil {
+			e.reportError(err.Error())
+			return 0
+		}
+
+		top := L.GetTop()
+		if L.CompileBuffer(code, "@lua/"+rel) != nil {
+			e.reportError(luaError(L))
+			return 0
+		}
+		if L.PCall(0, glua.LUA_MULTRET, 0) != nil {
+			panic(luaError(L))
+		}
+
+		return L.GetTop() - top
+	})
+	e.setGlobal("AddCSLuaFile", func(L glua.State) int {
+		var rel string
+		if L.IsNoneOrNil(1) {
+			rel = strings.TrimPrefix(L.GetCallingFileName(), "lua/")
+		} else {
+			var err error
+			if rel, err = e.resolveLuaFile(L, L.CheckString(1)); err != nil {
+				e.reportError(err.Error())
+				return 0
+			}
+		}
+
+		if !slices.Contains(e.csLuaFile, rel) {
+			e.csLuaFile = append(e.csLuaFile, rel)
+		}
+		return 0
+	})
+}
@@ -0,0 +1,176 @@
+package gmodenv_test
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Srlion/glua/gluatest"
+	"github.com/Srlion/glua/gmodenv"
+)
+
+// Returns a state whose errors are collected in Env.Errors instead of failing the test.
+func newEnv(t *testing.T, opts gmodenv.Options) *gluatest.State {
+	opts.OnError = func(string) {}
+	return gluatest.NewEnv(t, opts)
+}
+
+func assertErrors(t *testing.T, L *gluatest.State, want ...string) {
+	t.Helper()
+
+	got := L.Env.Errors()
+	if len(got) != len(want) {
+		t.Fatalf("got errors %q, want %d containing %q", got, len(want), want)
+	}
+	for i := range want {
+		if !strings.Contains(got[i], want[i]) {
+			t.Errorf("error %d is %q, want it to contain %q", i, got[i], want[i])
+		}
+	}
+}
+
+func TestTimers(t *testing.T) {
+	L := newEnv(t, gmodenv.Options{FrameTime: 1})
+
+	L.Eval(`
+		calls = {rep = 0, forever = 0, self = 0}
+		timer.Create("rep", 1, 2, function() calls.rep = calls.rep + 1 end)
+		timer.Simple(2, function() calls.simple = CurTime() end)
+		timer.Create("forever", 0, 0, function() calls.forever = calls.forever + 1 end)
+		timer.Create("self", 0, 0, function()
+			calls.self = calls.self + 1
+			timer.Remove("self")
+		end)
+		timer.Create("bad", 0, 1, function() error("boom") end)
+	`)
+
+	L.Step(1)
+	L.AssertGlobal("calls", map[string]any{"rep": 1, "forever": 1, "self": 1})
+	L.AssertGlobal("timer.TimeLeft('rep')", 1)
+	L.AssertGlobal("timer.Exists('self')", false)
+	L.AssertGlobal("timer.Exists('bad')", false)
+	assertErrors(t, L, "boom")
+
+	L.Step(2)
+	L.AssertGlobal("calls", map[string]any{"rep": 2, "forever": 3, "self": 1, "simple": 2})
+	L.AssertGlobal("timer.Exists('rep')", false)
+	L.AssertGlobal("CurTime()", 3)
+	L.AssertGlobal("FrameTime()", 1)
+
+	// a new delay and a single repetition left
+	L.AssertGlobal("timer.Adjust('forever', 5, 1)", true)
+	L.AssertGlobal("timer.Adjust('missing', 5)", false)
+	L.Step(4)
+	L.AssertGlobal("calls.forever", 3)
+	L.Step(1)
+	L.AssertGlobal("calls.forever", 4)
+	L.AssertGlobal("timer.Exists('forever')", false)
+
+	// creating a timer with an existing name replaces it
+	L.Eval(`
+		timer.Create("twice", 0, 0, function() calls.first = true end)
+		timer.Create("twice", 0, 0, function() calls.second = true end)
+	`)
+	L.Step(1)
+	L.AssertGlobal("calls.first", nil)
+	L.AssertGlobal("calls.second", true)
+}
+
+func TestHooks(t *testing.T) {
+	L := newEnv(t, gmodenv.Options{})
+
+	L.Eval(`
+		order = {}
+		hook.Add("Test", "a", function(x) order[#order + 1] = "a" .. x end)
+		hook.Add("Test", "b", function(x) return "b" .. x end)
+		hook.Add("Test", "c", function(x) order[#order + 1] = "c" .. x end)
+	`)
+
+	// the first hook returning a value stops the others
+	L.AssertEqual(L.Eval("return hook.Run('Test', 1)"), []any{"b1"})
+	L.AssertEqual(L.Eval("return hook.Call('Test', nil, 2)"), []any{"b2"})
+	L.AssertGlobal("order", []any{"a1", "a2"})
+
+	L.Eval("hook.Remove('Test', 'b')")
+	L.AssertEqual(L.Eval("return hook.Run('Test', 3)"), []any{})
+	L.AssertGlobal("order", []any{"a1", "a2", "a3", "c3"})
+	L.AssertGlobal("type(hook.GetTable().Test.a)", "function")
+	L.AssertGlobal("hook.GetTable().Test.b", nil)
+
+	L.Eval(`
+		thinks, ticks = 0, 0
+		hook.Add("Think", "count", function() thinks = thinks + 1 end)
+		hook.Add("Think", "bad", function() error("think failed") end)
+		hook.Add("Think", "after", function() ticks = ticks - 1 end)
+		hook.Add("Tick", "count", function() ticks = ticks + 1 end)
+	`)
+	L.Step(3)
+	L.AssertGlobal("thinks", 3)
+	// errors are reported and don't stop the other hooks
+	L.AssertGlobal("ticks", 0)
+	assertErrors(t, L, "think failed", "think failed", "think failed")
+}
+
+func TestOutput(t *testing.T) {
+	L := newEnv(t, gmodenv.Options{Client: true})
+	L.Env.ResetOutput()
+
+	L.Eval(`
+		print("a", 1, nil)
+		Msg("x", 2)
+		MsgN("y")
+		MsgC(Color and Color(255, 0, 0) or {r = 255}, "z", "\n")
+		ErrorNoHalt("e", 1)
+	`)
+
+	if got, want := L.Env.Output(), "a\t1\tnil\nx2y\nz\n[ERROR] e1\n"; got != want {
+		t.Fatalf("output = %q, want %q", got, want)
+	}
+	assertErrors(t, L, "e1")
+
+	L.AssertGlobal("CLIENT", true)
+	L.AssertGlobal("SERVER", false)
+}
+
+func TestInclude(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"autorun/init.lua": `
+			AddCSLuaFile()
+			AddCSLuaFile("shared.lua")
+			return include("sub/helper.lua"), include("shared.lua")
+		`,
+		"autorun/sub/helper.lua": `return "relative to the caller"`,
+		"sub/helper.lua":         `return "relative to the lua directory"`,
+		"shared.lua":             `return "shared"`,
+		"err.lua":                `error("inner")`,
+	}
+	for name, code := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(code), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	L := newEnv(t, gmodenv.Options{LuaDir: dir})
+
+	L.AssertEqual(L.Eval(`return include("autorun/init.lua")`), []any{"relative to the caller", "shared"})
+	L.AssertEqual(L.Eval(`return include("sub/helper.lua")`), []any{"relative to the lua directory"})
+	if got, want := L.Env.CSLuaFiles(), []string{"autorun/init.lua", "shared.lua"}; !slices.Equal(got, want) {
+		t.Fatalf("CSLuaFiles() = %q, want %q", got, want)
+	}
+
+	L.AssertError(`include("err.lua")`, "lua/err.lua:1: inner")
+
+	L.Eval(`include("missing.lua")`)
+	L.Eval(`include("../outside.lua")`)
+	assertErrors(t, L,
+		"couldn't include file 'missing.lua' - File not found",
+		"couldn't include file '../outside.lua' - File not found",
+	)
+}
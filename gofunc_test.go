@@ -0,0 +1,32 @@
+package glua_test
+
+import (
+	"testing"
+
+	"github.com/Srlion/glua"
+	"github.com/Srlion/glua/gluatest"
+)
+
+// Every handle pushed as light userdata must be accepted by a real (x64) LuaJIT
+func TestPushGoFunc(t *testing.T) {
+	L := gluatest.New(t)
+
+	L.PushGoFunc(func(L glua.State) int {
+		L.PushNumber(L.CheckNumber(1) * 2)
+		return 1
+	})
+	L.SetGlobal("double")
+
+	L.AssertEqual(L.MustCall("double", 21), []any{42})
+}
+
+func TestStaleGoFuncErrors(t *testing.T) {
+	L := gluatest.New(t)
+
+	L.PushGoFunc(func(L glua.State) int { return 0 })
+	L.SetGlobal("old")
+
+	glua.AdvanceEpoch()
+
+	L.AssertError("old()", "previous module load")
+}
@@ -14,22 +14,28 @@ var quick_go_ptr_handle uintptr
 func InitGoPtrRegistry(L State) {
 	PtrRegistry = safereg.New()
 	quick_go_ptr = 0
-	quick_go_ptr_handle = PtrRegistry.Store(0) // we just use it as first handle for quick go ptr
+	quick_go_ptr_handle = withEpoch(PtrRegistry.Store(0)) // we just use it as first handle for quick go ptr
 }
 
 // This mallocs a new pointer to a Go object and returns the struct
 func NewGoPointer(val any) unsafe.Pointer {
-	newPtr := PtrRegistry.Store(val)
+	newPtr := withEpoch(PtrRegistry.Store(val))
 	return unsafe.Pointer(newPtr)
 }
 
 // This unwraps a *C.uintptr_t back to what it was before
+//
+// It panics if the pointer was created before the module was reopened.
 func UnwrapGoPointer[T any](ptr unsafe.Pointer) T {
 	handle := uintptr(ptr)
 	// if it's a quick go ptr then return the value
 	if handle == quick_go_ptr_handle {
 		return quick_go_ptr.(T)
 	}
+	handle, err := checkEpoch(handle, "a Go pointer")
+	if err != nil {
+		panic(err.Error())
+	}
 	val, _ := PtrRegistry.Get(handle)
 	return val.(T)
 }
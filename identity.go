@@ -0,0 +1,81 @@
+package glua
+
+import (
+	"reflect"
+	"runtime/cgo"
+)
+
+// Registry key prefix of the weak valued tables mapping Go pointers to their userdata, one table per metatable
+const identityCachePrefix = "glua.identity:"
+
+/*
+Same as NewUserData, but pushing the same Go pointer again returns the same userdata while Lua keeps it alive, so
+`==` and table keys work in Lua.
+
+The userdata are kept in a weak valued registry table, entries vanish when Lua collects them. Userdata pushed with
+it must be freed with FreeUserData in __gc (not handle.Delete()), so a userdata that's being finalized is never
+handed out again.
+
+It panics if ptr isn't a non-nil pointer.
+
+# Example
+
+	player := players[id]
+	L.PushCachedUserData(player, &playerMeta) // same userdata every time for the same *Player
+*/
+func (L State) PushCachedUserData(ptr any, metatable *string) cgo.Handle {
+	rv := reflect.ValueOf(ptr)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		panic("PushCachedUserData expects a non-nil pointer")
+	}
+	key := rv.Pointer()
+
+	name := ""
+	if metatable != nil {
+		name = *metatable
+	}
+
+	L.pushIdentityCache(name)
+	cache := L.GetTop()
+
+	L.PushLightUserData(key)
+	L.RawGet(cache)
+	if L.Type(-1) == LUA_TUSERDATA {
+		block := L.toGoUserData(-1)
+		// a userdata that was freed can still be in the table until the next cycle clears it
+		if block.handle != 0 && block.epoch == CurrentEpoch() && block.handle.Value() == ptr {
+			h := block.handle
+			L.Remove(cache)
+			return h
+		}
+	}
+	L.Pop()
+
+	h := L.NewUserData(ptr, metatable)
+	L.PushLightUserData(key)
+	L.PushValue(-2)
+	L.RawSet(cache)
+
+	L.Remove(cache)
+	return h
+}
+
+// Pushes the identity cache of the metatable name, creating it if needed.
+func (L State) pushIdentityCache(name string) {
+	key := identityCachePrefix + name
+
+	L.GetField(LUA_REGISTRYINDEX, key)
+	if L.IsTable(-1) {
+		return
+	}
+	L.Pop()
+
+	L.NewTable()
+	L.CreateTable(0, 1)
+	L.PushString("v")
+	L.SetField(-2, "__mode")
+	L.SetMetatable(-2)
+
+	L.PushValue(-1)
+	L.SetField(LUA_REGISTRYINDEX, key)
+}
@@ -0,0 +1,71 @@
+package glua_test
+
+import (
+	"testing"
+
+	"github.com/Srlion/glua"
+	"github.com/Srlion/glua/gluatest"
+)
+
+type identityItem struct{ id int }
+
+var identityMeta = "identity_test_item"
+
+func TestCachedUserDataIdentity(t *testing.T) {
+	L := gluatest.New(t)
+
+	freed := 0
+	L.NewMetaTable(identityMeta)
+	L.PushGoFunc(func(L glua.State) int {
+		freed++
+		L.FreeUserData(1)
+		return 0
+	})
+	L.SetField(-2, "__gc")
+	L.Pop()
+
+	items := map[int]*identityItem{1: {1}, 2: {2}}
+	L.PushGoFunc(func(L glua.State) int {
+		L.PushCachedUserData(items[int(L.CheckNumber(1))], &identityMeta)
+		return 1
+	})
+	L.SetGlobal("get_item")
+
+	// the same pointer gives the same userdata and handle
+	h1 := L.PushCachedUserData(items[1], &identityMeta)
+	h2 := L.PushCachedUserData(items[1], &identityMeta)
+	if h1 != h2 || !L.AreRawEqual(-1, -2) {
+		t.Fatalf("pushing the same pointer twice gave different userdata (handles %v and %v)", h1, h2)
+	}
+	L.PopN(2)
+
+	L.AssertEqual(L.Eval(`
+		local a, b = get_item(1), get_item(2)
+		local set = {[a] = "one"}
+		return a == get_item(1), rawequal(a, get_item(1)), a ~= b, set[get_item(1)], set[b]
+	`), []any{true, true, true, "one", nil})
+
+	// once Lua drops every reference the userdata is collected and its cache entry vanishes
+	L.Eval(`kept = get_item(2)`)
+	L.CollectGarbage()
+	L.CollectGarbage()
+	if freed != 1 {
+		t.Fatalf("%d userdata were freed, want 1", freed)
+	}
+	L.AssertEqual(L.Eval(`
+		local n = 0
+		for _ in pairs(debug.getregistry()["glua.identity:`+identityMeta+`"]) do n = n + 1 end
+		return n
+	`), []any{1})
+
+	// pushing the pointer again creates a new userdata with a new handle
+	h3 := L.PushCachedUserData(items[1], &identityMeta)
+	L.Pop()
+	if h3 == h1 {
+		t.Fatal("the freed handle was handed out again")
+	}
+	if got := h3.Value(); got != items[1] {
+		t.Fatalf("new handle holds %v, want %v", got, items[1])
+	}
+	L.AssertEqual(L.Eval(`return kept == get_item(2)`), []any{true})
+}
@@ -0,0 +1,144 @@
+package glua
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Go can't create a type with methods at runtime (reflect can only build structs, funcs, maps...), so a Lua table
+// implements a Go interface through an adapter type that forwards every method to LuaObject.Call. cmd/gluagen
+// generates and registers the adapter of interfaces marked with //glua:interface, RegisterAdapter is what it calls
+// and can be used directly for interfaces gluagen doesn't support. Implement then works for any table.
+
+var (
+	adaptersMu sync.RWMutex
+	adapters   = map[reflect.Type]func(*LuaObject) any{}
+)
+
+/*
+Registers the adapter that turns a Lua table into an I, call it from init. It panics if I isn't an interface or
+already has an adapter.
+
+Adapters are usually generated, mark the interface with //glua:interface and run cmd/gluagen. A hand written one
+looks like this:
+
+# Example
+
+	type Handler interface {
+		Name() string
+		Handle(msg string) error
+	}
+
+	type luaHandler struct{ *glua.LuaObject }
+
+	func (h luaHandler) Name() string {
+		name, _ := glua.CallAs[string](h.LuaObject, "Name")
+		return name
+	}
+
+	func (h luaHandler) Handle(msg string) error {
+		_, err := h.Call("Handle", msg)
+		return err
+	}
+
+	func init() {
+		glua.RegisterAdapter(func(o *glua.LuaObject) Handler { return luaHandler{o} })
+	}
+*/
+func RegisterAdapter[I any](factory func(*LuaObject) I) {
+	t := reflect.TypeFor[I]()
+	if t.Kind() != reflect.Interface {
+		panic(fmt.Sprintf("glua: RegisterAdapter expects an interface type, got %s", t))
+	}
+
+	adaptersMu.Lock()
+	defer adaptersMu.Unlock()
+
+	if _, ok := adapters[t]; ok {
+		panic(fmt.Sprintf("glua: %s already has an adapter", t))
+	}
+	adapters[t] = func(o *LuaObject) any {
+		return factory(o)
+	}
+}
+
+/*
+Returns a Go value implementing I whose methods call the functions with the same names on the table at the given
+index (as methods, so they get the table as self). Calls from other goroutines are marshalled to the main thread.
+
+Returns an error if the value isn't a table, if I has no adapter (see RegisterAdapter and the //glua:interface
+directive of cmd/gluagen) or if the table is missing one of the methods of I.
+
+Limitation: every interface needs an adapter, Go can't give a type methods at runtime. Marking the interface with
+//glua:interface is the only glue it needs, but an interface that isn't marked (or registered by hand) can't be
+implemented from Lua.
+
+# Example
+
+	L.PushGoFunc(func(L glua.State) int {
+		h, err := glua.Implement[Handler](L, 1)
+		if err != nil {
+			L.ArgError(1, err.Error())
+		}
+		handlers = append(handlers, h)
+		return 0
+	})
+	L.SetGlobal("RegisterHandler")
+
+	-- lua
+	RegisterHandler({
+		Name = function(self) return "echo" end,
+		Handle = function(self, msg) print(msg) end,
+	})
+*/
+func Implement[I any](L State, idx int) (I, error) {
+	var zero I
+
+	t := reflect.TypeFor[I]()
+	if t.Kind() != reflect.Interface {
+		return zero, fmt.Errorf("%s is not an interface", t)
+	}
+
+	v, ok, err := implementType(L, idx, t)
+	if !ok {
+		return zero, fmt.Errorf("%s has no adapter, generate one with gluagen or register one with RegisterAdapter", t)
+	}
+	if err != nil {
+		return zero, err
+	}
+	return v.Interface().(I), nil
+}
+
+// Returns false if t has no adapter.
+func implementType(L State, idx int, t reflect.Type) (reflect.Value, bool, error) {
+	adaptersMu.RLock()
+	factory, ok := adapters[t]
+	adaptersMu.RUnlock()
+	if !ok {
+		return reflect.Value{}, false, nil
+	}
+
+	idx = absIndex(L, idx)
+	if !L.IsTable(idx) {
+		return reflect.Value{}, true, fmt.Errorf("%s expected, got %s", t, L.TypeName(L.Type(idx)))
+	}
+
+	var missing []string
+	for i := 0; i < t.NumMethod(); i++ {
+		name := t.Method(i).Name
+		L.GetField(idx, name)
+		if !isCallable(L, -1) {
+			missing = append(missing, name)
+		}
+		L.Pop()
+	}
+	if len(missing) > 0 {
+		return reflect.Value{}, true, fmt.Errorf("table doesn't implement %s, missing %s", t, strings.Join(missing, ", "))
+	}
+
+	v := reflect.New(t).Elem()
+	v.Set(reflect.ValueOf(factory(L.NewLuaObject(idx))))
+	return v, true, nil
+}
@@ -0,0 +1,43 @@
+package glua
+
+/*
+#include "c/glua.h"
+*/
+import "C"
+
+// Modes of SetJITMode, from luajit.h
+const (
+	LUAJIT_MODE_ENGINE     = 0 // the whole JIT compiler
+	LUAJIT_MODE_DEBUG      = 1 // debug hooks in JIT compiled code
+	LUAJIT_MODE_FUNC       = 2 // a function
+	LUAJIT_MODE_ALLFUNC    = 3 // a function and every function it creates
+	LUAJIT_MODE_ALLSUBFUNC = 4 // only the functions a function creates
+	LUAJIT_MODE_TRACE      = 5 // a trace number
+	LUAJIT_MODE_WRAPCFUNC  = 0x10
+)
+
+// Flags of SetJITMode, or'd with the mode
+const (
+	LUAJIT_MODE_OFF   = 0x0000
+	LUAJIT_MODE_ON    = 0x0100
+	LUAJIT_MODE_FLUSH = 0x0200
+)
+
+/*
+Controls the JIT compiler like jit.on/jit.off/jit.flush do, idx is the function (or trace number) the mode applies to
+and is ignored for LUAJIT_MODE_ENGINE.
+
+Returns false if the mode couldn't be set, or if lua_shared doesn't export luaJIT_setmode.
+
+# Example
+
+	// don't compile the function at index 1, eg. because it's hooked by a profiler
+	L.SetJITMode(1, glua.LUAJIT_MODE_FUNC|glua.LUAJIT_MODE_OFF)
+*/
+func (L State) SetJITMode(idx, mode int) bool {
+	if !HasFeature("luaJIT_setmode") {
+		return false
+	}
+
+	return C.luaJIT_setmode_wrap(L.c(), C.int(idx), C.int(mode)) != 0
+}
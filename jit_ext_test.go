@@ -0,0 +1,32 @@
+package glua_test
+
+import (
+	"testing"
+
+	"github.com/Srlion/glua"
+	"github.com/Srlion/glua/gluatest"
+)
+
+func TestSetJITMode(t *testing.T) {
+	L := gluatest.New(t)
+
+	if !glua.HasFeature("lua_gettop") {
+		t.Fatal("HasFeature doesn't report a required function")
+	}
+	if glua.HasFeature("lua_not_a_function") {
+		t.Fatal("HasFeature reports an unknown function")
+	}
+	if !glua.HasFeature("luaJIT_setmode") {
+		t.Skip("lua_shared doesn't export luaJIT_setmode")
+	}
+
+	if !L.SetJITMode(0, glua.LUAJIT_MODE_ENGINE|glua.LUAJIT_MODE_OFF) {
+		t.Fatal("turning the JIT off failed")
+	}
+	L.AssertGlobal("jit.status()", false)
+
+	if !L.SetJITMode(0, glua.LUAJIT_MODE_ENGINE|glua.LUAJIT_MODE_ON) {
+		t.Fatal("turning the JIT on failed")
+	}
+	L.AssertGlobal("jit.status()", true)
+}
@@ -0,0 +1,325 @@
+package glua
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Registry key of a weak keyed table mapping read-only library tables to the tables holding their members
+const readOnlyLibsKey = "glua.readonly_libs"
+
+type libraryOptions struct {
+	readOnly bool
+}
+
+type LibraryOption func(*libraryOptions)
+
+// Number of Library calls per name, every call gets its own lifecycle hooks
+var (
+	librariesMu sync.Mutex
+	libraries   = map[string]int{}
+)
+
+// Makes the library table (and its sub-libraries) read-only, assigning to it raises a Lua error.
+//
+// The members are stored in a hidden table behind __index, so pairs/next on the library table don't see them.
+func ReadOnly() LibraryOption {
+	return func(o *libraryOptions) {
+		o.readOnly = true
+	}
+}
+
+/*
+Registers a library that is created every time the module is opened and removed when it's closed.
+
+Members can be GoFuncs, any other Go function (converted like WrapFunc), values bound with Bind, anything
+PushAny accepts or map[string]any for sub-libraries. Existing tables along
+the name are extended, so packages can add to the same namespace, and Library can be called more than once with
+the same name.
+
+# Example
+
+	func init() {
+		glua.Library("mymod.db", map[string]any{
+			"query":   query,
+			"VERSION": 3,
+			"flags": map[string]any{
+				"READ_ONLY": 1,
+			},
+		}, glua.ReadOnly())
+	}
+
+	-- lua
+	mymod.db.query("SELECT 1")
+	print(mymod.db.flags.READ_ONLY)
+*/
+func Library(name string, members map[string]any, opts ...LibraryOption) {
+	librariesMu.Lock()
+	libraries[name]++
+	hookName := "library:" + name
+	if n := libraries[name]; n > 1 {
+		hookName += "#" + strconv.Itoa(n)
+	}
+	librariesMu.Unlock()
+
+	addStubLibrary(name, members)
+
+	OnOpen(hookName, func(L State) error {
+		return L.RegisterLibrary(name, members, opts...)
+	})
+
+	OnClose(hookName, func(L State) error {
+		L.UnregisterLibrary(name, members)
+		return nil
+	})
+}
+
+/*
+Creates or extends the table at the dotted name (relative to _G) and sets the members in it, see Library.
+
+It pushes nothing.
+*/
+func (L State) RegisterLibrary(name string, members map[string]any, opts ...LibraryOption) error {
+	var o libraryOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	top := L.GetTop()
+	defer L.SetTop(top)
+
+	if err := L.pushLibraryTable(name); err != nil {
+		return err
+	}
+
+	return L.setLibraryMembers(name, members, o.readOnly)
+}
+
+/*
+Removes the members of a library registered with RegisterLibrary, including the ones of its sub-libraries. Members
+set by others are left alone, tables along the way are removed from their parent if they are left empty.
+*/
+func (L State) UnregisterLibrary(name string, members map[string]any) {
+	top := L.GetTop()
+	defer L.SetTop(top)
+
+	parts := strings.Split(name, ".")
+
+	L.PushValue(LUA_GLOBALSINDEX)
+	for _, part := range parts[:len(parts)-1] {
+		L.PushString(part)
+		L.RawGet(-2)
+		if !L.IsTable(-1) {
+			return
+		}
+		L.pushLibraryMembersTable(-1)
+		L.Remove(-2)
+		L.Remove(-2)
+	}
+
+	L.unregisterLibraryMembers(parts[len(parts)-1], members)
+}
+
+// Removes the members from the library stored at key in the table at the top of the stack, and the library itself
+// if it's left empty.
+func (L State) unregisterLibraryMembers(key string, members map[string]any) {
+	parent := L.GetTop()
+
+	L.PushString(key)
+	L.RawGet(parent)
+	if !L.IsTable(-1) {
+		L.Pop()
+		return
+	}
+	L.pushLibraryMembersTable(-1)
+	L.Remove(-2)
+
+	for key, value := range members {
+		if sub, ok := value.(map[string]any); ok {
+			L.unregisterLibraryMembers(key, sub)
+			continue
+		}
+		L.PushString(key)
+		L.PushNil()
+		L.RawSet(-3)
+	}
+
+	L.PushNil()
+	empty := !L.Next(-2)
+	L.SetTop(parent)
+
+	if empty {
+		L.PushString(key)
+		L.PushNil()
+		L.RawSet(parent)
+	}
+}
+
+// Pushes the library table at the dotted name, creating the missing tables along it. Read-only tables along the
+// name are walked through their members table.
+func (L State) pushLibraryTable(name string) error {
+	parts := strings.Split(name, ".")
+
+	L.PushValue(LUA_GLOBALSINDEX)
+	for i, part := range parts {
+		if part == "" {
+			L.Pop()
+			return fmt.Errorf("invalid library name '%s'", name)
+		}
+
+		if err := L.FindTable(-1, part, 0); err != nil {
+			L.Pop()
+			return fmt.Errorf("library '%s': %w", name, err)
+		}
+		if i < len(parts)-1 {
+			L.pushLibraryMembersTable(-1)
+			L.Remove(-2)
+		}
+		L.Remove(-2)
+	}
+
+	return nil
+}
+
+// Sets the members in the library table at the top of the stack, the table is replaced with its members table.
+func (L State) setLibraryMembers(name string, members map[string]any, readOnly bool) error {
+	if readOnly {
+		L.makeReadOnlyLibrary(name)
+	} else {
+		L.pushLibraryMembersTable(-1)
+		L.Remove(-2)
+	}
+
+	for key, value := range members {
+		if sub, ok := value.(map[string]any); ok {
+			L.PushString(key)
+			L.RawGet(-2)
+			if L.IsNil(-1) {
+				L.Pop()
+				L.NewTable()
+				L.PushString(key)
+				L.PushValue(-2)
+				L.RawSet(-4)
+			} else if !L.IsTable(-1) {
+				L.Pop()
+				return fmt.Errorf("library '%s': name conflict at '%s'", name, key)
+			}
+
+			err := L.setLibraryMembers(name+"."+key, sub, readOnly)
+			L.Pop()
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		L.PushString(key)
+		if err := L.pushLibraryMember(value); err != nil {
+			L.Pop()
+			return fmt.Errorf("library '%s': member '%s': %w", name, key, err)
+		}
+		L.RawSet(-3)
+	}
+
+	return nil
+}
+
+func (L State) pushLibraryMember(value any) error {
+	if fn, ok := value.(GoFunc); ok {
+		L.PushGoFunc(fn)
+		return nil
+	}
+
+	return L.PushAny(value)
+}
+
+// Pushes the registry table mapping read-only libraries to their members, creating it if needed.
+func (L State) pushReadOnlyLibs() {
+	L.GetField(LUA_REGISTRYINDEX, readOnlyLibsKey)
+	if L.IsTable(-1) {
+		return
+	}
+	L.Pop()
+
+	L.NewTable()
+	L.CreateTable(0, 1)
+	L.PushString("k")
+	L.SetField(-2, "__mode")
+	L.SetMetatable(-2)
+
+	L.PushValue(-1)
+	L.SetField(LUA_REGISTRYINDEX, readOnlyLibsKey)
+}
+
+// Pushes the table holding the members of the table at idx, which is the table itself unless it's read-only.
+func (L State) pushLibraryMembersTable(idx int) {
+	L.PushValue(idx)
+	L.pushReadOnlyLibs()
+	L.PushValue(-2)
+	L.RawGet(-2)
+	L.Remove(-2)
+
+	if L.IsTable(-1) {
+		L.Remove(-2)
+	} else {
+		L.Pop()
+	}
+}
+
+// Moves the contents of the table at the top of the stack to a hidden members table and makes it read-only, the
+// table is replaced with its members table. Tables that are already read-only keep their members table.
+func (L State) makeReadOnlyLibrary(name string) {
+	library := L.GetTop()
+
+	L.pushReadOnlyLibs()
+	L.PushValue(library)
+	L.RawGet(-2)
+	if L.IsTable(-1) {
+		L.Replace(library)
+		L.Pop()
+		return
+	}
+	L.Pop()
+
+	L.NewTable()
+	members := L.GetTop()
+
+	L.PushNil()
+	for L.Next(library) {
+		L.PushValue(-2)
+		L.Insert(-2)
+		L.RawSet(members)
+	}
+
+	// restart the traversal every time, assigning to keys that are not being traversed isn't allowed
+	for {
+		L.PushNil()
+		if !L.Next(library) {
+			break
+		}
+		L.Pop()
+		L.PushNil()
+		L.RawSet(library)
+	}
+
+	L.PushValue(library)
+	L.PushValue(members)
+	L.RawSet(members - 1)
+
+	L.CreateTable(0, 3)
+	L.PushValue(members)
+	L.SetField(-2, "__index")
+	L.PushGoFunc(func(L State) int {
+		panic(fmt.Sprintf("attempt to modify read-only library '%s'", name))
+	})
+	L.SetField(-2, "__newindex")
+	L.PushBool(false)
+	L.SetField(-2, "__metatable")
+	L.SetMetatable(library)
+
+	// leave the members table where the library was
+	L.Replace(library)
+	L.Pop()
+}
@@ -0,0 +1,49 @@
+package glua_test
+
+import (
+	"testing"
+
+	"github.com/Srlion/glua"
+	"github.com/Srlion/glua/gluatest"
+)
+
+func TestReadOnlyLibrary(t *testing.T) {
+	L := gluatest.New(t)
+
+	err := L.RegisterLibrary("ro", map[string]any{
+		"VERSION": 3,
+		"flags":   map[string]any{"READ": 1},
+	}, glua.ReadOnly())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	L.AssertGlobal("ro.VERSION", 3)
+	L.AssertGlobal("ro.flags.READ", 1)
+	L.AssertError("ro.VERSION = 4", "read-only library 'ro'")
+	L.AssertError("ro.flags.WRITE = 2", "read-only library 'ro.flags'")
+	L.AssertError("setmetatable(ro, nil)", "protected metatable")
+}
+
+func TestUnregisterLibraryKeepsOtherMembers(t *testing.T) {
+	L := gluatest.New(t)
+
+	mine := map[string]any{
+		"a":   1,
+		"sub": map[string]any{"b": 2},
+	}
+	if err := L.RegisterLibrary("shared", mine); err != nil {
+		t.Fatal(err)
+	}
+	L.Eval("shared.sub.other = true")
+
+	L.UnregisterLibrary("shared", mine)
+
+	L.AssertGlobal("shared.a", nil)
+	L.AssertGlobal("shared.sub.b", nil)
+	L.AssertGlobal("shared.sub.other", true)
+
+	L.Eval("shared.sub.other = nil")
+	L.UnregisterLibrary("shared", mine)
+	L.AssertGlobal("shared", nil)
+}
@@ -0,0 +1,17 @@
+package glua
+
+import "testing"
+
+func TestLibraryCalledTwice(t *testing.T) {
+	isolateLifecycle(t)
+
+	Library("glua_test_lib", map[string]any{"a": 1})
+	Library("glua_test_lib", map[string]any{"b": 2})
+
+	if len(openHooks) != 2 || len(closeHooks) != 2 {
+		t.Fatalf("got %d open and %d close hooks, want 2 of each", len(openHooks), len(closeHooks))
+	}
+	if openHooks[0].name == openHooks[1].name {
+		t.Fatalf("both calls use the hook name %q", openHooks[0].name)
+	}
+}
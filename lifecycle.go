@@ -0,0 +1,299 @@
+package glua
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Lifecycle hooks let every package of a module register its own open/close functions instead of fighting over
+// GMOD13_OPEN/GMOD13_CLOSE.
+//
+// Open hooks run after a hook they depend on. An open hook and a close hook with the same name are a pair: the close
+// hook only runs if the open hook succeeded, and paired close hooks run in the exact reverse of the order their open
+// hooks succeeded in. Close hooks without an open hook run before the hooks named in their deps. If an open hook
+// fails, the close hooks of the ones that already opened are run right away so the module isn't left half
+// initialized.
+
+type LifecycleFunc func(L State) error
+
+type lifecycleHook struct {
+	name string
+	fn   LifecycleFunc
+	deps []string
+}
+
+var (
+	lifecycleMu sync.Mutex
+	openHooks   []lifecycleHook
+	closeHooks  []lifecycleHook
+	resetFuncs  []func()
+
+	// Names of the open hooks that succeeded in the current module load, in the order they succeeded. Names are
+	// removed from openedHooks once their close hook ran.
+	openedOrder []string
+	openedHooks = map[string]bool{}
+)
+
+/*
+Registers a function that runs when the module is opened, after the hooks named in deps.
+
+It's meant to be called from init, hooks registered while the module is open run the next time it's opened.
+It panics if a hook with the same name is already registered.
+
+# Example
+
+	func init() {
+		glua.OnOpen("db", func(L glua.State) error {
+			return db.Connect(config.DSN)
+		}, "config")
+
+		glua.OnClose("db", func(L glua.State) error {
+			return db.Close()
+		})
+	}
+*/
+func OnOpen(name string, fn LifecycleFunc, deps ...string) {
+	lifecycleMu.Lock()
+	defer lifecycleMu.Unlock()
+	openHooks = addLifecycleHook(openHooks, "OnOpen", name, fn, deps)
+}
+
+/*
+Registers a function that runs when the module is closed, before the hooks named in deps.
+
+If an OnOpen hook has the same name, it only runs if that hook succeeded and it runs in the reverse order of the open
+hooks instead (deps are ignored).
+*/
+func OnClose(name string, fn LifecycleFunc, deps ...string) {
+	lifecycleMu.Lock()
+	defer lifecycleMu.Unlock()
+	closeHooks = addLifecycleHook(closeHooks, "OnClose", name, fn, deps)
+}
+
+/*
+Registers a function that resets package level variables, it runs every time the module is opened before any
+OnOpen hook.
+
+Go can't dlclose the module, so globals keep their values from the previous load unless they are reset.
+
+# Example
+
+	var players map[string]*Player
+
+	func init() {
+		glua.ResetOnOpen(func() {
+			players = map[string]*Player{}
+		})
+	}
+*/
+func ResetOnOpen(reset func()) {
+	lifecycleMu.Lock()
+	defer lifecycleMu.Unlock()
+	resetFuncs = append(resetFuncs, reset)
+}
+
+func addLifecycleHook(hooks []lifecycleHook, kind, name string, fn LifecycleFunc, deps []string) []lifecycleHook {
+	if name == "" {
+		panic("glua: " + kind + " requires a name")
+	}
+	if fn == nil {
+		panic("glua: " + kind + "(" + name + ") has a nil function")
+	}
+	for _, h := range hooks {
+		if h.name == name {
+			panic("glua: " + kind + "(" + name + ") is already registered")
+		}
+	}
+	return append(hooks, lifecycleHook{name: name, fn: fn, deps: deps})
+}
+
+// Sorts hooks so every hook comes after its dependencies, hooks without an order between them keep their
+// registration order.
+func sortLifecycleHooks(hooks []lifecycleHook) ([]lifecycleHook, error) {
+	byName := make(map[string]int, len(hooks))
+	for i, h := range hooks {
+		byName[h.name] = i
+	}
+
+	for _, h := range hooks {
+		for _, dep := range h.deps {
+			if _, ok := byName[dep]; !ok {
+				return nil, fmt.Errorf("%q depends on %q which is not registered", h.name, dep)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make([]int, len(hooks))
+	sorted := make([]lifecycleHook, 0, len(hooks))
+	var path []string
+
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch state[i] {
+		case visited:
+			return nil
+		case visiting:
+			return fmt.Errorf("dependency cycle: %s -> %s", strings.Join(path, " -> "), hooks[i].name)
+		}
+
+		state[i] = visiting
+		path = append(path, hooks[i].name)
+		for _, dep := range hooks[i].deps {
+			if err := visit(byName[dep]); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[i] = visited
+
+		sorted = append(sorted, hooks[i])
+		return nil
+	}
+
+	for i := range hooks {
+		if err := visit(i); err != nil {
+			return nil, err
+		}
+	}
+
+	return sorted, nil
+}
+
+func callLifecycleFunc(L State, kind string, h lifecycleHook) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+		if err != nil {
+			err = fmt.Errorf("%s(%s): %w", kind, h.name, err)
+		}
+	}()
+
+	return h.fn(L)
+}
+
+// Runs the reset functions then the open hooks in dependency order, if one fails the hooks that already opened are
+// closed again and every error is returned joined.
+func runOpenHooks(L State) error {
+	lifecycleMu.Lock()
+	resets := append([]func(){}, resetFuncs...)
+	opens := append([]lifecycleHook{}, openHooks...)
+	closes := append([]lifecycleHook{}, closeHooks...)
+	lifecycleMu.Unlock()
+
+	openedOrder = nil
+	openedHooks = map[string]bool{}
+
+	for _, reset := range resets {
+		reset()
+	}
+
+	sorted, err := sortLifecycleHooks(opens)
+	if err != nil {
+		return fmt.Errorf("OnOpen: %w", err)
+	}
+
+	for _, h := range sorted {
+		if err := callLifecycleFunc(L, "OnOpen", h); err != nil {
+			return errors.Join(err, rollbackOpenHooks(L, closes))
+		}
+		openedOrder = append(openedOrder, h.name)
+		openedHooks[h.name] = true
+	}
+
+	return nil
+}
+
+// Runs the close hooks paired with the open hooks that succeeded, nothing else was initialized yet.
+func rollbackOpenHooks(L State, closes []lifecycleHook) error {
+	paired := closes[:0:0]
+	for _, h := range closes {
+		if openedHooks[h.name] {
+			paired = append(paired, h)
+		}
+	}
+	return runCloseHookList(L, paired)
+}
+
+// Runs the close hooks in reverse dependency order and returns every error joined, a failing hook doesn't stop
+// the others from running.
+func runCloseHooks(L State) error {
+	lifecycleMu.Lock()
+	opens := make(map[string]bool, len(openHooks))
+	for _, h := range openHooks {
+		opens[h.name] = true
+	}
+	closes := make([]lifecycleHook, 0, len(closeHooks))
+	for _, h := range closeHooks {
+		// close hooks paired with an open hook that didn't succeed have nothing to close
+		if !opens[h.name] || openedHooks[h.name] {
+			closes = append(closes, h)
+		}
+	}
+	lifecycleMu.Unlock()
+
+	return runCloseHookList(L, closes)
+}
+
+func runCloseHookList(L State, closes []lifecycleHook) error {
+	names := make(map[string]bool, len(closes))
+	for _, h := range closes {
+		names[h.name] = true
+	}
+
+	// a paired hook closes right before the one that opened before it, which gives the exact reverse of the open
+	// order
+	previous := map[string]string{}
+	last := ""
+	for _, name := range openedOrder {
+		if !openedHooks[name] || !names[name] {
+			continue
+		}
+		if last != "" {
+			previous[name] = last
+		}
+		last = name
+	}
+
+	for i, h := range closes {
+		if openedHooks[h.name] {
+			closes[i].deps = nil
+			if prev, ok := previous[h.name]; ok {
+				closes[i].deps = []string{prev}
+			}
+			continue
+		}
+
+		// dependencies that are not part of this run (eg. rolling back) don't affect the order
+		deps := make([]string, 0, len(h.deps))
+		for _, dep := range h.deps {
+			if names[dep] {
+				deps = append(deps, dep)
+			}
+		}
+		closes[i].deps = deps
+	}
+
+	sorted, err := sortLifecycleHooks(closes)
+	if err != nil {
+		return fmt.Errorf("OnClose: %w", err)
+	}
+
+	var errs []error
+	for i := len(sorted) - 1; i >= 0; i-- {
+		h := sorted[i]
+		if err := callLifecycleFunc(L, "OnClose", h); err != nil {
+			errs = append(errs, err)
+		}
+		delete(openedHooks, h.name)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,135 @@
+package glua
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Replaces the registered hooks for the duration of the test.
+func isolateLifecycle(t *testing.T) {
+	t.Helper()
+
+	lifecycleMu.Lock()
+	opens, closes, resets := openHooks, closeHooks, resetFuncs
+	openHooks, closeHooks, resetFuncs = nil, nil, nil
+	lifecycleMu.Unlock()
+
+	t.Cleanup(func() {
+		lifecycleMu.Lock()
+		openHooks, closeHooks, resetFuncs = opens, closes, resets
+		lifecycleMu.Unlock()
+		openedOrder = nil
+		openedHooks = map[string]bool{}
+	})
+}
+
+type lifecycleLog []string
+
+func (l *lifecycleLog) hook(event string, err error) LifecycleFunc {
+	return func(L State) error {
+		*l = append(*l, event)
+		return err
+	}
+}
+
+func TestCloseIsReverseOfOpen(t *testing.T) {
+	isolateLifecycle(t)
+
+	var log lifecycleLog
+	OnOpen("db", log.hook("open db", nil), "config")
+	OnOpen("cache", log.hook("open cache", nil))
+	OnOpen("config", log.hook("open config", nil))
+
+	// close deps of paired hooks don't change the order
+	OnClose("config", log.hook("close config", nil), "db")
+	OnClose("cache", log.hook("close cache", nil))
+	OnClose("db", log.hook("close db", nil))
+
+	if err := runOpenHooks(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := runCloseHooks(0); err != nil {
+		t.Fatal(err)
+	}
+
+	want := lifecycleLog{
+		"open config", "open db", "open cache",
+		"close cache", "close db", "close config",
+	}
+	if !reflect.DeepEqual(log, want) {
+		t.Fatalf("hooks ran in order\n%v\nwant\n%v", log, want)
+	}
+}
+
+func TestUnpairedCloseHookDeps(t *testing.T) {
+	isolateLifecycle(t)
+
+	var log lifecycleLog
+	OnOpen("a", log.hook("open a", nil))
+	OnOpen("b", log.hook("open b", nil))
+	OnClose("a", log.hook("close a", nil))
+	OnClose("b", log.hook("close b", nil))
+	OnClose("flush", log.hook("close flush", nil), "a")
+
+	if err := runOpenHooks(0); err != nil {
+		t.Fatal(err)
+	}
+	if err := runCloseHooks(0); err != nil {
+		t.Fatal(err)
+	}
+
+	index := map[string]int{}
+	for i, event := range log {
+		index[event] = i
+	}
+	if index["close b"] > index["close a"] {
+		t.Errorf("b closed after a: %v", log)
+	}
+	if index["close flush"] > index["close a"] {
+		t.Errorf("flush closed after a, which it depends on: %v", log)
+	}
+}
+
+func TestFailedOpenRollsBack(t *testing.T) {
+	isolateLifecycle(t)
+
+	var log lifecycleLog
+	OnOpen("a", log.hook("open a", nil))
+	OnOpen("b", log.hook("open b", nil))
+	OnOpen("c", log.hook("open c", errors.New("boom")))
+	OnClose("a", log.hook("close a", nil))
+	OnClose("b", log.hook("close b", nil))
+	OnClose("c", log.hook("close c", nil))
+
+	err := runOpenHooks(0)
+	if err == nil || !strings.Contains(err.Error(), "OnOpen(c): boom") {
+		t.Fatalf("runOpenHooks = %v", err)
+	}
+
+	want := lifecycleLog{"open a", "open b", "open c", "close b", "close a"}
+	if !reflect.DeepEqual(log, want) {
+		t.Fatalf("hooks ran in order\n%v\nwant\n%v", log, want)
+	}
+
+	// the module closing later doesn't close them a second time
+	log = nil
+	if err := runCloseHooks(0); err != nil {
+		t.Fatal(err)
+	}
+	if len(log) != 0 {
+		t.Fatalf("close hooks ran again: %v", log)
+	}
+}
+
+func TestLifecycleDependencyCycle(t *testing.T) {
+	isolateLifecycle(t)
+
+	OnOpen("a", func(L State) error { return nil }, "b")
+	OnOpen("b", func(L State) error { return nil }, "a")
+
+	if err := runOpenHooks(0); err == nil || !strings.Contains(err.Error(), "dependency cycle") {
+		t.Fatalf("runOpenHooks = %v, want a dependency cycle error", err)
+	}
+}
@@ -1,4 +1,7 @@
 #include "c/glua.c"
 #include "c/think_queue.c"
+#include "c/debug_hook.c"
+#include "c/dump.c"
+#include "c/reader.c"
 
 // go only includes c files in the same directory as the go file
@@ -0,0 +1,308 @@
+package glua
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// A Lua value (table, function, userdata...) kept alive from Go, it can be passed around and called from any
+// goroutine. Calls from other goroutines are marshalled to the main thread through WaitLuaThink and block until
+// they ran.
+//
+// The reference is freed when the LuaObject is garbage collected by Go, objects from a previous module load
+// return an error instead of resolving against the new registry.
+type LuaObject struct {
+	ref      Ref
+	typeName string
+}
+
+var ErrStateClosed = errors.New("lua state is closed")
+
+// Closed when the module starts closing, so goroutines waiting on a call that will never run don't block forever
+var luaObjectsClosed atomic.Pointer[chan struct{}]
+
+// References of collected objects, freed together by a single LuaThink function
+var (
+	pendingUnrefsMu sync.Mutex
+	pendingUnrefs   []Ref
+	unrefScheduled  bool
+)
+
+func init() {
+	resetLuaObjects()
+	ResetOnOpen(resetLuaObjects)
+}
+
+func resetLuaObjects() {
+	closed := make(chan struct{})
+	luaObjectsClosed.Store(&closed)
+
+	pendingUnrefsMu.Lock()
+	pendingUnrefs = nil // they belong to the previous registry
+	unrefScheduled = false
+	pendingUnrefsMu.Unlock()
+}
+
+// Makes calls from other goroutines fail with ErrStateClosed. It runs before waiting for the glua.Go tasks, which
+// would otherwise wait forever on a call that needs the think queue to run.
+func closeLuaObjects() {
+	if closed := luaObjectsClosed.Swap(nil); closed != nil {
+		close(*closed)
+	}
+}
+
+/*
+Returns a LuaObject referencing the value at the given index.
+
+# Example
+
+	L.CheckTable(1)
+	plugin := L.NewLuaObject(1)
+
+	go func() {
+		res, err := plugin.Call("OnLoad", "config.json")
+		...
+	}()
+*/
+func (L State) NewLuaObject(idx int) *LuaObject {
+	o := &LuaObject{typeName: L.TypeName(L.Type(idx))}
+
+	L.PushValue(idx)
+	o.ref = L.NewRef()
+
+	runtime.SetFinalizer(o, (*LuaObject).finalize)
+	return o
+}
+
+func (o *LuaObject) finalize() {
+	ref := o.ref
+	if !ref.IsValid() {
+		return
+	}
+
+	// finalizers must not block, so the reference is queued and freed on the next think
+	pendingUnrefsMu.Lock()
+	defer pendingUnrefsMu.Unlock()
+
+	pendingUnrefs = append(pendingUnrefs, ref)
+	if !unrefScheduled {
+		unrefScheduled = true
+		LuaThink(freePendingRefs)
+	}
+}
+
+func freePendingRefs(L State) int {
+	pendingUnrefsMu.Lock()
+	refs := pendingUnrefs
+	pendingUnrefs = nil
+	unrefScheduled = false
+	pendingUnrefsMu.Unlock()
+
+	for _, ref := range refs {
+		if ref.IsValid() {
+			L.FreeRef(ref)
+		}
+	}
+	return 1
+}
+
+// Returns the Lua type name of the value, eg. "table".
+func (o *LuaObject) TypeName() string {
+	return o.typeName
+}
+
+// Returns true if the object was created in the current module load.
+func (o *LuaObject) IsValid() bool {
+	return o.ref.IsValid()
+}
+
+func (o *LuaObject) push(L State) {
+	L.PushRef(o.ref)
+}
+
+/*
+Calls the function in the given field of the object with the object as the first argument, like obj:method(...)
+in Lua, and returns its results converted with ToAny. Arguments are pushed with PushAny.
+
+# Example
+
+	res, err := plugin.Call("Handle", "ping", 3)
+*/
+func (o *LuaObject) Call(method string, args ...any) ([]any, error) {
+	return o.run(func(L State) ([]any, error) {
+		return o.call(L, method, args)
+	})
+}
+
+// Calls the object itself (a function or a value with __call) and returns its results converted with ToAny.
+func (o *LuaObject) Invoke(args ...any) ([]any, error) {
+	return o.run(func(L State) ([]any, error) {
+		return o.invoke(L, args)
+	})
+}
+
+/*
+Same as Call, but converts the first result to R.
+
+# Example
+
+	name, err := glua.CallAs[string](plugin, "Name")
+*/
+func CallAs[R any](o *LuaObject, method string, args ...any) (R, error) {
+	res, err := o.Call(method, args...)
+	if err != nil {
+		var zero R
+		return zero, err
+	}
+
+	r, err := ResultAs[R](res, 0)
+	if err != nil {
+		return r, fmt.Errorf("%s: %w", method, err)
+	}
+	return r, nil
+}
+
+/*
+Converts the i-th value returned by Call or Invoke to R, missing results are nil. It's what adapters generated by
+gluagen use to convert results.
+
+# Example
+
+	res, err := plugin.Call("Size")
+	...
+	w, err := glua.ResultAs[int](res, 0)
+	h, err := glua.ResultAs[int](res, 1)
+*/
+func ResultAs[R any](results []any, i int) (R, error) {
+	var zero R
+
+	var v any
+	if i < len(results) {
+		v = results[i]
+	}
+
+	rv, err := convertAny(v, reflect.TypeFor[R]())
+	if err != nil {
+		return zero, fmt.Errorf("result #%d: %w", i+1, err)
+	}
+	r, _ := rv.Interface().(R) // a nil interface doesn't assert
+	return r, nil
+}
+
+// Runs fn with the main state, directly if it's called from the main thread or through the think queue otherwise.
+func (o *LuaObject) run(fn func(L State) ([]any, error)) ([]any, error) {
+	if !o.ref.IsValid() {
+		return nil, staleEpochError("a Lua object", o.ref.epoch)
+	}
+
+	if IsMainThread() {
+		return fn(State(mainState.Load()))
+	}
+
+	closed := luaObjectsClosed.Load()
+	if closed == nil || !IS_STATE_OPEN.Load() {
+		return nil, ErrStateClosed
+	}
+
+	type result struct {
+		values []any
+		err    error
+	}
+	done := make(chan result, 1)
+
+	WaitLuaThink(func(L State) int {
+		res := result{}
+		defer func() {
+			if r := recover(); r != nil {
+				res.err = fmt.Errorf("%v", r)
+			}
+			done <- res
+		}()
+		res.values, res.err = fn(L)
+		return 0
+	})
+
+	select {
+	case res := <-done:
+		return res.values, res.err
+	case <-*closed:
+		return nil, ErrStateClosed
+	}
+}
+
+func (o *LuaObject) call(L State, method string, args []any) ([]any, error) {
+	if !o.ref.IsValid() {
+		return nil, staleEpochError("a Lua object", o.ref.epoch)
+	}
+
+	if o.typeName != "table" && o.typeName != "userdata" {
+		return nil, fmt.Errorf("attempt to index a %s value", o.typeName)
+	}
+
+	top := L.GetTop()
+	defer L.SetTop(top)
+
+	L.PushRef(o.ref)
+	L.GetField(-1, method)
+	if !isCallable(L, -1) {
+		return nil, fmt.Errorf("%s has no method %q", o.typeName, method)
+	}
+	L.PushValue(top + 1)
+
+	return pcallAny(L, top+2, args, 1)
+}
+
+func (o *LuaObject) invoke(L State, args []any) ([]any, error) {
+	if !o.ref.IsValid() {
+		return nil, staleEpochError("a Lua object", o.ref.epoch)
+	}
+
+	top := L.GetTop()
+	defer L.SetTop(top)
+
+	L.PushRef(o.ref)
+	if !isCallable(L, -1) {
+		return nil, fmt.Errorf("attempt to call a %s value", o.typeName)
+	}
+
+	return pcallAny(L, top+1, args, 0)
+}
+
+// Pushes args after the function at fnIdx (and the extra arguments already pushed after it), calls it and returns
+// its results.
+func pcallAny(L State, fnIdx int, args []any, extra int) ([]any, error) {
+	for i, arg := range args {
+		if err := L.PushAny(arg); err != nil {
+			return nil, fmt.Errorf("argument #%d: %w", i+1, err)
+		}
+	}
+
+	if err := L.PCall(len(args)+extra, LUA_MULTRET, 0); err != nil {
+		return nil, err
+	}
+
+	results := make([]any, 0, L.GetTop()-fnIdx+1)
+	for i := fnIdx; i <= L.GetTop(); i++ {
+		results = append(results, L.ToAny(i))
+	}
+	return results, nil
+}
+
+func isCallable(L State, idx int) bool {
+	idx = absIndex(L, idx)
+	if L.IsFunc(idx) {
+		return true
+	}
+	if L.GetMetatable(idx) == 0 {
+		return false
+	}
+	L.PushString("__call")
+	L.RawGet(-2)
+	callable := !L.IsNil(-1)
+	L.PopN(2)
+	return callable
+}
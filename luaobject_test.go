@@ -0,0 +1,79 @@
+package glua
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// Sets up the Go side of an open module without a Lua state, enough for code that only queues work.
+func fakeOpenModule(t *testing.T) {
+	t.Helper()
+
+	IS_STATE_OPEN.Store(true)
+	AdvanceEpoch()
+	thinkQueue = make(chan GoFunc, 100)
+	thinkFuncs = nil
+	resetLuaObjects()
+
+	t.Cleanup(func() {
+		IS_STATE_OPEN.Store(false)
+		thinkFuncs = nil
+		resetLuaObjects()
+	})
+}
+
+func TestLuaObjectCallDuringShutdown(t *testing.T) {
+	fakeOpenModule(t)
+
+	o := &LuaObject{ref: Ref{ref: 1, epoch: CurrentEpoch()}, typeName: "table"}
+
+	var err error
+	started := make(chan struct{})
+	Go(func() {
+		close(started)
+		_, err = o.Call("Save")
+	})
+	<-started
+
+	done := make(chan struct{})
+	go func() {
+		closeLuaObjects()
+		WaitGoTasks()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("WaitGoTasks deadlocked on a LuaObject call")
+	}
+
+	if !errors.Is(err, ErrStateClosed) {
+		t.Fatalf("Call during shutdown = %v, want ErrStateClosed", err)
+	}
+}
+
+func TestFinalizedRefsAreBatched(t *testing.T) {
+	fakeOpenModule(t)
+
+	for i := 1; i <= 3; i++ {
+		o := &LuaObject{ref: Ref{ref: i, epoch: CurrentEpoch()}}
+		o.finalize()
+	}
+
+	if len(thinkFuncs) != 1 {
+		t.Fatalf("%d think functions scheduled, want 1", len(thinkFuncs))
+	}
+	if len(pendingUnrefs) != 3 {
+		t.Fatalf("%d references pending, want 3", len(pendingUnrefs))
+	}
+
+	// objects from a previous load have nothing left to free
+	stale := &LuaObject{ref: Ref{ref: 4, epoch: CurrentEpoch()}}
+	AdvanceEpoch()
+	stale.finalize()
+	if len(pendingUnrefs) != 3 {
+		t.Fatalf("stale reference was queued")
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"sync/atomic"
 )
 
+// Kept for compatibility, OnOpen/OnClose allow more than one function. GMOD13_OPEN runs after the OnOpen hooks
+// and GMOD13_CLOSE runs before the OnClose hooks.
 var GMOD13_OPEN func(L State) int
 var GMOD13_CLOSE func(L State) int
 
@@ -22,33 +24,117 @@ func go_gmod13_open(L State) C.int {
 		return 0
 	}
 
+	res, openErr := openModule(L)
+	if openErr != nil {
+		L.ErrorNoHalt("glua: failed to open module:\n" + openErr.Error())
+	}
+	return C.int(res)
+}
+
+//export go_gmod13_close
+func go_gmod13_close(L State) C.int {
+	res, err := closeModule(L)
+	if err != nil {
+		L.ErrorNoHalt("glua: failed to close module:\n" + err.Error())
+	}
+
+	UnloadLuaShared()
+
+	return C.int(res)
+}
+
+/*
+Runs what gmod13_open does once lua_shared is loaded: resets the registries and the think queue for L, runs the
+ResetOnOpen functions and OnOpen hooks, then GMOD13_OPEN. L must be used from the calling thread from then on.
+
+It's meant for hosts and test harnesses that create the state themselves (like gluatest), modules loaded by gmod
+don't call it. If a hook fails, the ones that opened are closed again and the module stays closed.
+*/
+func OpenModule(L State) error {
+	_, err := openModule(L)
+	return err
+}
+
+// Set by PrepareModule, OpenModule keeps the registries the globals were pushed with instead of resetting them
+var preparedState State
+
+/*
+Runs the first part of OpenModule: starts a new module load and resets the registries, so Go functions can be
+pushed into L before the module is opened. OpenModule then only sets up the think queue and runs the hooks.
+
+Hosts use it to install globals the module expects to already exist, eg. gluatest installs gmodenv (whose timer
+and hook libraries drive the think queue) between the two.
+
+# Example
+
+	glua.PrepareModule(L)
+	env := gmodenv.Install(L, gmodenv.Options{})
+	if err := glua.OpenModule(L); err != nil {
+		return err
+	}
+*/
+func PrepareModule(L State) {
+	prepareModule(L)
+	preparedState = L
+}
+
+func prepareModule(L State) {
 	IS_STATE_OPEN.Store(true)
 
+	AdvanceEpoch()
+	MarkMainThread(L)
 	InitGoTasks(L)
 	InitGoPtrRegistry(L)
 	InitGoFuncRegistry(L)
+}
+
+/*
+Runs what gmod13_close does before lua_shared is unloaded: waits for the tasks started with Go, runs GMOD13_CLOSE
+and the OnClose hooks, then removes the think queue driver. The state isn't closed.
+*/
+func CloseModule(L State) error {
+	_, err := closeModule(L)
+	return err
+}
+
+func openModule(L State) (int, error) {
+	if preparedState != L {
+		prepareModule(L)
+	}
+	preparedState = 0
+
 	InitThinkQueue(L)
 
+	if err := runOpenHooks(L); err != nil {
+		// the hooks that opened were closed again, nothing should keep calling into the module
+		IS_STATE_OPEN.Store(false)
+		closeLuaObjects()
+		ShutdownThinkQueue(L)
+		return 0, err
+	}
+
 	if GMOD13_OPEN != nil {
-		return C.int(GMOD13_OPEN(L))
+		return GMOD13_OPEN(L), nil
 	}
 
-	return 0
+	return 0, nil
 }
 
-//export go_gmod13_close
-func go_gmod13_close(L State) C.int {
-	var res C.int = 0
+func closeModule(L State) (int, error) {
+	res := 0
 
+	closeLuaObjects()
 	WaitGoTasks()
 
 	if GMOD13_CLOSE != nil {
-		res = C.int(GMOD13_CLOSE(L))
+		res = GMOD13_CLOSE(L)
 	}
 
+	err := runCloseHooks(L)
+
 	IS_STATE_OPEN.Store(false)
 
-	UnloadLuaShared()
+	ShutdownThinkQueue(L)
 
-	return res
+	return res, err
 }
@@ -0,0 +1,114 @@
+package glua
+
+/*
+#include "c/reader.h"
+#include "c/glua.h"
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime/cgo"
+	"unsafe"
+)
+
+// Size of the C buffer each read of Load fills, lua_load copies it before asking for the next piece
+const loadReaderBufferSize = 16 * 1024
+
+type loadReader struct {
+	r   io.Reader
+	buf unsafe.Pointer
+	err error
+}
+
+//export goLoadReader
+func goLoadReader(handle C.uintptr_t, size *C.size_t) (piece *C.char) {
+	lr := cgo.Handle(handle).Value().(*loadReader)
+
+	*size = 0
+	if lr.err != nil {
+		return nil
+	}
+
+	// a panicking reader must not unwind through lua_load
+	defer func() {
+		if r := recover(); r != nil {
+			lr.err = fmt.Errorf("reader panicked: %v", r)
+			*size = 0
+			piece = nil
+		}
+	}()
+
+	buf := unsafe.Slice((*byte)(lr.buf), loadReaderBufferSize)
+	for {
+		n, err := lr.r.Read(buf)
+		if err != nil && err != io.EOF {
+			lr.err = err
+			return nil
+		}
+		if n > 0 {
+			*size = C.size_t(n)
+			if err == io.EOF {
+				lr.r = eofReader{}
+			}
+			return (*C.char)(lr.buf)
+		}
+		if err == io.EOF {
+			return nil
+		}
+		// (0, nil) is allowed by io.Reader and means "try again", returning it to lua would end the chunk
+	}
+}
+
+type eofReader struct{}
+
+func (eofReader) Read([]byte) (int, error) { return 0, io.EOF }
+
+/*
+Loads a chunk from r without buffering the whole source first and pushes it as a function, like CompileBufferX.
+
+The chunk is read in pieces through lua_load, so large generated scripts or decompressed bundles don't need to be
+held in memory twice. If r fails, its error is returned instead of the syntax error lua reports for the cut chunk.
+
+# Example
+
+	f, err := os.Open("big.lua.gz")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+
+	if err := L.Load(gz, "@big.lua", glua.ChunkModeText); err != nil {
+		fmt.Println(err)
+	}
+*/
+func (L State) Load(r io.Reader, chunkname, mode string) error {
+	lr := &loadReader{r: r, buf: C.malloc(loadReaderBufferSize)}
+	defer C.free(lr.buf)
+
+	h := cgo.NewHandle(lr)
+	defer h.Delete()
+
+	cName, cMode := CStr(chunkname), CStr(mode)
+	defer cName.free()
+	defer cMode.free()
+
+	status := C.load_reader(L.c(), C.uintptr_t(h), cName.c, cMode.c)
+	if lr.err != nil {
+		// replace the function or the error of the cut chunk, so the stack looks like any other failed load
+		L.Pop()
+		L.PushString(lr.err.Error())
+		return lr.err
+	}
+	if status != LUA_OK {
+		return errors.New(L.GetErrorMessage(int(status)))
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package glua_test
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/Srlion/glua"
+	"github.com/Srlion/glua/gluatest"
+)
+
+// Returns (0, nil) before every read of r, which io.Reader allows.
+type stallingReader struct {
+	r       io.Reader
+	stalled bool
+}
+
+func (s *stallingReader) Read(p []byte) (int, error) {
+	if s.stalled = !s.stalled; s.stalled {
+		return 0, nil
+	}
+	return s.r.Read(p)
+}
+
+type panickingReader struct{}
+
+func (panickingReader) Read([]byte) (int, error) { panic("reader broke") }
+
+// A chunk bigger than the buffer Load reads into.
+func bigChunk() string {
+	var code strings.Builder
+	code.WriteString("local sum = 0\n")
+	for i := 1; i <= 2000; i++ {
+		fmt.Fprintf(&code, "sum = sum + %d -- padding to cross the read buffer\n", i)
+	}
+	code.WriteString("return sum\n")
+	return code.String()
+}
+
+func TestLoadChunkedReaders(t *testing.T) {
+	L := gluatest.New(t)
+
+	code := bigChunk()
+	readers := map[string]func() io.Reader{
+		"whole":      func() io.Reader { return strings.NewReader(code) },
+		"one byte":   func() io.Reader { return iotest.OneByteReader(strings.NewReader(code)) },
+		"data + EOF": func() io.Reader { return iotest.DataErrReader(strings.NewReader(code)) },
+		"half":       func() io.Reader { return iotest.HalfReader(strings.NewReader(code)) },
+		"stalling":   func() io.Reader { return &stallingReader{r: strings.NewReader(code)} },
+	}
+	for name, reader := range readers {
+		if err := L.Load(reader(), "=big", glua.ChunkModeText); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if err := L.PCall(0, 1, 0); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		L.AssertValue(-1, 2000*2001/2)
+		L.Pop()
+	}
+
+	if err := L.Load(strings.NewReader(""), "=empty", glua.ChunkModeText); err != nil {
+		t.Fatalf("empty chunk: %v", err)
+	}
+	L.Pop()
+}
+
+func TestLoadReaderErrors(t *testing.T) {
+	L := gluatest.New(t)
+
+	readErr := errors.New("disk on fire")
+	broken := io.MultiReader(strings.NewReader("return 1 +"), iotest.ErrReader(readErr))
+	if err := L.Load(broken, "=broken", glua.ChunkModeText); !errors.Is(err, readErr) {
+		t.Fatalf("got %v, want the error of the reader instead of the syntax error of the cut chunk", err)
+	}
+	L.AssertValue(-1, readErr.Error())
+	L.Pop()
+
+	err := L.Load(iotest.TimeoutReader(iotest.OneByteReader(strings.NewReader("return 1"))), "=timeout", glua.ChunkModeText)
+	if !errors.Is(err, iotest.ErrTimeout) {
+		t.Fatalf("got %v, want the timeout of the second read", err)
+	}
+	L.Pop()
+
+	if err := L.Load(panickingReader{}, "=panic", glua.ChunkModeText); err == nil || !strings.Contains(err.Error(), "reader panicked: reader broke") {
+		t.Fatalf("got %v for a panicking reader", err)
+	}
+	L.Pop()
+
+	if err := L.Load(strings.NewReader("return ("), "=syntax", glua.ChunkModeText); err == nil || !strings.Contains(err.Error(), "syntax error") {
+		t.Fatalf("got %v for a syntax error", err)
+	}
+	L.Pop()
+
+	if L.GetTop() != 0 {
+		t.Fatalf("stack has %d values left", L.GetTop())
+	}
+}
+
+func TestLoadBinaryMode(t *testing.T) {
+	L := gluatest.New(t)
+
+	L.CompileString("return 7")
+	chunk, err := L.Dump(-1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	L.Pop()
+
+	if err := L.Load(iotest.OneByteReader(strings.NewReader(string(chunk))), "=dumped", glua.ChunkModeBinary); err != nil {
+		t.Fatal(err)
+	}
+	if err := L.PCall(0, 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	L.AssertValue(-1, 7)
+	L.Pop()
+
+	if err := L.Load(strings.NewReader(string(chunk)), "=dumped", glua.ChunkModeText); err == nil {
+		t.Fatal("binary chunk loaded in text mode")
+	}
+	L.Pop()
+}
@@ -0,0 +1,448 @@
+package glua
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Stubs are LuaLS (lua-language-server) definition files describing what the module adds to Lua, so editors can
+// autocomplete and type check code using it. Typed bindings (Bind, functions wrapped by WrapFunc) get real types,
+// GoFuncs only have `...: any` since their signature isn't known.
+
+type stubLibrary struct {
+	name    string
+	members map[string]any
+}
+
+type stubClass struct {
+	name        string
+	methods     map[string]GoFunc
+	metamethods map[string]GoFunc
+}
+
+var (
+	stubsMu       sync.Mutex
+	stubLibraries []stubLibrary
+	stubClasses   []stubClass
+	stubTypeNames = map[reflect.Type]string{}
+)
+
+func addStubLibrary(name string, members map[string]any) {
+	stubsMu.Lock()
+	defer stubsMu.Unlock()
+	stubLibraries = append(stubLibraries, stubLibrary{name: name, members: members})
+}
+
+func addStubClass(name string, t reflect.Type, methods, metamethods map[string]GoFunc) {
+	stubsMu.Lock()
+	defer stubsMu.Unlock()
+
+	stubClasses = append(stubClasses, stubClass{name: name, methods: methods, metamethods: metamethods})
+	stubTypeNames[t] = name
+	if t.Kind() == reflect.Pointer {
+		stubTypeNames[t.Elem()] = name
+	}
+}
+
+// Operators of the derived metamethods, the ones taking the other operand have it in parentheses
+var stubOperators = []struct {
+	event, op string
+	binary    bool
+	result    string // "" for the class itself
+}{
+	{"__add", "add", true, ""},
+	{"__sub", "sub", true, ""},
+	{"__mul", "mul", true, ""},
+	{"__div", "div", true, ""},
+	{"__mod", "mod", true, ""},
+	{"__pow", "pow", true, ""},
+	{"__unm", "unm", false, ""},
+	{"__len", "len", false, "integer"},
+	{"__call", "call", false, "any"},
+}
+
+/*
+Writes a LuaLS `---@meta` definition file for the libraries, classes, value types and bound types registered
+through glua. Bound types are known once Bind was called for them, so call it after the module is opened (or
+after binding a value of every type from init).
+
+# Example
+
+	glua.OnOpen("stubs", func(L glua.State) error {
+		f, err := os.Create("garrysmod/data/mymod_stubs.lua")
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return glua.WriteStubs(f)
+	})
+*/
+func WriteStubs(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	s := &stubWriter{w: bw, tables: map[string]bool{}, bound: map[reflect.Type]string{}}
+
+	stubsMu.Lock()
+	classes := append([]stubClass(nil), stubClasses...)
+	libraries := append([]stubLibrary(nil), stubLibraries...)
+	stubsMu.Unlock()
+
+	s.line("---@meta")
+
+	sort.Slice(classes, func(i, j int) bool { return classes[i].name < classes[j].name })
+	for _, c := range classes {
+		s.class(c)
+	}
+
+	for _, name := range boundStubNames() {
+		bindNamesMu.Lock()
+		t := bindNames[name]
+		bindNamesMu.Unlock()
+		if _, ok := s.bound[t]; !ok {
+			s.bound[t] = strings.TrimSuffix(name, bindReadOnlySuffix)
+			s.pending = append(s.pending, t)
+		}
+	}
+
+	s.writePending()
+
+	for _, lib := range libraries {
+		s.library(lib.name, lib.members)
+	}
+
+	// struct types used by library functions
+	s.writePending()
+
+	return bw.Flush()
+}
+
+// Names of the bound types, without the read-only variants of types that are also bound normally.
+func boundStubNames() []string {
+	bindNamesMu.Lock()
+	defer bindNamesMu.Unlock()
+
+	var names []string
+	for name := range bindNames {
+		base, readOnly := strings.CutSuffix(name, bindReadOnlySuffix)
+		if _, ok := bindNames[base]; readOnly && ok {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+type stubWriter struct {
+	w         *bufio.Writer
+	tables    map[string]bool         // library tables already declared
+	bound     map[reflect.Type]string // bound types written or pending
+	pending   []reflect.Type
+	afterFunc bool
+}
+
+func (s *stubWriter) line(format string, args ...any) {
+	fmt.Fprintf(s.w, format, args...)
+	s.w.WriteByte('\n')
+	s.afterFunc = false
+}
+
+// Separates a value from the function written before it.
+func (s *stubWriter) gap() {
+	if s.afterFunc {
+		s.line("")
+	}
+}
+
+// Writes the declaration line of a function, fields that aren't identifiers (eg. t["end"]) are assigned.
+func (s *stubWriter) funcLine(name string, params []string) {
+	if strings.Contains(name, "[") {
+		s.line("%s = function(%s) end", name, strings.Join(params, ", "))
+	} else {
+		s.line("function %s(%s) end", name, strings.Join(params, ", "))
+	}
+	s.afterFunc = true
+}
+
+func (s *stubWriter) class(c stubClass) {
+	local := stubIdent(c.name)
+
+	s.line("")
+	s.line("---@class %s", c.name)
+	for _, op := range stubOperators {
+		if _, ok := c.metamethods[op.event]; !ok {
+			continue
+		}
+		result := op.result
+		if result == "" {
+			result = c.name
+		}
+		if op.binary {
+			s.line("---@operator %s(%s): %s", op.op, c.name, result)
+		} else {
+			s.line("---@operator %s: %s", op.op, result)
+		}
+	}
+	s.line("local %s = {}", local)
+
+	for _, name := range sortedKeys(c.methods) {
+		if strings.HasPrefix(name, "__") {
+			continue
+		}
+		s.line("")
+		s.untypedFunc(local + ":" + name)
+	}
+}
+
+// Writes the bound types that aren't written yet, struct types used by fields and methods are bound when they're
+// pushed so they're described too.
+func (s *stubWriter) writePending() {
+	for len(s.pending) > 0 {
+		t := s.pending[0]
+		s.pending = s.pending[1:]
+		s.boundClass(s.bound[t], t)
+	}
+}
+
+func (s *stubWriter) boundClass(name string, t reflect.Type) {
+	bt := bindTypeOf(t)
+	local := stubIdent(name)
+
+	s.line("")
+	s.line("---@class %s", name)
+
+	fields := make([]string, 0, len(bt.fields))
+	for field := range bt.fields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		s.line("---@field %s %s", field, s.stubType(bt.fields[field].typ))
+	}
+	s.line("local %s = {}", local)
+
+	for _, method := range bt.methodNames() {
+		s.line("")
+		s.typedFunc(local+":"+method, bt.methods[method].fn.Type(), 1)
+	}
+}
+
+func (s *stubWriter) library(name string, members map[string]any) {
+	s.line("")
+	s.declareTable(name)
+
+	for _, key := range sortedKeys(members) {
+		s.member(stubField(name, key), members[key])
+	}
+}
+
+// Declares the tables along the dotted name.
+func (s *stubWriter) declareTable(name string) {
+	parts := strings.Split(name, ".")
+	for i := range parts {
+		table := strings.Join(parts[:i+1], ".")
+		if s.tables[table] {
+			continue
+		}
+		s.tables[table] = true
+		s.line("%s = {}", table)
+	}
+}
+
+func (s *stubWriter) member(field string, value any) {
+	switch v := value.(type) {
+	case GoFunc:
+		s.line("")
+		s.untypedFunc(field)
+		return
+	case map[string]any:
+		s.gap()
+		s.tables[field] = true
+		s.line("%s = {}", field)
+		for _, key := range sortedKeys(v) {
+			s.member(stubField(field, key), v[key])
+		}
+		return
+	case *Bound:
+		s.gap()
+		s.line("---@type %s", strings.TrimSuffix(v.Name(), bindReadOnlySuffix))
+		s.line("%s = nil", field)
+		return
+	}
+
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Func {
+		s.gap()
+	}
+
+	switch rv.Kind() {
+	case reflect.Func:
+		s.line("")
+		if _, ok := value.(func(State) int); ok {
+			s.untypedFunc(field)
+			return
+		}
+		s.typedFunc(field, rv.Type(), 0)
+	case reflect.Bool:
+		s.line("%s = %t", field, rv.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s.line("%s = %d", field, rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		s.line("%s = %d", field, rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		s.line("%s = %s", field, strconv.FormatFloat(rv.Float(), 'g', -1, 64))
+	case reflect.String:
+		s.line("%s = %s", field, strconv.Quote(rv.String()))
+	default:
+		s.line("---@type %s", s.stubType(rv.Type()))
+		s.line("%s = nil", field)
+	}
+}
+
+func (s *stubWriter) untypedFunc(name string) {
+	s.line("---@param ... any")
+	s.line("---@return any ...")
+	s.funcLine(name, []string{"..."})
+}
+
+// Writes the function with the Lua types of the Go function type t, skipping its first skip parameters.
+func (s *stubWriter) typedFunc(name string, t reflect.Type, skip int) {
+	var params []string
+
+	numIn := t.NumIn()
+	if t.IsVariadic() {
+		numIn--
+	}
+	for i := skip; i < numIn; i++ {
+		if t.In(i) == stateType {
+			continue
+		}
+		param := "arg" + strconv.Itoa(len(params)+1)
+		s.line("---@param %s %s", param, s.stubType(t.In(i)))
+		params = append(params, param)
+	}
+	if t.IsVariadic() {
+		s.line("---@param ... %s", s.stubType(t.In(numIn).Elem()))
+		params = append(params, "...")
+	}
+
+	numOut := t.NumOut()
+	if numOut > 0 && t.Out(numOut-1) == errorType {
+		numOut--
+	}
+	for i := 0; i < numOut; i++ {
+		s.line("---@return %s", s.stubType(t.Out(i)))
+	}
+
+	s.funcLine(name, params)
+}
+
+// Returns the LuaLS type of values of the Go type t, as converted by PushAny and the argument converters.
+func (s *stubWriter) stubType(t reflect.Type) string {
+	stubsMu.Lock()
+	name, ok := stubTypeNames[t]
+	stubsMu.Unlock()
+	if ok {
+		return name
+	}
+
+	switch t {
+	case luaObjectType:
+		return "any"
+	case bytesType:
+		return "string"
+	}
+
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return s.stubType(t.Elem()) + "[]"
+	case reflect.Map:
+		return "table<" + s.stubType(t.Key()) + ", " + s.stubType(t.Elem()) + ">"
+	case reflect.Func:
+		return "function"
+	case reflect.Pointer:
+		if t.Elem().Kind() == reflect.Struct {
+			return s.boundStubName(t)
+		}
+		return s.stubType(t.Elem())
+	case reflect.Struct:
+		return s.boundStubName(reflect.PointerTo(t))
+	default:
+		return "any"
+	}
+}
+
+// Returns the name the pointer type t is bound as (its Go type name if it was never bound), the type is
+// described after the ones already written.
+func (s *stubWriter) boundStubName(t reflect.Type) string {
+	bindNamesMu.Lock()
+	best := ""
+	for name, bound := range bindNames {
+		if bound == t && (best == "" || len(name) < len(best)) {
+			best = name
+		}
+	}
+	bindNamesMu.Unlock()
+
+	if best == "" {
+		best = t.Elem().String()
+	}
+	best = strings.TrimSuffix(best, bindReadOnlySuffix)
+
+	if _, ok := s.bound[t]; !ok {
+		s.bound[t] = best
+		s.pending = append(s.pending, t)
+	}
+	return best
+}
+
+// Returns a Lua identifier for the local holding the class table, eg. "main_Player" for "main.Player".
+func stubIdent(name string) string {
+	ident := strings.Map(func(r rune) rune {
+		if r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name)
+	if ident == "" || ident[0] >= '0' && ident[0] <= '9' {
+		ident = "_" + ident
+	}
+	return ident
+}
+
+// Returns table.key, or table["key"] if key isn't a valid identifier.
+func stubField(table, key string) string {
+	if key != "" && stubIdent(key) == key && !luaKeywords[key] {
+		return table + "." + key
+	}
+	return table + "[" + strconv.Quote(key) + "]"
+}
+
+var luaKeywords = map[string]bool{
+	"and": true, "break": true, "do": true, "else": true, "elseif": true, "end": true, "false": true, "for": true,
+	"function": true, "if": true, "in": true, "local": true, "nil": true, "not": true, "or": true, "repeat": true,
+	"return": true, "then": true, "true": true, "until": true, "while": true, "goto": true, "continue": true,
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,51 @@
+package glua
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type stubMoney struct{ Cents int64 }
+
+func (m *stubMoney) String() string                 { return fmt.Sprintf("%d", m.Cents) }
+func (m *stubMoney) Add(o *stubMoney) *stubMoney    { return &stubMoney{m.Cents + o.Cents} }
+func (m *stubMoney) Split(n int) ([]float64, error) { return nil, nil }
+
+func TestClassStubs(t *testing.T) {
+	isolateLifecycle(t)
+
+	stubsMu.Lock()
+	classes, libraries, typeNames := stubClasses, stubLibraries, stubTypeNames
+	stubClasses, stubLibraries, stubTypeNames = nil, nil, map[reflect.Type]string{}
+	stubsMu.Unlock()
+	t.Cleanup(func() {
+		stubsMu.Lock()
+		stubClasses, stubLibraries, stubTypeNames = classes, libraries, typeNames
+		stubsMu.Unlock()
+	})
+
+	noop := func(L State) int { return 0 }
+	RegisterClass[*stubMoney]("StubMoney", map[string]GoFunc{
+		"Split": noop,
+		"Cents": noop,
+	})
+
+	var out strings.Builder
+	if err := WriteStubs(&out); err != nil {
+		t.Fatal(err)
+	}
+	stubs := out.String()
+
+	for _, want := range []string{
+		"---@class StubMoney\n---@operator add(StubMoney): StubMoney\n",
+		// GoFuncs don't take the arguments of the Go method with the same name
+		"---@param ... any\n---@return any ...\nfunction StubMoney:Split(...) end\n",
+		"---@param ... any\n---@return any ...\nfunction StubMoney:Cents(...) end\n",
+	} {
+		if !strings.Contains(stubs, want) {
+			t.Errorf("stubs are missing %q:\n%s", want, stubs)
+		}
+	}
+}
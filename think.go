@@ -9,17 +9,59 @@ import (
 	"math/rand"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // The usage for C as a Think callback is because CGO is slow, so we need to only call it ONLY when we need to.
 
+type ThinkDriver int
+
+const (
+	// Drives the think queue with a zero delay gmod timer, the default
+	ThinkDriverTimer ThinkDriver = iota
+	// Drives the think queue with hook.Add("Think"), keeps working if addons clear timers
+	ThinkDriverHook
+	// Nothing drives the think queue, PollThinkQueue has to be called every frame (menu/headless states)
+	ThinkDriverManual
+)
+
+func (d ThinkDriver) String() string {
+	switch d {
+	case ThinkDriverTimer:
+		return "timer"
+	case ThinkDriverHook:
+		return "hook"
+	case ThinkDriverManual:
+		return "manual"
+	default:
+		return "unknown"
+	}
+}
+
 var (
 	thinkQueue   chan GoFunc
 	thinkFuncs   []GoFunc
 	thinkFuncsMu sync.Mutex
+
+	thinkDriver       = ThinkDriverTimer
+	activeThinkDriver ThinkDriver
+	thinkDriverName   string
 )
 
+/*
+Selects what drives the think queue, it takes effect the next time the module is opened so call it from init.
+
+# Example
+
+	func init() {
+		glua.SetThinkDriver(glua.ThinkDriverHook)
+	}
+*/
+func SetThinkDriver(driver ThinkDriver) {
+	thinkDriver = driver
+}
+
 func InitThinkQueue(L State) {
 	thinkQueue = make(chan GoFunc, 100) // Make a buffered channel for the think queue
 	thinkFuncs = make([]GoFunc, 0)      // Make a slice for the think functions
@@ -27,19 +69,71 @@ func InitThinkQueue(L State) {
 
 	C.reset_tasks_count()
 
-	L.GetGlobal("timer")
-	{
-		L.GetField(-1, "Create")
-		{
-			randomUniqueName := strconv.FormatInt(int64(rand.Int()), 10) + strconv.FormatInt(time.Now().UnixNano(), 10)
-			L.PushString("GoLuaThinkQueue" + randomUniqueName)
+	activeThinkDriver = thinkDriver
+	thinkDriverName = "GoLuaThinkQueue" + strconv.FormatInt(int64(rand.Int()), 10) + strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	switch activeThinkDriver {
+	case ThinkDriverTimer:
+		if !installThinkDriver(L, "timer", "Create", func() int {
+			L.PushString(thinkDriverName)
 			L.PushNumber(0) // Delay (0 = next frame)
 			L.PushNumber(0) // Repetitions (0 = infinite)
 			L.PushCFunc(C.think_queue_think)
+			return 4
+		}) {
+			activeThinkDriver = ThinkDriverManual
+		}
+	case ThinkDriverHook:
+		if !installThinkDriver(L, "hook", "Add", func() int {
+			L.PushString("Think")
+			L.PushString(thinkDriverName)
+			L.PushCFunc(C.think_queue_think)
+			return 3
+		}) {
+			activeThinkDriver = ThinkDriverManual
+		}
+	}
+}
+
+// Calls lib.fn with the arguments pushed by pushArgs, returns false if the library doesn't exist in this state.
+func installThinkDriver(L State, lib, fn string, pushArgs func() int) bool {
+	L.GetGlobal(lib)
+	defer L.Pop()
+
+	if !L.IsTable(-1) {
+		L.ErrorNoHalt("glua: '" + lib + "' library is missing, the think queue has to be polled manually with PollThinkQueue")
+		return false
+	}
+
+	L.GetField(-1, fn)
+	return L.TryCall(pushArgs(), 0)
+}
+
+// Removes the timer/hook that drives the think queue, so a reopened module doesn't keep a stale driver around.
+func ShutdownThinkQueue(L State) {
+	C.reset_tasks_count() // makes the C side stop calling into Go if the driver can't be removed
+
+	switch activeThinkDriver {
+	case ThinkDriverTimer:
+		L.GetGlobal("timer")
+		if L.IsTable(-1) {
+			L.GetField(-1, "Remove")
+			L.PushString(thinkDriverName)
+			L.TryCall(1, 0)
 		}
-		L.TryCall(4, 0)
+		L.Pop()
+	case ThinkDriverHook:
+		L.GetGlobal("hook")
+		if L.IsTable(-1) {
+			L.GetField(-1, "Remove")
+			L.PushString("Think")
+			L.PushString(thinkDriverName)
+			L.TryCall(2, 0)
+		}
+		L.Pop()
 	}
-	L.Pop()
+
+	activeThinkDriver = ThinkDriverManual
 }
 
 //export thinkQueueProcess
@@ -121,6 +215,35 @@ func LuaThink(fn GoFunc) {
 	C.increment_tasks_count() // concurrent increment
 }
 
+var (
+	mainThreadID atomic.Uint64
+	mainState    atomic.Uintptr
+)
+
+// Records the calling OS thread as the one running Lua, and L as the main state.
+//
+// It's called when the module is opened, hosts and test harnesses that create states themselves should call it
+// from the thread that runs Lua (with runtime.LockOSThread, since goroutines can move between threads).
+func MarkMainThread(L State) {
+	mainThreadID.Store(uint64(C.current_thread_id()))
+	mainState.Store(uintptr(L))
+}
+
+// Returns true if it's called from the thread running Lua, where the state can be used directly instead of going
+// through WaitLuaThink.
+func IsMainThread() bool {
+	id := mainThreadID.Load()
+	return id != 0 && id == uint64(C.current_thread_id())
+}
+
+// Returns the number of tasks queued with WaitLuaThink that didn't run yet.
+func ThinkQueueLen() int {
+	return len(thinkQueue)
+}
+
+// Processes the think queue once, it's what the driver calls every frame.
+//
+// Only needed with ThinkDriverManual or in states without the timer/hook libraries.
 func (L State) PollThinkQueue() {
 	thinkQueueProcess(L)
 }
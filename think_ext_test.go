@@ -0,0 +1,106 @@
+package glua_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Srlion/glua"
+	"github.com/Srlion/glua/gluatest"
+	"github.com/Srlion/glua/gmodenv"
+)
+
+// Returns whether the timer or hook driving the think queue under name exists.
+func thinkDriverInstalled(L *gluatest.State, driver glua.ThinkDriver, name string) bool {
+	var code string
+	switch driver {
+	case glua.ThinkDriverTimer:
+		code = fmt.Sprintf("return timer.Exists(%q)", name)
+	case glua.ThinkDriverHook:
+		code = fmt.Sprintf("local hooks = hook.GetTable().Think return hooks ~= nil and hooks[%q] ~= nil", name)
+	default:
+		return false
+	}
+	return L.Eval(code)[0] == true
+}
+
+func TestThinkDrivers(t *testing.T) {
+	for _, driver := range []glua.ThinkDriver{glua.ThinkDriverTimer, glua.ThinkDriverHook, glua.ThinkDriverManual} {
+		t.Run(driver.String(), func(t *testing.T) {
+			glua.SetThinkDriver(driver)
+			t.Cleanup(func() { glua.SetThinkDriver(glua.ThinkDriverTimer) })
+
+			L := gluatest.New(t)
+			if got := glua.ActiveThinkDriver(); got != driver {
+				t.Fatalf("active driver is %s, want %s", got, driver)
+			}
+
+			ran := 0
+			runOnce := func() {
+				glua.LuaThink(func(L glua.State) int {
+					ran++
+					return 1
+				})
+
+				L.Step(1)
+				if driver == glua.ThinkDriverManual {
+					if ran != 0 {
+						t.Fatal("the think queue ran without a driver")
+					}
+					L.PollThinkQueue()
+				}
+				L.Step(1) // removed after returning 1
+			}
+
+			first := glua.ThinkDriverName()
+			if got, want := thinkDriverInstalled(L, driver, first), driver != glua.ThinkDriverManual; got != want {
+				t.Fatalf("driver installed = %t, want %t", got, want)
+			}
+			runOnce()
+			if ran != 1 {
+				t.Fatalf("think function ran %d times, want 1", ran)
+			}
+
+			L.Reopen()
+
+			second := glua.ThinkDriverName()
+			if first == second {
+				t.Fatal("the reopened module reuses the driver name")
+			}
+			if thinkDriverInstalled(L, driver, first) {
+				t.Fatal("the driver of the closed module is still installed")
+			}
+			if got, want := thinkDriverInstalled(L, driver, second), driver != glua.ThinkDriverManual; got != want {
+				t.Fatalf("driver installed after reopening = %t, want %t", got, want)
+			}
+			runOnce()
+			if ran != 2 {
+				t.Fatalf("think function ran %d times in total, want 2", ran)
+			}
+		})
+	}
+}
+
+func TestThinkDriverFallsBackToManual(t *testing.T) {
+	glua.SetThinkDriver(glua.ThinkDriverHook)
+	t.Cleanup(func() { glua.SetThinkDriver(glua.ThinkDriverTimer) })
+
+	L := gluatest.NewEnv(t, gmodenv.Options{OnError: func(string) {}})
+
+	if err := glua.CloseModule(L.State); err != nil {
+		t.Fatal(err)
+	}
+	glua.PrepareModule(L.State)
+	L.Env.Reinstall()
+	L.Eval("hook = nil")
+	if err := glua.OpenModule(L.State); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := glua.ActiveThinkDriver(); got != glua.ThinkDriverManual {
+		t.Fatalf("active driver is %s without the hook library, want manual", got)
+	}
+	if errs := L.Env.Errors(); len(errs) != 1 || !strings.Contains(errs[0], "'hook' library is missing") {
+		t.Fatalf("got errors %q, want the missing library to be reported", errs)
+	}
+}
@@ -0,0 +1,63 @@
+package glua_test
+
+import (
+	"runtime/cgo"
+	"testing"
+
+	"github.com/Srlion/glua"
+	"github.com/Srlion/glua/gluatest"
+)
+
+func TestGetUserDataRejectsForeignValues(t *testing.T) {
+	L := gluatest.New(t)
+
+	meta := "userdata_test"
+	other := "userdata_test_other"
+	L.NewMetaTable(meta)
+	L.NewMetaTable(other)
+	L.PopN(2)
+
+	// get(value[, metatable]) returns the value held by the userdata
+	L.PushGoFunc(func(L glua.State) int {
+		top := L.GetTop()
+		var h cgo.Handle
+		if L.IsNoneOrNil(2) {
+			h = L.GetUserData(1, nil)
+		} else {
+			name := L.CheckString(2)
+			h = L.GetUserData(-top, &name) // a relative index, the metatables are pushed above it
+		}
+		if L.GetTop() != top {
+			t.Errorf("GetUserData left %d values on the stack, want %d", L.GetTop(), top)
+		}
+		L.PushString(h.Value().(string))
+		return 1
+	})
+	L.SetGlobal("get")
+
+	L.PushGoFunc(func(L glua.State) int {
+		L.NewUserData("plain", nil)
+		L.NewUserData("typed", &meta)
+		L.PushLightUserData(1)
+		return 3
+	})
+	L.SetGlobal("make")
+	L.Eval(`plain, typed, light = make()`)
+
+	L.AssertGlobal("get(plain)", "plain")
+	L.AssertGlobal("get(typed)", "typed")
+	L.AssertGlobal("get(typed, '"+meta+"')", "typed")
+
+	L.AssertError("return get(light)", "expected a userdata")
+	L.AssertError("return get({})", "expected a userdata")
+	L.AssertError("return get(newproxy())", "userdata not created by NewUserData")
+	L.AssertError("return get(typed, '"+other+"')", "expected a userdata of type: "+other)
+	// no metatable at all
+	L.AssertError("return get(plain, '"+meta+"')", "expected a userdata of type: "+meta)
+	// the right metatable on a userdata glua didn't create
+	L.AssertError(`
+		local p = newproxy()
+		debug.setmetatable(p, debug.getregistry()["`+meta+`"])
+		return get(p, "`+meta+`")
+	`, "userdata not created by NewUserData")
+}
@@ -0,0 +1,217 @@
+package glua
+
+/*
+#include "c/glua.h"
+*/
+import "C"
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+// Value types are copied straight into the userdata memory instead of going through a cgo.Handle, so accessing
+// them is a pointer cast. Only types without Go pointers can be stored this way, the Go GC doesn't scan Lua memory.
+
+// Lua userdata memory is aligned for doubles, so types needing more than that can't be stored in it
+const maxValueTypeAlign = 8
+
+// A pointer-free Go type stored directly in Lua userdata, see RegisterValueType.
+type ValueType[T any] struct {
+	name string
+	// the metatable of the current module load, compared against instead of looking it up by name
+	meta Ref
+}
+
+// reflect.Type -> *ValueType[T], only written on registration
+var valueTypes sync.Map
+
+/*
+Registers T as a value type with the given metatable name, its metatable is created every time the module is
+opened.
+
+Methods whose name starts with "__" are set on the metatable (eg. "__add", "__tostring"), the others are looked up
+through __index, so methods can't contain "__index" itself. It panics if T contains Go pointers (pointers, strings,
+slices, maps, interfaces...), if T is already registered or if methods contains "__index".
+
+# Example
+
+	type Vec struct{ X, Y, Z float64 }
+
+	var VecType *glua.ValueType[Vec]
+
+	func init() {
+		VecType = glua.RegisterValueType[Vec]("Vec", map[string]glua.GoFunc{
+			"Length": func(L glua.State) int {
+				v := VecType.Check(L, 1)
+				L.PushNumber(math.Sqrt(v.X*v.X + v.Y*v.Y + v.Z*v.Z))
+				return 1
+			},
+			"__add": func(L glua.State) int {
+				a, b := VecType.Check(L, 1), VecType.Check(L, 2)
+				VecType.Push(L, Vec{a.X + b.X, a.Y + b.Y, a.Z + b.Z})
+				return 1
+			},
+		})
+	}
+*/
+func RegisterValueType[T any](name string, methods map[string]GoFunc) *ValueType[T] {
+	t := reflect.TypeFor[T]()
+	if err := checkPointerFree(t); err != nil {
+		panic(fmt.Sprintf("glua: value type %s (%s): %v", name, t, err))
+	}
+	if t.Align() > maxValueTypeAlign {
+		panic(fmt.Sprintf("glua: value type %s (%s) needs an alignment of %d", name, t, t.Align()))
+	}
+
+	if _, ok := methods["__index"]; ok {
+		panic(fmt.Sprintf("glua: value type %s: __index is used for the methods and can't be set", name))
+	}
+
+	vt := &ValueType[T]{name: name}
+	if other, loaded := valueTypes.LoadOrStore(t, vt); loaded {
+		panic(fmt.Sprintf("glua: %s is already registered as value type %s", t, other.(*ValueType[T]).name))
+	}
+
+	addStubClass(name, t, methods, nil)
+
+	OnOpen("valuetype:"+name, func(L State) error {
+		if !L.NewMetaTable(name) {
+			L.Pop()
+			return fmt.Errorf("metatable %s already exists", name)
+		}
+
+		L.NewTable()
+		for method, fn := range methods {
+			L.PushGoFunc(fn)
+			if strings.HasPrefix(method, "__") {
+				L.SetField(-3, method)
+			} else {
+				L.SetField(-2, method)
+			}
+		}
+		L.SetField(-2, "__index")
+
+		vt.meta = L.NewRef()
+		return nil
+	})
+
+	OnClose("valuetype:"+name, func(L State) error {
+		L.FreeRef(vt.meta)
+		vt.meta = Ref{}
+		return nil
+	})
+
+	return vt
+}
+
+func checkPointerFree(t reflect.Type) error {
+	switch t.Kind() {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64, reflect.Complex64, reflect.Complex128:
+		return nil
+	case reflect.Array:
+		return checkPointerFree(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if err := checkPointerFree(f.Type); err != nil {
+				return fmt.Errorf("field %s: %w", f.Name, err)
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("%s contains Go pointers", t)
+	}
+}
+
+// Returns the metatable name of the value type.
+func (vt *ValueType[T]) Name() string {
+	return vt.name
+}
+
+/*
+Copies v into a new userdata with the type's metatable and pushes it onto the stack.
+
+Returns a pointer to the copy in Lua memory, it's only valid while the userdata is alive.
+*/
+func (vt *ValueType[T]) Push(L State, v T) *T {
+	if !vt.meta.IsValid() {
+		panic("metatable not found: " + vt.name)
+	}
+
+	ptr := (*T)(C.lua_newuserdata_wrap(L.c(), C.size_t(unsafe.Sizeof(v))))
+	*ptr = v
+
+	L.PushRef(vt.meta)
+	L.SetMetatable(-2)
+
+	return ptr
+}
+
+/*
+Returns a pointer to the value of the userdata at the given argument, raising an argument error if it isn't a T.
+
+Writes through the pointer change the Lua value in place.
+*/
+func (vt *ValueType[T]) Check(L State, arg int) *T {
+	ptr, ok := vt.To(L, arg)
+	if !ok {
+		L.TypeError(arg, vt.name)
+	}
+	return ptr
+}
+
+// Same as Check, but returns false instead of raising an error.
+func (vt *ValueType[T]) To(L State, idx int) (*T, bool) {
+	if !vt.meta.IsValid() || L.Type(idx) != LUA_TUSERDATA {
+		return nil, false
+	}
+
+	idx = absIndex(L, idx)
+	if L.GetMetatable(idx) == 0 {
+		return nil, false
+	}
+	L.PushRef(vt.meta)
+	same := L.AreRawEqual(-1, -2)
+	L.PopN(2)
+	if !same {
+		return nil, false
+	}
+
+	return (*T)(C.lua_touserdata_wrap(L.c(), C.int(idx))), true
+}
+
+// Returns the registered value type of T, nil if T isn't registered.
+func valueTypeOf[T any]() *ValueType[T] {
+	vt, ok := valueTypes.Load(reflect.TypeFor[T]())
+	if !ok {
+		return nil
+	}
+	return vt.(*ValueType[T])
+}
+
+/*
+Same as Check on the registered value type of T, for code that doesn't have the *ValueType[T] at hand. Check
+is faster, it doesn't have to look the type up.
+*/
+func CheckValue[T any](L State, arg int) *T {
+	vt := valueTypeOf[T]()
+	if vt == nil {
+		L.TypeError(arg, reflect.TypeFor[T]().String())
+	}
+	return vt.Check(L, arg)
+}
+
+// Same as CheckValue, but returns false instead of raising an error.
+func ToValue[T any](L State, idx int) (*T, bool) {
+	vt := valueTypeOf[T]()
+	if vt == nil {
+		return nil, false
+	}
+	return vt.To(L, idx)
+}
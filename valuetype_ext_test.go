@@ -0,0 +1,59 @@
+package glua_test
+
+import (
+	"testing"
+
+	"github.com/Srlion/glua"
+	"github.com/Srlion/glua/gluatest"
+)
+
+type testVec struct{ X, Y float64 }
+
+var testVecType *glua.ValueType[testVec]
+
+func init() {
+	testVecType = glua.RegisterValueType[testVec]("glua_test_Vec", map[string]glua.GoFunc{
+		"Sum": func(L glua.State) int {
+			v := testVecType.Check(L, 1)
+			L.PushNumber(v.X + v.Y)
+			return 1
+		},
+		"Scale": func(L glua.State) int {
+			v := glua.CheckValue[testVec](L, 1)
+			f := float64(L.CheckNumber(2))
+			v.X, v.Y = v.X*f, v.Y*f
+			return 0
+		},
+		"__add": func(L glua.State) int {
+			a, b := testVecType.Check(L, 1), testVecType.Check(L, 2)
+			testVecType.Push(L, testVec{a.X + b.X, a.Y + b.Y})
+			return 1
+		},
+	})
+}
+
+func TestValueType(t *testing.T) {
+	L := gluatest.New(t)
+
+	testVecType.Push(L.State, testVec{1, 2})
+	L.SetGlobal("v")
+
+	L.AssertEqual(L.Eval("return v:Sum()")[0], 3)
+	L.AssertEqual(L.Eval("return (v + v):Sum()")[0], 6)
+	L.Eval("v:Scale(10)")
+	L.AssertEqual(L.Eval("return v:Sum()")[0], 30)
+
+	L.AssertError("v.Sum({})", "glua_test_Vec expected")
+	L.AssertError("v.Sum(newproxy(true))", "glua_test_Vec expected")
+
+	L.GetGlobal("v")
+	if _, ok := testVecType.To(L.State, -1); !ok {
+		t.Fatal("To doesn't accept a pushed value")
+	}
+	L.Pop()
+	L.PushNumber(1)
+	if _, ok := glua.ToValue[testVec](L.State, -1); ok {
+		t.Fatal("ToValue accepts a number")
+	}
+	L.Pop()
+}
@@ -0,0 +1,45 @@
+package glua
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func expectPanic(t *testing.T, substr string, fn func()) {
+	t.Helper()
+	defer func() {
+		t.Helper()
+		r := recover()
+		if r == nil {
+			t.Fatalf("expected a panic containing %q", substr)
+		}
+		if msg, _ := r.(string); !strings.Contains(msg, substr) {
+			t.Fatalf("panic %v doesn't contain %q", r, substr)
+		}
+	}()
+	fn()
+}
+
+func TestRegisterValueTypeChecks(t *testing.T) {
+	isolateLifecycle(t)
+
+	type vec struct{ X, Y float64 }
+	type withString struct{ S string }
+	t.Cleanup(func() { valueTypes.Delete(reflect.TypeFor[vec]()) })
+
+	expectPanic(t, "contains Go pointers", func() {
+		RegisterValueType[withString]("glua_test_withString", nil)
+	})
+	expectPanic(t, "__index", func() {
+		RegisterValueType[vec]("glua_test_vec", map[string]GoFunc{"__index": func(L State) int { return 0 }})
+	})
+
+	vt := RegisterValueType[vec]("glua_test_vec", nil)
+	if valueTypeOf[vec]() != vt {
+		t.Fatal("valueTypeOf doesn't return the registered value type")
+	}
+	expectPanic(t, "already registered as value type glua_test_vec", func() {
+		RegisterValueType[vec]("glua_test_vec2", nil)
+	})
+}